@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const annotationMarker = "verification-helper: "
+
+// annotationPrefix は filename の言語の行コメントで書いたアノテーションの書き出しを返す (e.g. "// verification-helper: ", "# verification-helper: ")
+func annotationPrefix(filename string) string {
+	return lookupLanguage(filename).CommentPrefix() + " " + annotationMarker
+}
+
+type Annotation struct {
+	ProblemURL string
+	BuildTags  []string
+	// Tags は verification file をグループ分けするためのタグ
+	Tags []string
+	// TestcaseSources はテストケースの取得元の指定。空なら -sources フラグに従う
+	TestcaseSources string
+	// Sources はビルドに一緒に渡すファイル。verification file のディレクトリからの相対パスで書く
+	Sources []string
+	// Expect は失敗することを確かめたい解答で期待するジャッジ結果。unknown なら全ケース AC を期待する
+	Expect runStatus
+	// SkipCases は公式のデータが壊れているなどの理由で実行しないケースの名前
+	SkipCases []string
+	// Checker は出力の正誤を判定するチェッカーのソース。verification file のディレクトリからの相対パスで書く
+	Checker string
+	// TimeLimit が正なら、ジャッジの制限時間の代わりにこれをケースごとの制限時間にする
+	TimeLimit time.Duration
+	// Interactive はインタラクティブな問題のジャッジのソース。verification file のディレクトリからの相対パスで書く
+	Interactive string
+	// Tolerance が正なら、出力をトークンごとに比べて数はこの絶対誤差か相対誤差までを許す
+	Tolerance float64
+	// Defines は DEFINE で定義した、ビルドの前にソースの {{NAME}} に埋め込む値
+	Defines map[string]string
+	// TokenCompare が true なら、出力を空白区切りのトークンごとに比べて空白や改行の違いを問わない
+	TokenCompare bool
+}
+
+// hasAnyTag は tags のどれかが a に付いているかを返す。tags が空なら常に true
+func (a *Annotation) hasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.Contains(a.Tags, tag)
+	})
+}
+
+// checkerPath は CHECKER で指定されたチェッカーのパスを返す。指定が無ければ空文字を返す
+func (a *Annotation) checkerPath(filename string) string {
+	return resolveAnnotationPath(filename, a.Checker)
+}
+
+// interactivePath は INTERACTIVE で指定されたジャッジのパスを返す。指定が無ければ空文字を返す
+func (a *Annotation) interactivePath(filename string) string {
+	return resolveAnnotationPath(filename, a.Interactive)
+}
+
+// resolveAnnotationPath は filename のディレクトリからの相対パスで書かれた path を解決する
+func resolveAnnotationPath(filename, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(filename), path)
+}
+
+// sourceFiles は filename と、SOURCES で指定されたファイルをビルドに渡すパスにして返す
+func (a *Annotation) sourceFiles(filename string) []string {
+	files := []string{filename}
+	for _, s := range a.Sources {
+		if !filepath.IsAbs(s) {
+			s = filepath.Join(filepath.Dir(filename), s)
+		}
+		files = append(files, s)
+	}
+	return files
+}
+
+func readAnnotationInFile(filename string) (*Annotation, error) {
+	body, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	a := &Annotation{}
+
+	// 1 つしか書けないキーについて、最初に書かれた行と値を覚えておく
+	type occurrence struct {
+		line  int
+		value string
+	}
+	seen := make(map[string]occurrence)
+	// DEFINE は何度も書けるが、同じ名前は 1 度だけ。名前ごとに最初に書かれた行と値を覚えておく
+	defined := make(map[string]occurrence)
+
+	var diags annotationDiagnostics
+
+	prefix := annotationPrefix(filename)
+	bodyStr := string(body)
+	lineNumber := 0
+	for line := range strings.Lines(bodyStr) {
+		lineNumber++
+		if !isAnnotationComment(prefix, line) {
+			continue
+		}
+
+		comment := strings.TrimRight(line, "\r\n")
+		key, value, err := parseAnnotationComment(prefix, comment)
+		if err != nil {
+			diags = append(diags, annotationDiagnostic{file: filename, line: lineNumber, message: err.Error()})
+			continue
+		}
+
+		if singleValuedKeys[key] {
+			if first, ok := seen[key]; ok {
+				if first.value != value {
+					msg := fmt.Sprintf("conflicting %s annotations: %q here but %q at line %d", key, value, first.value, first.line)
+					diags = append(diags, annotationDiagnostic{file: filename, line: lineNumber, message: msg})
+				} else {
+					slog.Warn("duplicate annotation", slog.String("at", fmt.Sprintf("%s:%d", filename, lineNumber)), slog.String("key", key), slog.Int("first line", first.line))
+				}
+				continue
+			}
+			seen[key] = occurrence{line: lineNumber, value: value}
+		}
+
+		if key == "DEFINE" {
+			// 書式の誤りは readAnnotationComment で報告する
+			if name, v, err := parseDefine(value); err == nil {
+				if first, ok := defined[name]; ok {
+					if first.value != v {
+						msg := fmt.Sprintf("conflicting DEFINE %s: %q here but %q at line %d", name, v, first.value, first.line)
+						diags = append(diags, annotationDiagnostic{file: filename, line: lineNumber, message: msg})
+					} else {
+						slog.Warn("duplicate annotation", slog.String("at", fmt.Sprintf("%s:%d", filename, lineNumber)), slog.String("key", key+" "+name), slog.Int("first line", first.line))
+					}
+					continue
+				}
+				defined[name] = occurrence{line: lineNumber, value: v}
+			}
+		}
+
+		err = readAnnotationComment(a, prefix, comment)
+		if err != nil {
+			diags = append(diags, annotationDiagnostic{file: filename, line: lineNumber, message: err.Error()})
+		}
+	}
+
+	if len(diags) > 0 {
+		return nil, diags
+	}
+
+	if a.ProblemURL == "" {
+		errMsg := fmt.Sprintf("annotation comment is not found. filename: %s", filename)
+		return nil, errors.New(errMsg)
+	}
+
+	return a, nil
+}
+
+// annotationDiagnostic はアノテーションの誤りを行番号付きで表す
+type annotationDiagnostic struct {
+	file    string
+	line    int
+	message string
+}
+
+func (d annotationDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.file, d.line, d.message)
+}
+
+type annotationDiagnostics []annotationDiagnostic
+
+func (ds annotationDiagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.String())
+	}
+	return fmt.Sprintf("invalid annotations:\n  %s", strings.Join(lines, "\n  "))
+}
+
+func isAnnotationComment(prefix, line string) bool {
+	return strings.HasPrefix(line, prefix)
+}
+
+// singleValuedKeys は 1 ファイルに 1 つだけ書けるキー
+var singleValuedKeys = map[string]bool{
+	"PROBLEM":          true,
+	"TESTCASE_SOURCES": true,
+	"EXPECT":           true,
+	"CHECKER":          true,
+	"TIME_LIMIT":       true,
+	"ERROR":            true,
+	"INTERACTIVE":      true,
+	"COMPARE":          true,
+}
+
+// parseAnnotationComment は "<prefix>KEY value" 形式のコメントをキーと値に分ける
+func parseAnnotationComment(prefix, comment string) (string, string, error) {
+	annotationRegexp := regexp.MustCompile(`^` + regexp.QuoteMeta(prefix) + `([A-Z_]+)(?:\s+(.*))?$`)
+	matches := annotationRegexp.FindStringSubmatch(comment)
+	if matches == nil {
+		errMsg := fmt.Sprintf(`annotation comment is not match "%sKEY value" comment: %s`, prefix, comment)
+		return "", "", errors.New(errMsg)
+	}
+
+	return matches[1], strings.TrimSpace(matches[2]), nil
+}
+
+// readAnnotationComment は "<prefix>KEY value" 形式のコメントを読んで a に反映する
+func readAnnotationComment(a *Annotation, prefix, comment string) error {
+	key, value, err := parseAnnotationComment(prefix, comment)
+	if err != nil {
+		return err
+	}
+
+	switch key {
+	case "PROBLEM":
+		if a.ProblemURL != "" {
+			// 最初に見つかったものを使う
+			return nil
+		}
+		if value == "" {
+			return fmt.Errorf("PROBLEM annotation requires a url. comment: %s", comment)
+		}
+		a.ProblemURL = value
+
+	case "BUILD_TAGS":
+		a.BuildTags = append(a.BuildTags, splitList(value)...)
+
+	case "TAGS":
+		a.Tags = append(a.Tags, splitList(value)...)
+
+	case "TESTCASE_SOURCES":
+		a.TestcaseSources = value
+
+	case "SOURCES":
+		a.Sources = append(a.Sources, splitList(value)...)
+
+	case "CHECKER":
+		a.Checker = value
+
+	case "INTERACTIVE":
+		if value == "" {
+			return fmt.Errorf("INTERACTIVE annotation requires the path of the judge. comment: %s", comment)
+		}
+		a.Interactive = value
+
+	case "SKIP_CASES":
+		a.SkipCases = append(a.SkipCases, splitList(value)...)
+
+	case "TIME_LIMIT":
+		limit, err := parseTimeLimit(value)
+		if err != nil {
+			return fmt.Errorf("%w. comment: %s", err, comment)
+		}
+		a.TimeLimit = limit
+
+	case "ERROR":
+		tolerance, err := parseTolerance(value)
+		if err != nil {
+			return fmt.Errorf("%w. comment: %s", err, comment)
+		}
+		a.Tolerance = tolerance
+
+	case "DEFINE":
+		name, v, err := parseDefine(value)
+		if err != nil {
+			return fmt.Errorf("%w. comment: %s", err, comment)
+		}
+		if a.Defines == nil {
+			a.Defines = make(map[string]string)
+		}
+		a.Defines[name] = v
+
+	case "COMPARE":
+		switch value {
+		case "exact":
+			a.TokenCompare = false
+		case "tokens":
+			a.TokenCompare = true
+		default:
+			return fmt.Errorf("COMPARE annotation must be exact or tokens. comment: %s", comment)
+		}
+
+	case "EXPECT":
+		status, ok := parseRunStatus(value)
+		if !ok || status == accepted || !status.judged() {
+			return fmt.Errorf("EXPECT annotation must be one of WA, TLE, RE or OLE. comment: %s", comment)
+		}
+		a.Expect = status
+	}
+
+	return nil
+}
+
+// parseTimeLimit は "2s" のような time.Duration の書式か、oj-verify と同じ秒数で書かれた制限時間を読む
+func parseTimeLimit(value string) (time.Duration, error) {
+	limit, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(value, 64)
+		if serr != nil {
+			errMsg := fmt.Sprintf("TIME_LIMIT annotation must be a duration such as 2s or a number of seconds: %q", value)
+			return 0, errors.New(errMsg)
+		}
+		limit = time.Duration(seconds * float64(time.Second))
+	}
+
+	if limit <= 0 {
+		errMsg := fmt.Sprintf("TIME_LIMIT annotation must be positive: %q", value)
+		return 0, errors.New(errMsg)
+	}
+
+	return limit, nil
+}
+
+// parseTolerance は "1e-6" のように書かれた許容誤差を読む
+func parseTolerance(value string) (float64, error) {
+	tolerance, err := strconv.ParseFloat(value, 64)
+	if err != nil || tolerance <= 0 || math.IsInf(tolerance, 0) {
+		errMsg := fmt.Sprintf("ERROR annotation must be a positive number such as 1e-6: %q", value)
+		return 0, errors.New(errMsg)
+	}
+	return tolerance, nil
+}
+
+// splitList はカンマまたは空白区切りの値を分割する
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// findAnnotatedFiles は root 以下から PROBLEM アノテーションを含むファイルを探す。
+// .aoj-verify などの隠しディレクトリは見ない
+func findAnnotatedFiles(root string) ([]string, error) {
+	defer profilePhase(context.Background(), profileWalk)()
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && projectCfg.ignored(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if walkSkipToolDir(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ok, err := containsProblemAnnotation(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func containsProblemAnnotation(path string) (bool, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(body, []byte(annotationPrefix(path)+"PROBLEM")), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadAnnotationInFileDefines(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    map[string]string
+		wantErr []annotationDiagnostic
+	}{
+		{
+			name: "different names",
+			body: "// verification-helper: DEFINE N=100\n// verification-helper: DEFINE MOD=998244353\n",
+			want: map[string]string{"N": "100", "MOD": "998244353"},
+		},
+		{
+			// 同じ値なら警告だけで済ませる
+			name: "same name and value",
+			body: "// verification-helper: DEFINE N=100\n// verification-helper: DEFINE N = 100\n",
+			want: map[string]string{"N": "100"},
+		},
+		{
+			name:    "same name with another value",
+			body:    "// verification-helper: DEFINE N=100\n\n// verification-helper: DEFINE N=200\n",
+			wantErr: []annotationDiagnostic{{line: 4, message: `conflicting DEFINE N: "200" here but "100" at line 2`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "sol_test.go")
+			body := "// verification-helper: PROBLEM https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A\n" + tt.body
+			if err := os.WriteFile(filename, []byte(body), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readAnnotationInFile(filename)
+			if tt.wantErr != nil {
+				var diags annotationDiagnostics
+				if !errors.As(err, &diags) {
+					t.Fatalf("readAnnotationInFile() error = %v, want diagnostics", err)
+				}
+				for i := range tt.wantErr {
+					tt.wantErr[i].file = filename
+				}
+				if !reflect.DeepEqual([]annotationDiagnostic(diags), tt.wantErr) {
+					t.Errorf("diagnostics = %v, want %v", diags, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Defines, tt.want) {
+				t.Errorf("Defines = %v, want %v", got.Defines, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type testcase struct {
+	ProblemID string `json:"problemId"`
+	Serial    int    `json:"serial"`
+	In        string `json:"in"`
+	Out       string `json:"out"`
+}
+
+const judgedatBaseURL = "https://judgedat.u-aizu.ac.jp"
+
+// fetchTestcase は judgedat 互換の API から 1 ケース取得する
+func fetchTestcase(ctx context.Context, apiURL string) (*testcase, error) {
+	resp, err := httpGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch testcases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	testcase := &testcase{}
+	err = decodeAPIResponse(resp, testcase)
+	if err != nil {
+		return nil, err
+	}
+
+	return testcase, nil
+}
+
+// saveTestcase は testcase を dir 以下の filename.in, filename.out に保存し、dir の manifest に記録する
+func saveTestcase(dir, filename string, testcase *testcase) error {
+	if !existsFileOrDir(dir) {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to mkdir: %w", err)
+		}
+	}
+
+	filename = sanitizeFilename(filename)
+
+	// 中身は blob として保存し、dir にはそれへのリンクを置く
+	inPath := filepath.Join(dir, filename+".in")
+	inSum, err := storeCaseFile(inPath, strings.NewReader(testcase.In))
+	if err != nil {
+		return fmt.Errorf("failed to create .in case: %w", err)
+	}
+
+	outPath := filepath.Join(dir, filename+".out")
+	outSum, err := storeCaseFile(outPath, strings.NewReader(testcase.Out))
+	if err != nil {
+		return fmt.Errorf("failed to create .out case: %w", err)
+	}
+
+	err = recordCaseInManifest(dir, filename, caseChecksum{In: inSum, Out: outSum})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("download and saved", slog.String("in", inPath), slog.String("out", outPath))
+	return nil
+}
+
+type header struct {
+	Serial     int    `json:"serial"`
+	Name       string `json:"name"`
+	InputSize  int    `json:"inputSize"`
+	OutputSize int    `json:"outputSize"`
+	Score      int    `json:"score"`
+	// File はジャッジ上のファイル名。Name と違うジャッジ (yukicoder) でだけ使う
+	File string `json:"file,omitempty"`
+	// TimeLimit はケースごとに制限時間が決まっているデータでの、このケースの制限時間 (秒)。0 なら問題の制限時間
+	TimeLimit float64 `json:"timeLimit,omitempty"`
+}
+
+// Ref: http://developers.u-aizu.ac.jp/api?key=judgedat%2Ftestcases%2F%7BproblemId%7D%2Fheader_GET
+type testcasesHeaderResponse struct {
+	ProblemID string    `json:"problemId"`
+	Headers   []*header `json:"headers"`
+}
+
+func fetchProblemTestcasesHeader(ctx context.Context, apiURL string) (*testcasesHeaderResponse, error) {
+	resp, err := httpGet(ctx, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	header := &testcasesHeaderResponse{}
+	err = decodeAPIResponse(resp, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+func extractProblemID(problemURL string) (string, error) {
+	u, err := url.Parse(problemURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse problemURL: %w", err)
+	}
+
+	switch u.Host {
+	case "judge.u-aizu.ac.jp":
+		// e.g. https://judge.u-aizu.ac.jp/onlinejudge/description.jsp?id=ALDS1_14_A
+		query := u.Query()
+		return query.Get("id"), nil
+
+	case "onlinejudge.u-aizu.ac.jp":
+		// e.g. https://onlinejudge.u-aizu.ac.jp/courses/lesson/1/ALDS1/14/ALDS1_14_A
+
+		segments := strings.Split(u.Path, "/")
+		return segments[len(segments)-1], nil
+
+	case yukicoderHost:
+		// e.g. https://yukicoder.me/problems/no/1
+		no, ok := strings.CutPrefix(strings.TrimSuffix(u.Path, "/"), "/problems/no/")
+		if _, err := strconv.Atoi(no); !ok || err != nil {
+			errMsg := fmt.Sprintf("yukicoder url must be https://%s/problems/no/<number>. url: %s", yukicoderHost, problemURL)
+			return "", errors.New(errMsg)
+		}
+		return no, nil
+
+	case libraryCheckerHost:
+		// e.g. https://judge.yosupo.jp/problem/aplusb
+		name, ok := strings.CutPrefix(strings.TrimSuffix(u.Path, "/"), "/problem/")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			errMsg := fmt.Sprintf("library checker url must be https://%s/problem/<name>. url: %s", libraryCheckerHost, problemURL)
+			return "", errors.New(errMsg)
+		}
+		return name, nil
+
+	default:
+		return "", errors.New(unsupportedURLMessage(problemURL, u.Host))
+	}
+
+	// unreached
+}
+
+// Ref: http://developers.u-aizu.ac.jp/api?key=judgeapi%2Fproblems%2F%7BproblemId%7D_GET
+type problemResponse struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	ProblemTimeLimit   int    `json:"problemTimeLimit"`
+	ProblemMemoryLimit int    `json:"problemMemoryLimit"`
+}
+
+func fetchProblem(ctx context.Context, problemID string) (*problemResponse, error) {
+	apiURL := fmt.Sprintf("https://judgeapi.u-aizu.ac.jp/problems/%s", problemID)
+
+	resp, err := httpGet(ctx, apiURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	problem := &problemResponse{}
+	err = decodeAPIResponse(resp, problem)
+	if err != nil {
+		return nil, err
+	}
+
+	err = problem.validate(problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	return problem, nil
+}
+
+// problemCategory は問題 ID からコース名やボリュームを取り出す。
+// e.g. ALDS1_14_A -> ALDS1, 0000 -> Volume 0
+func problemCategory(problemID string) string {
+	if course, _, ok := strings.Cut(problemID, "_"); ok {
+		return course
+	}
+	if len(problemID) >= 2 {
+		// 0000 ~ 0099 は先頭の 0 を全部取ると空になるので Volume 0 にする
+		volume := strings.TrimLeft(problemID[:len(problemID)-2], "0")
+		if volume == "" {
+			volume = "0"
+		}
+		return "Volume " + volume
+	}
+	return ""
+}
+
+// Ref: http://developers.u-aizu.ac.jp/api?key=judgedat%2Ftestcases%2Fsamples%2F%7BproblemId%7D_GET
+func fetchSampleTestcases(ctx context.Context, apiURL string) ([]*testcase, error) {
+	resp, err := httpGet(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch samples: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var samples []*testcase
+	err = decodeAPIResponse(resp, &samples)
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// apiError は AOJ の API が 2xx 以外の応答を返したことを表す
+type apiError struct {
+	url    string
+	status string
+	code   int
+	// message は応答の本文に入っていた AOJ のエラーの説明。読み取れなければ空
+	message string
+}
+
+func (e *apiError) Error() string {
+	var what string
+	switch e.code {
+	case http.StatusNotFound:
+		// judgedat も judgeapi も、存在しない問題 ID には 404 を返す
+		what = "not found (wrong problem id?)"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		what = "access denied"
+	default:
+		what = "request failed"
+	}
+
+	msg := fmt.Sprintf("%s: %s %s", e.url, what, e.status)
+	if e.message != "" {
+		msg += ": " + e.message
+	}
+	return msg
+}
+
+// aojErrorPayload は AOJ の API がエラーのときに返す本文の 1 要素。
+// Ref: http://developers.u-aizu.ac.jp/api (e.g. [{"id":1101,"code":"USER_NOT_FOUND","message":"..."}])
+type aojErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// decodeAPIResponse は resp の本文を JSON として v に読み込む。2xx でなければ、本文から AOJ のエラーの説明を取り出して apiError を返す。
+// 404 の HTML などをそのまま json.Unmarshal して分かりにくいエラーになるのを防ぐ。
+// 本文はケースの大きさになるので、並列にダウンロードしても読むたびに確保しないようにバッファを使い回す
+func decodeAPIResponse(resp *http.Response, v any) error {
+	body := getBytesBuffer()
+	defer putBytesBuffer(body)
+
+	_, err := body.ReadFrom(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &apiError{
+			url:     resp.Request.URL.String(),
+			status:  resp.Status,
+			code:    resp.StatusCode,
+			message: decodeAOJErrorMessage(body.Bytes()),
+		}
+	}
+
+	// json.Unmarshal は文字列をコピーするので、body を使い回しても v は壊れない
+	err = json.Unmarshal(body.Bytes(), v)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal body: %w", err)
+	}
+	return nil
+}
+
+// decodeAOJErrorMessage はエラーの本文を説明の文字列にする。AOJ の形式でなければ空文字列を返す
+func decodeAOJErrorMessage(body []byte) string {
+	var payloads []aojErrorPayload
+	if json.Unmarshal(body, &payloads) != nil {
+		var single aojErrorPayload
+		if json.Unmarshal(body, &single) != nil {
+			return ""
+		}
+		payloads = []aojErrorPayload{single}
+	}
+
+	var msgs []string
+	for _, p := range payloads {
+		switch {
+		case p.Code != "" && p.Message != "":
+			msgs = append(msgs, fmt.Sprintf("%s (%s)", p.Message, p.Code))
+		case p.Message != "":
+			msgs = append(msgs, p.Message)
+		case p.Code != "":
+			msgs = append(msgs, p.Code)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
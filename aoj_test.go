@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestProblemCategory(t *testing.T) {
+	tests := []struct {
+		problemID string
+		want      string
+	}{
+		{problemID: "ALDS1_14_A", want: "ALDS1"},
+		{problemID: "0000", want: "Volume 0"},
+		{problemID: "0099", want: "Volume 0"},
+		{problemID: "0100", want: "Volume 1"},
+		{problemID: "1000", want: "Volume 10"},
+		{problemID: "2345", want: "Volume 23"},
+		{problemID: "1", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.problemID, func(t *testing.T) {
+			if got := problemCategory(tt.problemID); got != tt.want {
+				t.Errorf("problemCategory(%q) = %q, want %q", tt.problemID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// git bisect run が解釈する終了コード。0 (good) は err が nil のときの終了コードで表す
+const (
+	bisectBad = 1
+	// bisectSkip はビルドできないコミットなど、良し悪しを決められないとき
+	bisectSkip = 125
+	// bisectAbort はネットワークの不調など環境の問題で、bisect を続けても意味が無いとき
+	bisectAbort = 128
+)
+
+// bisectStepError は bisect の 1 ステップの判定を終了コードで git bisect run に伝える
+type bisectStepError struct {
+	code   int
+	reason string
+}
+
+func (e *bisectStepError) Error() string {
+	return e.reason
+}
+
+// runBisect は git bisect を回して、verification file の 1 ケースが WA や TLE になり始めたコミットを探す。
+// 各コミットでは `aoj-verify bisect -step` が自分自身として呼ばれ、そのケースだけをビルドしてジャッジする
+func runBisect(args []string) error {
+	fset := flag.NewFlagSet("bisect", flag.ExitOnError)
+	caseName := fset.String("case", "", "name of the cached case that regressed (e.g. in9)")
+	good := fset.String("good", "", "a commit where the case is still AC")
+	bad := fset.String("bad", "HEAD", "a commit where the case fails")
+	tags := fset.String("tags", "", "comma-separated list of build tags passed to go build")
+	timeout := fset.Duration("timeout", 0, "time limit of the case overriding the judge's limit (0 means derive it)")
+	maxTime := fset.Duration("max-time", 0, "upper bound of the time limit (0 means no bound)")
+	timeMargin := fset.Duration("time-margin", defaultTimeMargin, "safety margin added to the judge's time limit")
+	timeFactor := fset.Float64("time-factor", 0, "multiplier applied to the judge's time limit (0 uses the language's factor)")
+	tokens := fset.Bool("tokens", false, "compare outputs token by token, like the COMPARE tokens annotation")
+	step := fset.Bool("step", false, "judge the case at the current commit and exit with a git bisect run code (used internally)")
+	// verify と同じ制限時間と比べ方でジャッジするように、設定ファイルの既定値も同じように使う
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	if fset.NArg() != 1 || *caseName == "" {
+		return errors.New("usage: aoj-verify bisect -case <case> -good <commit> [-bad <commit>] <file>")
+	}
+	filename := fset.Arg(0)
+
+	limits := &timeLimitSettings{margin: *timeMargin, maxTime: *maxTime, factor: *timeFactor, timeout: *timeout}
+	if *step {
+		return bisectStep(filename, *caseName, splitList(*tags), limits, *tokens)
+	}
+
+	if *good == "" {
+		return errors.New("-good is required: name a commit where the case is still AC")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate aoj-verify executable: %w", err)
+	}
+
+	err = gitCommand("bisect", "start", *bad, *good)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := gitCommand("bisect", "reset")
+		if err != nil {
+			slog.Warn("failed to reset git bisect", slog.Any("error", err))
+		}
+	}()
+
+	stepArgs := []string{
+		"bisect", "run", self, "bisect", "-step", "-case", *caseName, "-tags", *tags,
+		"-timeout", timeout.String(), "-max-time", maxTime.String(), "-time-margin", timeMargin.String(),
+		"-time-factor", strconv.FormatFloat(*timeFactor, 'g', -1, 64), "-tokens=" + strconv.FormatBool(*tokens),
+		filename,
+	}
+	err = gitCommand(stepArgs...)
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command("git", "rev-parse", "--short", "refs/bisect/bad").Output()
+	if err != nil {
+		return fmt.Errorf("failed to read the result of git bisect: %w", err)
+	}
+	slog.Info("first bad commit", slog.String("commit", strings.TrimSpace(string(out))), slog.String("case", *caseName))
+
+	return nil
+}
+
+// gitCommand は git を実行し、その出力をそのまま表示する
+func gitCommand(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to run git %s: %w", args[0]+" "+args[1], err)
+	}
+	return nil
+}
+
+// bisectStep は今のコミットで caseName のケースをビルドしてジャッジし、結果を bisectStepError で返す
+func bisectStep(filename, caseName string, tags []string, limits *timeLimitSettings, tokens bool) error {
+	result, err := judgeSingleCase(filename, caseName, tags, limits, tokens)
+	switch {
+	case isInfraError(err):
+		return &bisectStepError{code: bisectAbort, reason: err.Error()}
+	case err != nil:
+		// このコミットではビルドできないなど
+		return &bisectStepError{code: bisectSkip, reason: err.Error()}
+	}
+
+	slog.Info(result.status.String(), slog.String("testcase", caseName), slog.Duration("time", result.execTime))
+	switch {
+	case result.status == accepted:
+		return nil
+	case result.status.judged():
+		return &bisectStepError{code: bisectBad, reason: fmt.Sprintf("%s is %s", caseName, result.status)}
+	default:
+		return &bisectStepError{code: bisectSkip, reason: fmt.Sprintf("%s was not judged", caseName)}
+	}
+}
+
+// judgeSingleCase は verify と同じ判定の仕方で、キャッシュ済みの 1 ケースだけをビルドしてジャッジする。
+// 制限時間は limits から、出力の比べ方は annotation と tokens、設定ファイルの comparators から verify と同じように決める
+func judgeSingleCase(filename, caseName string, tags []string, limits *timeLimitSettings, tokens bool) (*runResult, error) {
+	annotation, err := readAnnotationInFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	files, err := findCachedCase(annotation.ProblemURL, caseName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		return nil, &infraError{err: fmt.Errorf("failed to mkdir: %w", err)}
+	}
+
+	tmpDir, err := os.MkdirTemp(workDir, "tmp")
+	if err != nil {
+		return nil, &infraError{err: fmt.Errorf("failed to temporally directory: %w", err)}
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binaryFilepath, err := filepath.Abs(filepath.Join(tmpDir, "main"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve binary path: %w", err)
+	}
+	if runtime.GOOS == "windows" {
+		binaryFilepath += ".exe"
+	}
+
+	runArgs, err := buildSolution(annotation.sourceFiles(filename), binaryFilepath, append(tags, annotation.BuildTags...), templateVars(annotation))
+	if err != nil {
+		return nil, err
+	}
+
+	var judgeLimit time.Duration
+	metadata, err := loadProblemMetadata(annotation.ProblemURL)
+	if err != nil {
+		slog.Warn("failed to load problem metadata; judge time limit is unknown", slog.Any("error", err))
+	} else {
+		judgeLimit = metadata.timeLimit()
+	}
+	policy := limits.policy(filename, annotation, judgeLimit)
+	slog.Debug("time limit", slog.String("policy", policy.String()))
+
+	compare, err := resolveCompareOptions(filename, annotation, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir := constructCacheDirPath(annotation.ProblemURL)
+	caseLimits, err := loadCaseTimeLimits(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	caseLimit, err := caseLimits.of(files)
+	if err != nil {
+		return nil, err
+	}
+	opts := &runCaseOptions{
+		timeLimit:      policy.limitFor(caseLimit),
+		compareOptions: compare,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if src := annotation.interactivePath(filename); src != "" {
+		judgePath, err := compileChecker(src)
+		if err != nil {
+			return nil, err
+		}
+		return runInteractiveCase(ctx, runArgs, judgePath, files, tmpDir, opts)
+	}
+
+	if src := annotation.checkerPath(filename); src != "" {
+		opts.checker, err = compileChecker(src)
+		if err != nil {
+			return nil, err
+		}
+	} else if bundled := bundledCheckerPath(cacheDir); existsFileOrDir(bundled) {
+		opts.checker, err = filepath.Abs(bundled)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return runCase(ctx, runArgs, files, tmpDir, opts)
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// テストケースの中身は sha256 をキーにした blob として cache/blobs に 1 つだけ置き、
+// 問題ごとのディレクトリにはそれへのハードリンクと、ケース名 → sha256 の manifest を置く。
+// 同じケースを持つ問題 (ITP1_1_A と その別バージョンなど) の間で容量を共有できる
+
+func blobsDirPath() string {
+	return filepath.Join(cacheRootPath(), "blobs")
+}
+
+func blobPath(sum string) string {
+	return filepath.Join(blobsDirPath(), sum[:2], sum)
+}
+
+// storeBlob は r の中身を blob として保存し、その sha256 を返す。同じ中身の blob が既にあれば何もしない
+func storeBlob(r io.Reader) (string, error) {
+	defer profilePhase(context.Background(), profileHash)()
+
+	err := os.MkdirAll(blobsDirPath(), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(blobsDirPath(), "tmp*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = pooledCopy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	dst := blobPath(sum)
+	if existsFileOrDir(dst) {
+		return sum, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to mkdir: %w", err)
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to chmod blob: %w", err)
+	}
+	err = os.Rename(tmp.Name(), dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	return sum, nil
+}
+
+// linkBlob は dst を sum の blob へのハードリンクにする。ハードリンクが使えないファイルシステムではコピーする
+func linkBlob(sum, dst string) error {
+	err := os.Remove(dst)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", dst, err)
+	}
+
+	err = os.Link(blobPath(sum), dst)
+	if err == nil {
+		return nil
+	}
+
+	return copyFile(blobPath(sum), dst)
+}
+
+// storeCaseFile は r の中身を blob に保存して dst にリンクし、その sha256 を返す
+func storeCaseFile(dst string, r io.Reader) (string, error) {
+	sum, err := storeBlob(r)
+	if err != nil {
+		return "", err
+	}
+
+	err = linkBlob(sum, dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to link %s: %w", dst, err)
+	}
+
+	return sum, nil
+}
+
+// caseManifest は問題ごとの、ケース名 → 入出力の blob の sha256
+type caseManifest struct {
+	Cases map[string]caseChecksum `json:"cases"`
+	// TimeLimits はケースごとに制限時間が決まっているデータでの、ケース名 → 制限時間 (秒)。無いケースは問題の制限時間に従う
+	TimeLimits map[string]float64 `json:"timeLimits,omitempty"`
+}
+
+// constructCaseManifestPath は cacheDir (constructCacheDirPath の返すディレクトリ) の manifest のパスを返す
+func constructCaseManifestPath(cacheDir string) string {
+	return filepath.Join(filepath.Dir(cacheDir), "manifest.json")
+}
+
+// loadCaseManifest は cacheDir の manifest を読む。無ければ空の manifest を返す
+func loadCaseManifest(cacheDir string) (*caseManifest, error) {
+	m := &caseManifest{Cases: make(map[string]caseChecksum)}
+
+	body, err := os.ReadFile(constructCaseManifestPath(cacheDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	err = json.Unmarshal(body, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	if m.Cases == nil {
+		m.Cases = make(map[string]caseChecksum)
+	}
+
+	return m, nil
+}
+
+func (m *caseManifest) save(cacheDir string) error {
+	body, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	return writeFileWithDir(constructCaseManifestPath(cacheDir), append(body, '\n'))
+}
+
+// manifestMu は並列にダウンロードしたケースを記録するときに、manifest の読み書きが重ならないようにする
+var manifestMu sync.Mutex
+
+// recordCaseInManifest は cacheDir の manifest に name のケースを記録する
+func recordCaseInManifest(cacheDir, name string, sums caseChecksum) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	m, err := loadCaseManifest(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	m.Cases[name] = sums
+	return m.save(cacheDir)
+}
+
+// recordCaseTimeLimits は headers のうち制限時間が決まっているケースを cacheDir の manifest に記録する
+func recordCaseTimeLimits(cacheDir string, headers []*header) error {
+	limits := make(map[string]float64)
+	for _, h := range headers {
+		if h.TimeLimit > 0 {
+			limits[sanitizeFilename(h.Name)] = h.TimeLimit
+		}
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	m, err := loadCaseManifest(cacheDir)
+	if err != nil {
+		return err
+	}
+	if m.TimeLimits == nil {
+		m.TimeLimits = make(map[string]float64)
+	}
+	maps.Copy(m.TimeLimits, limits)
+	return m.save(cacheDir)
+}
+
+// saveTestcaseFiles は inPath, outPath のケースを blob に保存して cacheDir の name.in, name.out にリンクする。
+// inPath, outPath が cacheDir の中のファイルそのものでもよい
+func saveTestcaseFiles(cacheDir, name, inPath, outPath string) error {
+	inSum, err := storeBlobFile(inPath)
+	if err != nil {
+		return err
+	}
+	outSum, err := storeBlobFile(outPath)
+	if err != nil {
+		return err
+	}
+
+	err = linkBlob(inSum, filepath.Join(cacheDir, name+".in"))
+	if err != nil {
+		return fmt.Errorf("failed to link .in case: %w", err)
+	}
+	err = linkBlob(outSum, filepath.Join(cacheDir, name+".out"))
+	if err != nil {
+		return fmt.Errorf("failed to link .out case: %w", err)
+	}
+
+	return recordCaseInManifest(cacheDir, name, caseChecksum{In: inSum, Out: outSum})
+}
+
+func storeBlobFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return storeBlob(f)
+}
+
+// cacheIntegrityProblem はキャッシュの manifest と実際のファイルが食い違っている箇所
+type cacheIntegrityProblem struct {
+	path   string
+	reason string
+	// broken は削除すれば次のダウンロードで取得し直されるファイル
+	broken []string
+}
+
+func (p cacheIntegrityProblem) String() string {
+	return p.path + ": " + p.reason
+}
+
+// checkCacheIntegrity は全ての問題の manifest に記録されたケースが blob と一致しているかを調べる。
+// blob へのハードリンクになっていれば同じファイルかどうかだけを見る。full が true なら全てのファイルの sha256 を計算し直す
+func checkCacheIntegrity(full bool) ([]cacheIntegrityProblem, error) {
+	problemDirs, err := problemCacheDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []cacheIntegrityProblem
+	for _, problemDir := range problemDirs {
+		manifestPath := filepath.Join(problemDir, "manifest.json")
+		if !existsFileOrDir(manifestPath) {
+			continue
+		}
+		cacheDir := filepath.Join(problemDir, "test")
+		m, err := loadCaseManifest(cacheDir)
+		if err != nil {
+			problems = append(problems, cacheIntegrityProblem{path: manifestPath, reason: err.Error()})
+			continue
+		}
+
+		for name, sums := range m.Cases {
+			for _, f := range []struct{ ext, sum string }{{".in", sums.In}, {".out", sums.Out}} {
+				path := filepath.Join(cacheDir, name+f.ext)
+				reason, broken := checkCaseFile(path, f.sum, full)
+				if reason != "" {
+					problems = append(problems, cacheIntegrityProblem{path: path, reason: reason, broken: broken})
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(problems, func(a, b cacheIntegrityProblem) int {
+		return strings.Compare(a.path, b.path)
+	})
+	return problems, nil
+}
+
+// checkCaseFile は path が sum の blob と一致しているかを調べ、一致していなければ理由と壊れているファイルを返す
+func checkCaseFile(path, sum string, full bool) (string, []string) {
+	if len(sum) != sha256.Size*2 || strings.ContainsFunc(sum, func(r rune) bool { return !strings.ContainsRune("0123456789abcdef", r) }) {
+		return fmt.Sprintf("malformed checksum %q in manifest", sum), []string{path}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "file is missing", nil
+	}
+	blobInfo, err := os.Stat(blobPath(sum))
+	if err != nil {
+		return "blob is missing", []string{path}
+	}
+
+	if !full && os.SameFile(info, blobInfo) {
+		return "", nil
+	}
+
+	// blob が壊れていればそれにリンクしているケースも壊れている
+	for _, broken := range [][]string{{blobPath(sum), path}, {path}} {
+		actual, err := sha256File(broken[0])
+		if err != nil {
+			return err.Error(), nil
+		}
+		if actual != sum {
+			return fmt.Sprintf("checksum mismatch in %s (got %s, manifest says %s)", broken[0], actual, sum), broken
+		}
+	}
+
+	return "", nil
+}
+
+// gcGracePeriod より新しい blob は、並行して動いているダウンロードがまだ manifest に記録していないだけかもしれないので消さない
+const gcGracePeriod = 10 * time.Minute
+
+// gcResult は cache gc で消したもの
+type gcResult struct {
+	removedBlobs     int
+	reclaimedBytes   int64
+	compactedEntries int
+}
+
+// collectGarbage はどの manifest からも参照されていない blob を消す。
+// 先に、ファイルが消されたケースを manifest から取り除く。dryRun が true なら何も消さずに消すものだけを数える
+func collectGarbage(dryRun bool) (*gcResult, error) {
+	problemDirs, err := problemCacheDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &gcResult{}
+	referenced := make(map[string]bool)
+	for _, problemDir := range problemDirs {
+		manifestPath := filepath.Join(problemDir, "manifest.json")
+		if !existsFileOrDir(manifestPath) {
+			continue
+		}
+		cacheDir := filepath.Join(problemDir, "test")
+		m, err := loadCaseManifest(cacheDir)
+		if err != nil {
+			// 参照が分からないまま blob を消すと壊れるので止める
+			return nil, fmt.Errorf("%s: %w", manifestPath, err)
+		}
+
+		compacted := false
+		for name, sums := range m.Cases {
+			if !isTestcaseCached(cacheDir, name) {
+				delete(m.Cases, name)
+				result.compactedEntries++
+				compacted = true
+				continue
+			}
+			referenced[sums.In] = true
+			referenced[sums.Out] = true
+		}
+
+		if compacted && !dryRun {
+			err := m.save(cacheDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = filepath.WalkDir(blobsDirPath(), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || referenced[d.Name()] {
+			return nil
+		}
+
+		// 参照されていない blob と、途中で止まったときに残った一時ファイル
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) < gcGracePeriod {
+			return nil
+		}
+		if !dryRun {
+			err := os.Remove(path)
+			if err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+		result.removedBlobs++
+		result.reclaimedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
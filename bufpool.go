@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// copyBufferSize は比較やコピーで使い回すバッファの大きさ
+const copyBufferSize = 64 << 10
+
+// maxPooledBufferSize より大きくなった bytes.Buffer はプールに戻さない。
+// 巨大な応答を一度読んだだけで、その大きさのメモリを持ち続けないようにする
+const maxPooledBufferSize = 4 << 20
+
+// copyBufferPool は copyBufferSize のバッファを使い回す。
+// -jobs で並列にケースを実行したりダウンロードしたりしても、その度にバッファを確保しないようにする
+var copyBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// bytesBufferPool は API の応答の本文などを読む bytes.Buffer を使い回す
+var bytesBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// bufioReaderPool はトークンごとの比較で使う bufio.Reader を使い回す
+var bufioReaderPool = sync.Pool{
+	New: func() any {
+		return bufio.NewReaderSize(nil, copyBufferSize)
+	},
+}
+
+func getBytesBuffer() *bytes.Buffer {
+	b := bytesBufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func putBytesBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+	bytesBufferPool.Put(b)
+}
+
+func getBufioReader(r io.Reader) *bufio.Reader {
+	br := bufioReaderPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+func putBufioReader(br *bufio.Reader) {
+	// 読み終わった後も r を掴んだままにしない
+	br.Reset(nil)
+	bufioReaderPool.Put(br)
+}
+
+// pooledCopy は copyBufferPool のバッファを使って src を dst にコピーする。
+// io.Copy は *os.File の WriteTo や ReadFrom を経由すると、呼ぶたびに 32KiB のバッファを確保する
+func pooledCopy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+
+	// WriteTo と ReadFrom を隠して、必ず buf を使わせる
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// buildSolution は verification file の言語に合わせて解答をビルドし、解答を実行するコマンドを返す。
+// コンパイルする言語なら binaryFilepath に出力する。ソースの {{NAME}} はビルドの前に vars の値で展開する
+func buildSolution(buildFilenames []string, binaryFilepath string, tags []string, vars map[string]string) ([]string, error) {
+	lang := lookupLanguage(buildFilenames[0])
+	if lang != goLanguage && len(tags) > 0 {
+		slog.Warn("build tags are ignored for non-go files", slog.String("file", buildFilenames[0]), slog.String("language", lang.Name), slog.Any("tags", tags))
+	}
+
+	// 元のソースは書き換えず、展開したものを binaryFilepath の隣に置いてビルドに使う
+	expanded, err := expandSources(buildFilenames, vars, filepath.Dir(binaryFilepath))
+	if err != nil {
+		return nil, err
+	}
+	if len(expanded) > 0 {
+		slog.Debug("expanded template placeholders", slog.Any("sources", expanded))
+	}
+
+	switch {
+	case lang.HasTemplates():
+		return buildWithTemplates(lang, buildFilenames, binaryFilepath, expanded)
+	case lang == cppLanguage:
+		err = buildCppSolution(buildFilenames, binaryFilepath, expanded)
+	default:
+		err = buildGoSolution(buildFilenames, binaryFilepath, tags, expanded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{binaryFilepath}, nil
+}
+
+// solutionLanguage は languageFactors などで使う verification file の言語の名前を返す
+func solutionLanguage(filename string) string {
+	return lookupLanguage(filename).Name
+}
+
+// buildGoSolution は Go のソースファイルを tags 付きでビルドして binaryFilepath に出力する。
+// buildFilenames の先頭は verification file で、残りは SOURCES で指定されたファイル。
+// expanded にあるソースはパッケージの解決が変わらないように、go build -overlay で展開したものに差し替える
+func buildGoSolution(buildFilenames []string, binaryFilepath string, tags []string, expanded map[string]string) error {
+	// go build に渡すファイルは同じディレクトリに無ければならない
+	for _, f := range buildFilenames[1:] {
+		if filepath.Dir(filepath.Clean(f)) != filepath.Dir(filepath.Clean(buildFilenames[0])) {
+			errMsg := fmt.Sprintf("SOURCES must be in the same directory as %s for go build: %s", buildFilenames[0], f)
+			return errors.New(errMsg)
+		}
+	}
+
+	cgoEnabled := isCgoAvailable()
+
+	ctx := build.Default
+	ctx.BuildTags = tags
+	ctx.CgoEnabled = cgoEnabled
+
+	for _, buildFilename := range buildFilenames {
+		usesCgo, err := importsC(buildFilename)
+		if err != nil {
+			return fmt.Errorf("failed to parse go file: %w", err)
+		}
+
+		if usesCgo && !cgoEnabled {
+			errMsg := fmt.Sprintf(`%s imports "C" but cgo is unavailable (CGO_ENABLED=0 or no C compiler found)`, buildFilename)
+			return errors.New(errMsg)
+		}
+
+		dir, name := filepath.Split(buildFilename)
+		match, err := ctx.MatchFile(dir, name)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate build constraints: %w", err)
+		}
+		if !match {
+			errMsg := message(msgBuildConstraintsExclude, buildFilename, tags)
+			return errors.New(errMsg)
+		}
+	}
+
+	args, err := goBuildArgs(buildFilenames, binaryFilepath, tags)
+	if err != nil {
+		return err
+	}
+	if len(expanded) > 0 {
+		overlay, err := writeGoOverlay(expanded, filepath.Dir(binaryFilepath))
+		if err != nil {
+			return err
+		}
+		args = slices.Insert(args, 1, "-overlay", overlay)
+	}
+
+	var buildCmdStdErr bytes.Buffer
+	buildCmd := exec.Command("go", args...)
+	buildCmd.Stderr = &buildCmdStdErr
+	if goToolchain != "" {
+		// -matrix で指定されたバージョンのツールチェインでビルドする
+		buildCmd.Env = append(os.Environ(), "GOTOOLCHAIN="+goToolchain)
+	}
+
+	err = buildCmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to build go file: %w\n%s", err, buildCmdStdErr.String())
+	}
+
+	return nil
+}
+
+// goBuildArgs は go build に渡す引数を組み立てる
+func goBuildArgs(buildFilenames []string, binaryFilepath string, tags []string) ([]string, error) {
+	args := []string{"build", "-o", binaryFilepath}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	// 空白などを含む相対パスでも解釈がぶれないように絶対パスで渡す
+	for _, buildFilename := range buildFilenames {
+		absBuildFilename, err := filepath.Abs(buildFilename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve source path: %w", err)
+		}
+		args = append(args, absBuildFilename)
+	}
+
+	return args, nil
+}
+
+func importsC(filename string) (bool, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ImportsOnly)
+	if err != nil {
+		return false, err
+	}
+
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return false, err
+		}
+		if path == "C" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isCgoAvailable は go env の CGO_ENABLED と C コンパイラの有無から cgo が使えるかを判定する
+func isCgoAvailable() bool {
+	out, err := exec.Command("go", "env", "CGO_ENABLED", "CC").Output()
+	if err != nil {
+		return false
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != "1" {
+		return false
+	}
+
+	cc := strings.Fields(lines[1])
+	if len(cc) == 0 {
+		return false
+	}
+
+	_, err = exec.LookPath(cc[0])
+	return err == nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/matumoto1234/aoj-verify/language"
+)
+
+func buildCacheDirPath() string {
+	return filepath.Join(workDir, "build")
+}
+
+// buildSolutionCached は buildSolution と同じく解答をビルドするが、Go と C++ のバイナリは buildCacheKey ごとにキャッシュする。
+// テストケースやフラグだけを変えて verify し直すときに、重いヘッダを含む C++ などをコンパイルし直さなくて済むようにする
+func buildSolutionCached(buildFilenames []string, binaryFilepath string, tags []string, vars map[string]string) ([]string, error) {
+	lang := lookupLanguage(buildFilenames[0])
+	if lang != goLanguage && lang != cppLanguage {
+		// テンプレートで定義された言語は、実行に何を使うかが分からないのでキャッシュしない
+		return buildSolution(buildFilenames, binaryFilepath, tags, vars)
+	}
+
+	key, err := buildCacheKey(buildFilenames, tags, vars)
+	if err != nil {
+		slog.Debug("build cache is not used", slog.Any("error", err))
+		return buildSolution(buildFilenames, binaryFilepath, tags, vars)
+	}
+
+	cachedPath, err := filepath.Abs(filepath.Join(buildCacheDirPath(), key, filepath.Base(binaryFilepath)))
+	if err != nil {
+		return nil, err
+	}
+	if existsFileOrDir(cachedPath) {
+		slog.Debug("build cache hit", slog.String("file", buildFilenames[0]), slog.String("key", key))
+		markCacheUsed(filepath.Dir(cachedPath))
+		return []string{cachedPath}, nil
+	}
+
+	runArgs, err := buildSolution(buildFilenames, binaryFilepath, tags, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// ビルドし終えたバイナリを移すので、途中で止まっても壊れたバイナリはキャッシュに残らない
+	err = os.MkdirAll(filepath.Dir(cachedPath), 0755)
+	if err == nil {
+		err = os.Rename(binaryFilepath, cachedPath)
+	}
+	if err != nil {
+		slog.Warn("failed to cache the built binary", slog.Any("error", err))
+		return runArgs, nil
+	}
+
+	return []string{cachedPath}, nil
+}
+
+// buildCacheKey はビルドしたバイナリが同じになる条件から決まるキーを返す。
+// verification file とリポジトリ内の依存しているファイルの中身 (sourceHash)、go.mod と go.sum、
+// ビルドタグ、テンプレートの値、Go のツールチェインと C++ のコンパイラ (toolchainID)、OS と CPU アーキテクチャを含める
+func buildCacheKey(buildFilenames []string, tags []string, vars map[string]string) (string, error) {
+	hash, err := sourceHash(buildFilenames)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash sources: %w", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", hash)
+
+	if lookupLanguage(buildFilenames[0]) == goLanguage {
+		if modDir, ok := findGoModDir(filepath.Dir(buildFilenames[0])); ok {
+			for _, name := range []string{"go.mod", "go.sum"} {
+				body, err := os.ReadFile(filepath.Join(modDir, name))
+				if err != nil && !os.IsNotExist(err) {
+					return "", err
+				}
+				fmt.Fprintf(h, "%s\x00%d\x00", name, len(body))
+				h.Write(body)
+			}
+		}
+		fmt.Fprintf(h, "tags=%s\x00toolchain=%s\x00", strings.Join(tags, ","), goToolchain)
+	} else {
+		fmt.Fprintf(h, "compiler=%s\x00", strings.Join(cppCompiler, " "))
+	}
+
+	id, err := toolchainID(lookupLanguage(buildFilenames[0]))
+	if err != nil {
+		return "", fmt.Errorf("failed to identify the toolchain: %w", err)
+	}
+	fmt.Fprintf(h, "%s\x00", id)
+
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		fmt.Fprintf(h, "var %s=%s\x00", name, vars[name])
+	}
+	fmt.Fprintf(h, "%s/%s", runtime.GOOS, runtime.GOARCH)
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// cppBuildEnv は C++ のビルドに影響する環境変数。g++ はヘッダやライブラリを探すパスをこれらからも読む
+var cppBuildEnv = []string{"CXXFLAGS", "CPATH", "CPLUS_INCLUDE_PATH", "LIBRARY_PATH"}
+
+// toolchainIDs は toolchainID の結果。ビルドのたびに go env やコンパイラを実行しないように覚えておく
+var (
+	toolchainIDsMu sync.Mutex
+	toolchainIDs   = make(map[string]string)
+)
+
+// toolchainID は lang の解答をビルドするツールチェインとその設定を表す文字列を返す。
+// Go は go env のバージョンと GOFLAGS などの値、C++ はコンパイラの --version の出力とビルドに影響する環境変数を使う。
+// ツールチェインを更新したり設定を変えたりしたら、古いバイナリをキャッシュから使わないようにする
+func toolchainID(lang *language.Language) (string, error) {
+	var cmd *exec.Cmd
+	var env []string
+	if lang == goLanguage {
+		cmd = exec.Command("go", "env", "GOVERSION", "GOFLAGS", "CGO_ENABLED", "CC", "GOOS", "GOARCH")
+		if goToolchain != "" {
+			// ビルドと同じツールチェインに聞く
+			cmd.Env = append(os.Environ(), "GOTOOLCHAIN="+goToolchain)
+		}
+	} else {
+		cmd = exec.Command(cppCompiler[0], "--version")
+		for _, name := range cppBuildEnv {
+			env = append(env, name+"="+os.Getenv(name))
+		}
+	}
+
+	memoKey := strings.Join(cmd.Args, " ") + "\x00" + strings.Join(cmd.Env, "\x00")
+	toolchainIDsMu.Lock()
+	defer toolchainIDsMu.Unlock()
+	if id, ok := toolchainIDs[memoKey]; ok {
+		return id, nil
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", strings.Join(cmd.Args, " "), err)
+	}
+	id := string(out) + strings.Join(env, "\x00")
+	toolchainIDs[memoKey] = id
+	return id, nil
+}
+
+// findGoModDir は dir から親をたどって go.mod のあるディレクトリを探す
+func findGoModDir(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		if existsFileOrDir(filepath.Join(dir, "go.mod")) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
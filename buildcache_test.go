@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestBuildCacheKey(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not available")
+	}
+	t.Chdir(t.TempDir())
+
+	write := func(name, body string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := func(tags ...string) string {
+		t.Helper()
+		k, err := buildCacheKey([]string{"main.go"}, tags, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	write("go.mod", "module key\n\ngo 1.24\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	base := key()
+
+	if got := key(); got != base {
+		t.Errorf("key changed without any change: %s, %s", base, got)
+	}
+	if got := key("aoj"); got == base {
+		t.Error("key did not change with build tags")
+	}
+
+	// ツールチェインを更新したときと同じように go env の結果を差し替える
+	toolchainIDsMu.Lock()
+	for k, id := range toolchainIDs {
+		toolchainIDs[k] = id + "upgraded"
+	}
+	toolchainIDsMu.Unlock()
+	if got := key(); got == base {
+		t.Error("key did not change with the toolchain")
+	}
+	upgraded := key()
+
+	write("go.mod", "module key\n\ngo 1.24\n\nrequire example.com/x v1.0.0\n")
+	if got := key(); got == upgraded {
+		t.Error("key did not change with go.mod")
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// runBundle は verification file が使っている標準ライブラリ以外のパッケージを埋め込んで、AOJ に提出できる 1 つのファイルにする
+func runBundle(args []string) error {
+	fset := flag.NewFlagSet("bundle", flag.ExitOnError)
+	tags := fset.String("tags", "", "comma-separated list of build tags passed to go build")
+	output := fset.String("o", "", "write the bundled source to this file instead of stdout")
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	if fset.NArg() != 1 {
+		return errors.New("usage: aoj-verify bundle [-tags tags] [-o file] <file>")
+	}
+	filename := fset.Arg(0)
+	if filepath.Ext(filename) != ".go" {
+		errMsg := fmt.Sprintf("only go files can be bundled: %s", filename)
+		return errors.New(errMsg)
+	}
+
+	annotation, err := readAnnotationInFile(filename)
+	if err != nil {
+		return err
+	}
+
+	buildTags := append(splitList(*tags), annotation.BuildTags...)
+	src, err := bundleGoSources(annotation.sourceFiles(filename), buildTags)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	err = os.WriteFile(*output, src, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	slog.Info("bundle written", slog.String("path", *output), slog.Int("bytes", len(src)))
+	return nil
+}
+
+// listedPackage は `go list -json` が出力するパッケージのうち、埋め込みに使うもの
+type listedPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	Standard   bool
+	GoFiles    []string
+	CgoFiles   []string
+	SFiles     []string
+}
+
+// listDependencies は buildFilenames が依存しているパッケージを、依存される側が先になる順で返す。
+// 最後の要素は buildFilenames 自身のパッケージ (command-line-arguments)
+func listDependencies(buildFilenames []string, tags []string) ([]*listedPackage, error) {
+	args := []string{"list", "-deps", "-json"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	args = append(args, buildFilenames...)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dependencies of %s: %w\n%s", buildFilenames[0], err, stderr.String())
+	}
+
+	var pkgs []*listedPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg listedPackage
+		err := dec.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode go list output: %w", err)
+		}
+		pkgs = append(pkgs, &pkg)
+	}
+	return pkgs, nil
+}
+
+// bundledFile は 1 つにまとめるソースファイルと、その中の書き換え
+type bundledFile struct {
+	src   []byte
+	file  *ast.File
+	edits []sourceEdit
+}
+
+// sourceEdit は src[start:end] を text に置き換える
+type sourceEdit struct {
+	start, end int
+	text       string
+}
+
+// bundleGoSources は buildFilenames と、それが使っている標準ライブラリ以外のパッケージを 1 つのソースにまとめる。
+// 埋め込むパッケージのトップレベルの名前には "パッケージ名_" を付けて、main や他のパッケージとぶつからないようにする。
+// cgo やアセンブリを使うパッケージは埋め込めない
+func bundleGoSources(buildFilenames []string, tags []string) ([]byte, error) {
+	pkgs, err := listDependencies(buildFilenames, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	names := make(map[string]string)
+	// prefixes は埋め込むパッケージの import パス → トップレベルの名前に付ける接頭辞
+	prefixes := make(map[string]string)
+	usedPrefixes := make(map[string]bool)
+	var inlined []*listedPackage
+	for _, pkg := range pkgs {
+		names[pkg.ImportPath] = pkg.Name
+		if pkg.Standard || pkg.ImportPath == "command-line-arguments" {
+			continue
+		}
+		if len(pkg.CgoFiles) > 0 || len(pkg.SFiles) > 0 {
+			errMsg := fmt.Sprintf("cannot bundle %s: it is not pure Go (uses cgo or assembly)", pkg.ImportPath)
+			return nil, errors.New(errMsg)
+		}
+
+		prefix := pkg.Name + "_"
+		for i := 2; usedPrefixes[prefix]; i++ {
+			prefix = pkg.Name + strconv.Itoa(i) + "_"
+		}
+		usedPrefixes[prefix] = true
+		prefixes[pkg.ImportPath] = prefix
+		inlined = append(inlined, pkg)
+	}
+
+	// 埋め込むパッケージのファイルは、トップレベルの名前に接頭辞を付ける
+	var bundled [][]*bundledFile
+	for _, pkg := range inlined {
+		var files []*bundledFile
+		for _, name := range pkg.GoFiles {
+			f, err := parseBundledFile(fset, filepath.Join(pkg.Dir, name))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+		renameTopLevel(fset, files, prefixes[pkg.ImportPath])
+		bundled = append(bundled, files)
+	}
+
+	var mains []*bundledFile
+	for _, name := range buildFilenames {
+		f, err := parseBundledFile(fset, name)
+		if err != nil {
+			return nil, err
+		}
+		mains = append(mains, f)
+	}
+
+	// 埋め込んだパッケージへの参照 (pkg.Name) を接頭辞付きの名前にし、残りの import を 1 つにまとめる
+	imports := make(map[string]bundledImport)
+	for _, f := range append(slices.Concat(bundled...), mains...) {
+		err := rewriteBundledImports(fset, f, names, prefixes, imports)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	main := mains[0]
+	buf.Write(main.src[:fset.Position(main.file.Package).Offset])
+	fmt.Fprintf(&buf, "package %s\n\n", main.file.Name.Name)
+	writeImportBlock(&buf, imports)
+
+	// 依存される側の init が先に実行されるように、埋め込むパッケージを main より前に置く
+	for i, files := range bundled {
+		fmt.Fprintf(&buf, "\n// %s\n", inlined[i].ImportPath)
+		for _, f := range files {
+			buf.WriteString(f.body(importDeclsEnd(fset, f.file)))
+		}
+	}
+	for _, f := range mains {
+		buf.WriteString("\n")
+		buf.WriteString(f.body(importDeclsEnd(fset, f.file)))
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format bundle: %w", err)
+	}
+	return src, nil
+}
+
+func parseBundledFile(fset *token.FileSet, filename string) (*bundledFile, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go file: %w", err)
+	}
+	return &bundledFile{src: src, file: f}, nil
+}
+
+// importDeclsEnd は f の import 宣言が終わる位置を返す。import が無ければ package 句の終わり
+func importDeclsEnd(fset *token.FileSet, f *ast.File) int {
+	end := f.Name.End()
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			end = gen.End()
+		}
+	}
+	return fset.Position(end).Offset
+}
+
+// body は from より後ろのソースに書き換えを適用して返す
+func (f *bundledFile) body(from int) string {
+	edits := slices.Clone(f.edits)
+	slices.SortFunc(edits, func(a, b sourceEdit) int { return a.start - b.start })
+
+	var b strings.Builder
+	pos := from
+	for _, e := range edits {
+		if e.start < from {
+			continue
+		}
+		b.Write(f.src[pos:e.start])
+		b.WriteString(e.text)
+		pos = e.end
+	}
+	b.Write(f.src[pos:])
+	return b.String()
+}
+
+func (f *bundledFile) replace(fset *token.FileSet, node ast.Node, text string) {
+	f.edits = append(f.edits, sourceEdit{
+		start: fset.Position(node.Pos()).Offset,
+		end:   fset.Position(node.End()).Offset,
+		text:  text,
+	})
+}
+
+// renameTopLevel は 1 つのパッケージの files で宣言されたトップレベルの名前と、その参照に prefix を付ける。
+// 型検査はせず、パーサーの名前解決で参照を見分ける。composite literal のキーは、型が配列やマップと分かるときだけ式として扱う
+func renameTopLevel(fset *token.FileSet, files []*bundledFile, prefix string) {
+	topLevel := make(map[string]bool)
+	decls := make(map[any]bool)
+	for _, f := range files {
+		for _, decl := range f.file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.Name != "init" {
+					topLevel[decl.Name.Name] = true
+					decls[decl] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						topLevel[spec.Name.Name] = true
+						decls[spec] = true
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if name.Name != "_" {
+								topLevel[name.Name] = true
+							}
+						}
+						decls[spec] = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, f := range files {
+		unresolved := make(map[*ast.Ident]bool)
+		for _, ident := range f.file.Unresolved {
+			unresolved[ident] = true
+		}
+
+		// 構造体のフィールド名かもしれないキーは書き換えない。配列やマップのキーは式なので、別のファイルの名前も書き換える
+		keys := make(map[*ast.Ident]bool)
+		ast.Inspect(f.file, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			_, isArray := lit.Type.(*ast.ArrayType)
+			_, isMap := lit.Type.(*ast.MapType)
+			for _, elt := range lit.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						keys[key] = isArray || isMap
+					}
+				}
+			}
+			return true
+		})
+
+		ast.Inspect(f.file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok || !topLevel[ident.Name] {
+				return true
+			}
+			// 別のファイルで宣言された名前は解決されずに残り、同じファイルの名前は宣言に解決される
+			resolvesToTopLevel := unresolved[ident] || (ident.Obj != nil && decls[ident.Obj.Decl])
+			if expr, isKey := keys[ident]; isKey {
+				resolvesToTopLevel = expr && (ident.Obj == nil || decls[ident.Obj.Decl])
+			}
+			if resolvesToTopLevel {
+				f.replace(fset, ident, prefix+ident.Name)
+			}
+			return true
+		})
+	}
+}
+
+// bundledImport はまとめたソースに残す import
+type bundledImport struct {
+	// alias は import で付けられた名前。付いていなければ空文字
+	alias string
+	path  string
+}
+
+// rewriteBundledImports は f から埋め込むパッケージの import を取り除いて、その参照を接頭辞付きの名前にする。
+// 残りの import は imports (ローカル名 → import) に集める
+func rewriteBundledImports(fset *token.FileSet, f *bundledFile, names map[string]string, prefixes map[string]string, imports map[string]bundledImport) error {
+	filename := fset.Position(f.file.Package).Filename
+
+	// locals は埋め込むパッケージを参照するローカル名 → 接頭辞
+	locals := make(map[string]string)
+	for _, spec := range f.file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+		local := names[path]
+		if spec.Name != nil {
+			local = spec.Name.Name
+		}
+
+		prefix, ok := prefixes[path]
+		if !ok {
+			key := local
+			if local == "_" {
+				key = "_ " + path
+			}
+			if other, ok := imports[key]; ok {
+				if other.path != path {
+					errMsg := fmt.Sprintf("%s: %s refers to both %q and %q in the bundle", filename, local, other.path, path)
+					return errors.New(errMsg)
+				}
+				continue
+			}
+			imp := bundledImport{path: path}
+			if spec.Name != nil {
+				imp.alias = spec.Name.Name
+			}
+			imports[key] = imp
+			continue
+		}
+		switch local {
+		case ".":
+			errMsg := fmt.Sprintf("%s: cannot bundle the dot import of %q", filename, path)
+			return errors.New(errMsg)
+		case "_":
+			// 埋め込めば init も実行されるので、import は要らない
+		default:
+			locals[local] = prefix
+		}
+	}
+	if len(locals) == 0 {
+		return nil
+	}
+
+	unresolved := make(map[*ast.Ident]bool)
+	for _, ident := range f.file.Unresolved {
+		unresolved[ident] = true
+	}
+	ast.Inspect(f.file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || !unresolved[x] {
+			return true
+		}
+		if prefix, ok := locals[x.Name]; ok {
+			f.replace(fset, sel, prefix+sel.Sel.Name)
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+// writeImportBlock は imports を import パスの順に並べた import 宣言を書き出す
+func writeImportBlock(w io.Writer, imports map[string]bundledImport) {
+	if len(imports) == 0 {
+		return
+	}
+
+	lines := slices.Collect(maps.Values(imports))
+	slices.SortFunc(lines, func(a, b bundledImport) int {
+		return cmp.Or(strings.Compare(a.path, b.path), strings.Compare(a.alias, b.alias))
+	})
+
+	fmt.Fprintln(w, "import (")
+	for _, l := range lines {
+		if l.alias != "" {
+			fmt.Fprintf(w, "\t%s %q\n", l.alias, l.path)
+		} else {
+			fmt.Fprintf(w, "\t%q\n", l.path)
+		}
+	}
+	fmt.Fprintln(w, ")")
+}
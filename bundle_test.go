@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleGoSources(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not available")
+	}
+	t.Chdir(t.TempDir())
+
+	write := func(name, body string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("go.mod", "module example.com/lib\n\ngo 1.24\n")
+	write("util/util.go", `package util
+
+import "cmp"
+
+func Max[T cmp.Ordered](a, b T) T { return max(a, b) }
+`)
+	// 名前は別のファイルで宣言されていても書き換え、フィールド名やメソッド名はそのまま残す
+	write("stack/stack.go", `package stack
+
+import "example.com/lib/util"
+
+type Stack[T any] struct{ items []T }
+
+func New[T any]() *Stack[T] { return &Stack[T]{} }
+
+func (s *Stack[T]) Push(v T) { s.items = append(s.items, v); count++ }
+
+func (s *Stack[T]) Len() int { return util.Max(len(s.items), 0) }
+
+type Point struct{ X, Y int }
+
+func Origin() Point { return Point{X: zero, Y: zero} }
+`)
+	write("stack/count.go", `package stack
+
+var count int
+
+const zero = 0
+
+var names = map[int]string{zero: "zero"}
+
+func Count() int { return count + len(names) }
+`)
+	write("stack/stack_test.go", "package stack\n\nfunc Ignored() {}\n")
+	write("main.go", `// verification-helper: PROBLEM https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A
+package main
+
+import (
+	"fmt"
+
+	st "example.com/lib/stack"
+)
+
+func Count() int { return 42 }
+
+func main() {
+	s := st.New[int]()
+	s.Push(1)
+	fmt.Println(s.Len(), st.Count(), Count(), st.Origin().X)
+}
+`)
+
+	got, err := bundleGoSources([]string{"main.go"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `// verification-helper: PROBLEM https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A
+package main
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// example.com/lib/util
+
+func util_Max[T cmp.Ordered](a, b T) T { return max(a, b) }
+
+// example.com/lib/stack
+
+var stack_count int
+
+const stack_zero = 0
+
+var stack_names = map[int]string{stack_zero: "zero"}
+
+func stack_Count() int { return stack_count + len(stack_names) }
+
+type stack_Stack[T any] struct{ items []T }
+
+func stack_New[T any]() *stack_Stack[T] { return &stack_Stack[T]{} }
+
+func (s *stack_Stack[T]) Push(v T) { s.items = append(s.items, v); stack_count++ }
+
+func (s *stack_Stack[T]) Len() int { return util_Max(len(s.items), 0) }
+
+type stack_Point struct{ X, Y int }
+
+func stack_Origin() stack_Point { return stack_Point{X: stack_zero, Y: stack_zero} }
+
+func Count() int { return 42 }
+
+func main() {
+	s := stack_New[int]()
+	s.Push(1)
+	fmt.Println(s.Len(), stack_Count(), Count(), stack_Origin().X)
+}
+`
+	if string(got) != want {
+		t.Errorf("bundleGoSources() =\n%s\nwant\n%s", got, want)
+	}
+
+	// まとめたソースは単体でビルドできる
+	write("out/main.go", string(got))
+	out, err := exec.Command("go", "build", "-o", os.DevNull, "./out").CombinedOutput()
+	if err != nil {
+		t.Errorf("failed to build the bundle: %v\n%s", err, out)
+	}
+}
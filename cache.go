@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// constructCacheDirPath は problemURL の問題のテストケースを置くディレクトリ (e.g. cache/aoj/ALDS1_14_A/test) を返す
+func constructCacheDirPath(problemURL string) string {
+	return filepath.Join(problemCacheDirPath(problemURL), "test")
+}
+
+func isTestcaseCached(dir, testcaseName string) bool {
+	name := filepath.Join(dir, sanitizeFilename(testcaseName))
+	return existsFileOrDir(name+".in") && existsFileOrDir(name+".out")
+}
+
+// sanitizeFilename はジャッジから受け取った名前をそのままファイル名に使えるように、
+// パス区切りや制御文字などを '_' に置き換える
+func sanitizeFilename(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|':
+			return '_'
+		case unicode.IsControl(r):
+			return '_'
+		default:
+			return r
+		}
+	}, strings.TrimSpace(name))
+
+	if sanitized == "" || sanitized == "." || sanitized == ".." {
+		return "_"
+	}
+
+	// 長すぎる名前は多くのファイルシステムで作れないので切り詰める。
+	// 先頭が同じ別の名前と同じファイルにならないように、元の名前のハッシュを付ける
+	const maxLen = 200
+	if len(sanitized) > maxLen {
+		sum := sha256.Sum256([]byte(sanitized))
+		suffix := "-" + hex.EncodeToString(sum[:4])
+		sanitized = strings.ToValidUTF8(sanitized[:maxLen-len(suffix)], "") + suffix
+	}
+
+	return sanitized
+}
+
+func existsFileOrDir(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// constructHeaderCachePath は testcase の header レスポンスをキャッシュするファイルのパスを返す
+func constructHeaderCachePath(problemURL string) string {
+	return filepath.Join(filepath.Dir(constructCacheDirPath(problemURL)), "header.json")
+}
+
+// loadCachedTestcasesHeader はキャッシュされた header を返す。キャッシュが無いか ttl を過ぎていれば false を返す
+func loadCachedTestcasesHeader(path string, ttl time.Duration) (*testcasesHeaderResponse, bool) {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	header := &testcasesHeaderResponse{}
+	err = json.Unmarshal(body, header)
+	if err != nil {
+		return nil, false
+	}
+
+	// 壊れたキャッシュは使わずに取得し直す
+	if header.validate(header.ProblemID) != nil {
+		return nil, false
+	}
+
+	return header, true
+}
+
+func saveTestcasesHeaderCache(path string, header *testcasesHeaderResponse) error {
+	body, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to marshal header: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	err = os.WriteFile(path, body, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write header cache: %w", err)
+	}
+
+	return nil
+}
+
+// problemMetadata は一覧表示などに使う問題の情報
+type problemMetadata struct {
+	ProblemID string `json:"problemId"`
+	Title     string `json:"title"`
+	Category  string `json:"category"`
+	// TimeLimit は秒単位、MemoryLimit は KB 単位。yukicoder のように 1 秒未満の端数がある制限時間もある
+	TimeLimit   float64 `json:"timeLimit"`
+	MemoryLimit int     `json:"memoryLimit"`
+}
+
+// timeLimit はジャッジの制限時間を返す。分からなければ 0 を返す
+func (m *problemMetadata) timeLimit() time.Duration {
+	return time.Duration(m.TimeLimit * float64(time.Second))
+}
+
+func constructProblemMetadataCachePath(problemURL string) string {
+	return filepath.Join(filepath.Dir(constructCacheDirPath(problemURL)), "problem.json")
+}
+
+// loadProblemMetadata はキャッシュされた問題情報を返す。無ければ judgeapi から取得してキャッシュする
+func loadProblemMetadata(problemURL string) (*problemMetadata, error) {
+	path := constructProblemMetadataCachePath(problemURL)
+
+	body, err := os.ReadFile(path)
+	if err == nil {
+		metadata := &problemMetadata{}
+		if err := json.Unmarshal(body, metadata); err == nil {
+			return metadata, nil
+		}
+	}
+
+	problemID, err := extractProblemID(problemURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u, err := url.Parse(problemURL); err == nil && u.Host == libraryCheckerHost {
+		// Library Checker の問題情報はテストケースを生成するときに info.toml から作る
+		errMsg := fmt.Sprintf("metadata of %s is available after its testcases are generated", problemID)
+		return nil, errors.New(errMsg)
+	}
+
+	var metadata *problemMetadata
+	if u, err := url.Parse(problemURL); err == nil && u.Host == yukicoderHost {
+		problem, err := fetchYukicoderProblem(context.Background(), problemID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch problem: %w", err)
+		}
+		metadata = &problemMetadata{
+			ProblemID: problemID,
+			Title:     problem.Title,
+			Category:  "yukicoder",
+			TimeLimit: problem.TimeLimit,
+		}
+	} else {
+		problem, err := fetchProblem(context.Background(), problemID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch problem: %w", err)
+		}
+		metadata = &problemMetadata{
+			ProblemID:   problemID,
+			Title:       problem.Name,
+			Category:    problemCategory(problemID),
+			TimeLimit:   float64(problem.ProblemTimeLimit),
+			MemoryLimit: problem.ProblemMemoryLimit,
+		}
+	}
+
+	body, err = json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal problem metadata: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	err = os.WriteFile(path, body, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write problem metadata cache: %w", err)
+	}
+
+	return metadata, nil
+}
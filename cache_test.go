@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "01_sample_00", want: "01_sample_00"},
+		{name: "slash", in: "a/b", want: "a_b"},
+		{name: "backslash", in: `a\b`, want: "a_b"},
+		{name: "parent dir", in: "../../etc/passwd", want: ".._.._etc_passwd"},
+		{name: "windows reserved", in: `a:b*c?d"e<f>g|h`, want: "a_b_c_d_e_f_g_h"},
+		{name: "control characters", in: "a\x00b\tc\nd\x7f", want: "a_b_c_d_"},
+		{name: "leading and trailing spaces", in: "  case 1  ", want: "case 1"},
+		{name: "inner spaces", in: "case 1 large", want: "case 1 large"},
+		{name: "unicode", in: "ケース1", want: "ケース1"},
+		{name: "empty", in: "", want: "_"},
+		{name: "only spaces", in: "   ", want: "_"},
+		{name: "dot", in: ".", want: "_"},
+		{name: "dot dot", in: "..", want: "_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeFilename(tt.in)
+			if got != tt.want {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameTruncation(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{name: "ascii", in: strings.Repeat("a", 300)},
+		// 3 バイトの文字なので、どこで切っても文字の途中になりうる
+		{name: "multi-byte", in: strings.Repeat("あ", 100)},
+		{name: "multi-byte after ascii", in: "x" + strings.Repeat("あ", 100)},
+		{name: "four-byte runes", in: strings.Repeat("🍣", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeFilename(tt.in)
+			if len(got) > 200 {
+				t.Errorf("len(sanitizeFilename(...)) = %d, want <= 200", len(got))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sanitizeFilename(...) = %q, want valid UTF-8", got)
+			}
+			if sanitizeFilename(tt.in) != got {
+				t.Errorf("sanitizeFilename is not deterministic for %q", tt.in)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameLongNamesDoNotCollide(t *testing.T) {
+	prefix := strings.Repeat("a", 250)
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "differ after the limit", a: prefix + "1", b: prefix + "2"},
+		{name: "differ after multi-byte prefix", a: strings.Repeat("あ", 80) + "x", b: strings.Repeat("あ", 80) + "y"},
+		// 切り詰めた後の長さがちょうど上限の名前と、それより長い名前
+		{name: "limit and longer", a: strings.Repeat("a", 200), b: strings.Repeat("a", 201)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := sanitizeFilename(tt.a), sanitizeFilename(tt.b)
+			if a == b {
+				t.Errorf("sanitizeFilename gives the same name %q for different inputs", a)
+			}
+		})
+	}
+}
+
+func TestIsTestcaseCached(t *testing.T) {
+	tests := []struct {
+		name     string
+		testcase string
+		files    []string
+		want     bool
+	}{
+		{name: "both", testcase: "1", files: []string{"1.in", "1.out"}, want: true},
+		{name: "in only", testcase: "1", files: []string{"1.in"}, want: false},
+		{name: "out only", testcase: "1", files: []string{"1.out"}, want: false},
+		{name: "none", testcase: "1", want: false},
+		{name: "other case", testcase: "1", files: []string{"2.in", "2.out"}, want: false},
+		{name: "spaces and unicode", testcase: " ケース 1 ", files: []string{"ケース 1.in", "ケース 1.out"}, want: true},
+		{name: "separator", testcase: "sub/1", files: []string{"sub_1.in", "sub_1.out"}, want: true},
+		{name: "long name", testcase: strings.Repeat("a", 300), files: []string{sanitizeFilename(strings.Repeat("a", 300)) + ".in", sanitizeFilename(strings.Repeat("a", 300)) + ".out"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				err := os.WriteFile(filepath.Join(dir, f), nil, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := isTestcaseCached(dir, tt.testcase)
+			if got != tt.want {
+				t.Errorf("isTestcaseCached(%q) = %v, want %v", tt.testcase, got, tt.want)
+			}
+		})
+	}
+}
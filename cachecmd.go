@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runCache は cache 以下のサブコマンドを実行する
+func runCache(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: aoj-verify cache <audit|check|gc|install-hook> [flags]")
+	}
+
+	switch args[0] {
+	case "audit":
+		return runCacheAudit(args[1:])
+	case "check":
+		return runCacheCheck(args[1:])
+	case "gc":
+		return runCacheGC(args[1:])
+	case "install-hook":
+		return runCacheInstallHook(args[1:])
+	default:
+		errMsg := fmt.Sprintf("unknown cache subcommand: %s", args[0])
+		return errors.New(errMsg)
+	}
+}
+
+// runCacheAudit は AOJ のテストケースが git の管理下に置かれていないかを調べる。
+// テストケースは再配布してはいけないので、見つかったら失敗する
+func runCacheAudit(args []string) error {
+	fset := flag.NewFlagSet("cache audit", flag.ExitOnError)
+	staged := fset.Bool("staged", false, "audit only files staged for commit (used by the pre-commit hook)")
+	fset.Parse(args)
+
+	gitArgs := []string{"ls-files", "-z"}
+	if *staged {
+		gitArgs = []string{"diff", "--cached", "--name-only", "--diff-filter=ACMR", "-z"}
+	}
+	out, err := exec.Command("git", gitArgs...).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list git files: %w", err)
+	}
+
+	cachedSums, err := cachedTestcaseChecksums()
+	if err != nil {
+		return fmt.Errorf("failed to hash cached testcases: %w", err)
+	}
+
+	var found []string
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+
+		if isUnderCacheDir(path) {
+			found = append(found, path+" (inside the cache dir)")
+			continue
+		}
+
+		if !mayBeTestcaseFile(path) {
+			continue
+		}
+		sum, err := sha256File(path)
+		if err != nil {
+			// 削除されたファイルなど
+			continue
+		}
+		if cached, ok := cachedSums[sum]; ok {
+			found = append(found, fmt.Sprintf("%s (same content as %s)", path, cached))
+		}
+	}
+
+	if len(found) > 0 {
+		errMsg := message(msgTrackedTestcases, len(found), strings.Join(found, "\n  "))
+		return errors.New(errMsg)
+	}
+
+	fmt.Fprintln(os.Stdout, message(msgNoTrackedTestcases))
+	return nil
+}
+
+// runCacheCheck はキャッシュされたテストケースが manifest に記録された blob と一致しているかを調べる
+func runCacheCheck(args []string) error {
+	fset := flag.NewFlagSet("cache check", flag.ExitOnError)
+	full := fset.Bool("full", false, "rehash every file instead of trusting hard links to the blobs")
+	fix := fset.Bool("fix", false, "remove broken files so that the next download fetches them again")
+	fset.Parse(args)
+
+	err := migrateCache()
+	if err != nil {
+		return err
+	}
+
+	problems, err := checkCacheIntegrity(*full)
+	if err != nil {
+		return fmt.Errorf("failed to check cache: %w", err)
+	}
+
+	if len(problems) > 0 && *fix {
+		removed := 0
+		for _, p := range problems {
+			for _, path := range p.broken {
+				err := os.Remove(path)
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("failed to remove %s: %w", path, err)
+				}
+				slog.Info("removed", slog.String("path", path))
+				removed++
+			}
+		}
+		fmt.Fprintln(os.Stdout, message(msgCacheFixed, removed))
+		return nil
+	}
+
+	if len(problems) > 0 {
+		lines := make([]string, 0, len(problems))
+		for _, p := range problems {
+			lines = append(lines, p.String())
+		}
+		errMsg := message(msgCacheMismatch, len(problems), strings.Join(lines, "\n  "))
+		return errors.New(errMsg)
+	}
+
+	fmt.Fprintln(os.Stdout, message(msgCacheIntact))
+	return nil
+}
+
+// runCacheGC はどのケースからも参照されていない blob を消し、消したケースを manifest から取り除く
+func runCacheGC(args []string) error {
+	fset := flag.NewFlagSet("cache gc", flag.ExitOnError)
+	dryRun := fset.Bool("dry-run", false, "report what would be removed without removing anything")
+	fset.Parse(args)
+
+	err := migrateCache()
+	if err != nil {
+		return err
+	}
+
+	result, err := collectGarbage(*dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to collect garbage: %w", err)
+	}
+
+	id := msgGCRemoved
+	if *dryRun {
+		id = msgGCWouldRemove
+	}
+	fmt.Fprintln(os.Stdout, message(id, result.removedBlobs, formatBytes(result.reclaimedBytes), result.compactedEntries))
+	return nil
+}
+
+func isUnderCacheDir(path string) bool {
+	dir := filepath.ToSlash(workDir) + "/"
+	return strings.HasPrefix(filepath.ToSlash(path), dir) || strings.Contains(filepath.ToSlash(path), "/"+dir)
+}
+
+// mayBeTestcaseFile はテストケースをコピーしたものでありえそうなファイルかどうかを返す
+func mayBeTestcaseFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".in", ".out", ".txt", "":
+		return true
+	default:
+		return false
+	}
+}
+
+// cachedTestcaseChecksums はキャッシュにある全テストケースの sha256 → パスを返す
+func cachedTestcaseChecksums() (map[string]string, error) {
+	sums := make(map[string]string)
+
+	err := filepath.WalkDir(cacheRootPath(), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".in" && ext != ".out" {
+			return nil
+		}
+
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		sums[sum] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sums, nil
+}
+
+const preCommitHook = `#!/bin/sh
+# generated by aoj-verify: block committing AOJ testcases
+exec aoj-verify cache audit -staged
+`
+
+// runCacheInstallHook はテストケースのコミットを防ぐ pre-commit hook を書き出す
+func runCacheInstallHook(args []string) error {
+	fset := flag.NewFlagSet("cache install-hook", flag.ExitOnError)
+	force := fset.Bool("force", false, "overwrite an existing pre-commit hook")
+	fset.Parse(args)
+
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return fmt.Errorf("failed to find git hooks dir: %w", err)
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	hookPath := filepath.Join(hooksDir, "pre-commit")
+
+	if existsFileOrDir(hookPath) && !*force {
+		errMsg := message(msgHookExists, hookPath)
+		return errors.New(errMsg)
+	}
+
+	err = os.MkdirAll(hooksDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	err = os.WriteFile(hookPath, []byte(preCommitHook), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write pre-commit hook: %w", err)
+	}
+
+	fmt.Fprintln(os.Stdout, message(msgHookInstalled, hookPath))
+	return nil
+}
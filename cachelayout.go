@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// problemIndex は問題の URL から、その問題のキャッシュを置くディレクトリ (cacheRoot からの相対パス) への対応。
+// ディレクトリは cache/<judge>/<problem ID> なので、名前を変えた結果が同じになる別の問題を区別するために記録する
+type problemIndex struct {
+	Problems map[string]string `json:"problems"`
+}
+
+// problemIndexMu は problemIndex の読み書きと、読み込んだ index を守る
+var problemIndexMu sync.Mutex
+
+// loadedProblemIndex は problemIndexPath から読み込んだ index。キャッシュのパスを組み立てるたびに読み直さないように持っておく。
+// loadedProblemIndexPath はその絶対パスで、キャッシュの場所が変わったら読み直す
+var (
+	loadedProblemIndex     *problemIndex
+	loadedProblemIndexPath string
+)
+
+func problemIndexPath() string {
+	return filepath.Join(cacheRootPath(), "problems.json")
+}
+
+func loadProblemIndex() (*problemIndex, error) {
+	index := &problemIndex{Problems: make(map[string]string)}
+
+	body, err := os.ReadFile(problemIndexPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read problem index: %w", err)
+	}
+
+	err = json.Unmarshal(body, index)
+	if err != nil {
+		return nil, fmt.Errorf("malformed problem index: %w", err)
+	}
+	if index.Problems == nil {
+		index.Problems = make(map[string]string)
+	}
+	return index, nil
+}
+
+// cachedProblemIndex は読み込んである index を返す。まだ読んでいなければ読み込む。problemIndexMu を取ってから呼ぶ
+func cachedProblemIndex() (*problemIndex, error) {
+	path, err := filepath.Abs(problemIndexPath())
+	if err != nil {
+		return nil, err
+	}
+	if loadedProblemIndex != nil && loadedProblemIndexPath == path {
+		return loadedProblemIndex, nil
+	}
+
+	index, err := loadProblemIndex()
+	if err != nil {
+		return nil, err
+	}
+	loadedProblemIndex, loadedProblemIndexPath = index, path
+	return index, nil
+}
+
+func (x *problemIndex) save() error {
+	body, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal problem index: %w", err)
+	}
+
+	return writeFileWithDir(problemIndexPath(), append(body, '\n'))
+}
+
+// judgeCacheName はキャッシュのディレクトリ名に使うジャッジの名前を返す
+func judgeCacheName(host string) string {
+	switch host {
+	case "judge.u-aizu.ac.jp", "onlinejudge.u-aizu.ac.jp":
+		return "aoj"
+	case yukicoderHost:
+		return "yukicoder"
+	case libraryCheckerHost:
+		return "library-checker"
+	default:
+		return sanitizeFilename(host)
+	}
+}
+
+// problemCacheKey は problemURL の問題のキャッシュのディレクトリの、区別する前の名前を返す (e.g. aoj/ALDS1_14_A)。
+// 同じ問題を指す URL (AOJ の新旧の URL など) は同じ名前になる
+func problemCacheKey(problemURL string) string {
+	u, err := url.Parse(problemURL)
+	if err != nil {
+		return filepath.Join("other", legacyCacheDirName(problemURL))
+	}
+
+	problemID, err := extractProblemID(problemURL)
+	if err != nil || problemID == "" {
+		return filepath.Join(judgeCacheName(u.Host), legacyCacheDirName(problemURL))
+	}
+	return filepath.Join(judgeCacheName(u.Host), sanitizeFilename(problemID))
+}
+
+// legacyCacheDirName は以前のレイアウトで使っていた、URL の md5 のディレクトリ名を返す
+func legacyCacheDirName(problemURL string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(problemURL)))
+}
+
+// problemCacheDirName は problemURL の問題のキャッシュを置くディレクトリの、cacheRoot からの相対パスを返す。
+// index に無ければ problemCacheKey を使い、別の問題がもう使っていれば -2, -3, ... を付けて区別する
+func (x *problemIndex) problemCacheDirName(problemURL string) string {
+	if dir, ok := x.Problems[problemURL]; ok {
+		return dir
+	}
+
+	key := problemCacheKey(problemURL)
+	dir := key
+	for i := 2; x.usedByOtherProblem(dir, key); i++ {
+		dir = fmt.Sprintf("%s-%d", key, i)
+	}
+	return dir
+}
+
+// usedByOtherProblem は dir が key とは別の問題のキャッシュに使われているかを返す
+func (x *problemIndex) usedByOtherProblem(dir, key string) bool {
+	for u, d := range x.Problems {
+		if d == dir && problemCacheKey(u) != key {
+			return true
+		}
+	}
+	return false
+}
+
+// problemCacheDirPath は problemURL の問題のキャッシュを置くディレクトリを返す。
+// まだ registerProblemCacheDir していなければ、登録したときに使われるディレクトリを返す。
+// ただし以前のレイアウトのディレクトリしか無ければ、移すまではそちらを返す
+func problemCacheDirPath(problemURL string) string {
+	problemIndexMu.Lock()
+	defer problemIndexMu.Unlock()
+
+	index, err := cachedProblemIndex()
+	if err != nil {
+		slog.Warn("failed to load problem index; ignoring it", slog.Any("error", err))
+		index = &problemIndex{Problems: make(map[string]string)}
+	}
+
+	path := filepath.Join(cacheRootPath(), index.problemCacheDirName(problemURL))
+	if _, ok := index.Problems[problemURL]; !ok && !existsFileOrDir(path) {
+		legacy := filepath.Join(cacheRootPath(), legacyCacheDirName(problemURL))
+		if existsFileOrDir(legacy) {
+			return legacy
+		}
+	}
+	return path
+}
+
+// registerProblemCacheDir は problemURL の問題のキャッシュのディレクトリを index に記録する。
+// 以前のレイアウトの md5 のディレクトリがあれば、ダウンロードし直さなくて済むように新しい場所に移す
+func registerProblemCacheDir(problemURL string) error {
+	// 対応していない URL を index に残さない
+	_, err := extractProblemID(problemURL)
+	if err != nil {
+		return err
+	}
+
+	problemIndexMu.Lock()
+	defer problemIndexMu.Unlock()
+
+	index, err := cachedProblemIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index.Problems[problemURL]; ok {
+		return nil
+	}
+
+	// 他の aoj-verify が後から登録したものを消さないように、書き込む前に読み直す
+	index, err = loadProblemIndex()
+	if err != nil {
+		return err
+	}
+	loadedProblemIndex = index
+	if _, ok := index.Problems[problemURL]; ok {
+		return nil
+	}
+
+	dir := index.problemCacheDirName(problemURL)
+	path := filepath.Join(cacheRootPath(), dir)
+	legacy := filepath.Join(cacheRootPath(), legacyCacheDirName(problemURL))
+	if existsFileOrDir(legacy) && !existsFileOrDir(path) {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return fmt.Errorf("failed to mkdir: %w", err)
+		}
+		err = os.Rename(legacy, path)
+		if err != nil {
+			return fmt.Errorf("failed to move cache of %s: %w", problemURL, err)
+		}
+		slog.Info("moved cache to the new layout", slog.String("from", legacy), slog.String("to", path))
+	}
+
+	index.Problems[problemURL] = dir
+	return index.save()
+}
+
+// problemCacheDirs はキャッシュにある全ての問題のディレクトリを返す。
+// 以前のレイアウトの cache/<md5> のままのディレクトリも含む
+func problemCacheDirs() ([]string, error) {
+	var dirs []string
+	for _, pattern := range []string{
+		filepath.Join(cacheRootPath(), "*", "test"),
+		filepath.Join(cacheRootPath(), "*", "*", "test"),
+	} {
+		testDirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, testDir := range testDirs {
+			dirs = append(dirs, filepath.Dir(testDir))
+		}
+	}
+
+	slices.Sort(dirs)
+	return dirs, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProblemCacheDirPath(t *testing.T) {
+	const aojURL = "https://onlinejudge.u-aizu.ac.jp/courses/lesson/2/ITP1/1/ITP1_1_B"
+	const legacyURL = "https://judge.u-aizu.ac.jp/onlinejudge/description.jsp?id=ITP1_1_B"
+
+	tests := []struct {
+		name string
+		// legacy が true なら以前のレイアウトの md5 のディレクトリを用意しておく
+		legacy     bool
+		register   bool
+		wantBefore string
+		wantAfter  string
+	}{
+		{name: "new problem", register: true, wantBefore: "aoj/ITP1_1_B", wantAfter: "aoj/ITP1_1_B"},
+		{name: "not moved yet", legacy: true, wantBefore: legacyCacheDirName(aojURL), wantAfter: legacyCacheDirName(aojURL)},
+		{name: "moved on register", legacy: true, register: true, wantBefore: legacyCacheDirName(aojURL), wantAfter: "aoj/ITP1_1_B"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			if tt.legacy {
+				err := os.MkdirAll(filepath.Join(cacheRootPath(), legacyCacheDirName(aojURL), "test"), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := problemCacheDirPath(aojURL); got != filepath.Join(cacheRootPath(), tt.wantBefore) {
+				t.Errorf("before register: %s, want %s", got, tt.wantBefore)
+			}
+			if tt.register {
+				if err := registerProblemCacheDir(aojURL); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := problemCacheDirPath(aojURL); got != filepath.Join(cacheRootPath(), tt.wantAfter) {
+				t.Errorf("after register: %s, want %s", got, tt.wantAfter)
+			}
+			if tt.legacy && tt.register && existsFileOrDir(filepath.Join(cacheRootPath(), legacyCacheDirName(aojURL))) {
+				t.Error("legacy directory was not moved")
+			}
+
+			// 同じ問題の古い URL は同じディレクトリを使う
+			if tt.register {
+				if err := registerProblemCacheDir(legacyURL); err != nil {
+					t.Fatal(err)
+				}
+				if got := problemCacheDirPath(legacyURL); got != filepath.Join(cacheRootPath(), tt.wantAfter) {
+					t.Errorf("old URL: %s, want %s", got, tt.wantAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestProblemIndexIsLoadedOnce(t *testing.T) {
+	const problemURL = "https://onlinejudge.u-aizu.ac.jp/courses/lesson/2/ITP1/1/ITP1_1_B"
+	t.Chdir(t.TempDir())
+
+	err := registerProblemCacheDir(problemURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := constructCacheDirPath(problemURL)
+
+	// 読み込んだ後はファイルを読み直さないので、書き換えられても同じパスを返す
+	err = os.WriteFile(problemIndexPath(), []byte(`{"problems":{"`+problemURL+`":"aoj/elsewhere"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := constructCacheDirPath(problemURL); got != want {
+		t.Errorf("constructCacheDirPath = %s, want %s", got, want)
+	}
+
+	// 別のキャッシュの場所では、その index を読む
+	t.Chdir(t.TempDir())
+	if got := problemCacheDirPath(problemURL); got != filepath.Join(cacheRootPath(), "aoj", "ITP1_1_B") {
+		t.Errorf("problemCacheDirPath in another cache = %s", got)
+	}
+	if _, ok := loadedProblemIndex.Problems[problemURL]; ok {
+		t.Error("index of the previous cache is still used")
+	}
+}
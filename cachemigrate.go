@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cacheVersion は今のキャッシュのレイアウトのバージョン。レイアウトを変えるときは上げて cacheMigrations に移行を足す
+const cacheVersion = 3
+
+// cacheMigration はキャッシュのレイアウトを from から from+1 に移行する
+type cacheMigration struct {
+	from        int
+	description string
+	migrate     func(cacheRoot string) error
+}
+
+// cacheMigrations は from の昇順に並べる
+var cacheMigrations = []cacheMigration{
+	{
+		from:        0,
+		description: "stamp unversioned cache",
+		// バージョンを記録する前のキャッシュは version 1 と同じレイアウト
+		migrate: func(string) error { return nil },
+	},
+	{
+		from:        1,
+		description: "move testcases into content-addressed blobs",
+		migrate:     migrateToBlobs,
+	},
+	{
+		from:        2,
+		description: "name problem directories by judge and problem ID",
+		// md5 のディレクトリ名からは URL が分からないので、問題ごとに次に使うときに registerProblemCacheDir で移す
+		migrate: func(string) error { return nil },
+	},
+}
+
+// cacheDirEnv はテストケースのキャッシュを置くディレクトリを指定する環境変数
+const cacheDirEnv = "AOJ_VERIFY_CACHE_DIR"
+
+// cacheRoot はテストケースのキャッシュを置くディレクトリ。空なら workDir の下に置く
+var cacheRoot string
+
+func cacheRootPath() string {
+	if cacheRoot != "" {
+		return cacheRoot
+	}
+	return filepath.Join(workDir, "cache")
+}
+
+// resolveCacheRoot はテストケースのキャッシュを置くディレクトリを、-cache-dir、cacheDirEnv、設定ファイルの cacheDir の順に決める。
+// どれも無ければ、同じ問題をリポジトリやディレクトリごとにダウンロードし直さないように、
+// ユーザーのキャッシュディレクトリ ($XDG_CACHE_HOME/aoj-verify など) に置く
+func resolveCacheRoot(flagValue string) string {
+	switch {
+	case flagValue != "":
+		return filepath.Clean(flagValue)
+	case os.Getenv(cacheDirEnv) != "":
+		return filepath.Clean(os.Getenv(cacheDirEnv))
+	case projectCfg.CacheDir != "":
+		// 設定ファイルで workDir を決めているなら、これまで通りその下に置く
+		return ""
+	}
+
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		slog.Debug("no user cache directory; caching testcases in the working directory", slog.Any("error", err))
+		return ""
+	}
+	root := filepath.Join(userCacheDir, "aoj-verify")
+
+	// 以前の既定の場所にあるキャッシュは使われなくなるので、消してよいことを知らせる
+	legacy := filepath.Join(workDir, "cache")
+	if existsFileOrDir(legacy) && !existsFileOrDir(root) {
+		slog.Info("testcases are now cached per user; the old per-directory cache can be removed", slog.String("cache", root), slog.String("old cache", legacy))
+	}
+
+	return root
+}
+
+func cacheVersionFilePath(cacheRoot string) string {
+	return filepath.Join(cacheRoot, "VERSION")
+}
+
+// readCacheVersion はキャッシュのバージョンを返す。バージョンが記録されていなければ 0 を返す
+func readCacheVersion(cacheRoot string) (int, error) {
+	body, err := os.ReadFile(cacheVersionFilePath(cacheRoot))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache version: %w", err)
+	}
+
+	v, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("malformed cache version file: %w", err)
+	}
+	return v, nil
+}
+
+func writeCacheVersion(cacheRoot string, v int) error {
+	err := os.WriteFile(cacheVersionFilePath(cacheRoot), []byte(strconv.Itoa(v)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write cache version: %w", err)
+	}
+	return nil
+}
+
+// migrateCache はキャッシュを cacheVersion のレイアウトに移行する。
+// 移行は 1 段ずつ行い、終わるたびにバージョンを記録するので、途中で失敗しても次回はその続きから行う
+func migrateCache() error {
+	cacheRoot := cacheRootPath()
+	if !existsFileOrDir(cacheRoot) {
+		err := os.MkdirAll(cacheRoot, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to mkdir: %w", err)
+		}
+		return writeCacheVersion(cacheRoot, cacheVersion)
+	}
+
+	v, err := readCacheVersion(cacheRoot)
+	if err != nil {
+		return err
+	}
+	if v > cacheVersion {
+		errMsg := message(msgCacheTooNew, cacheRoot, v, cacheVersion)
+		return errors.New(errMsg)
+	}
+
+	for _, m := range cacheMigrations {
+		if m.from != v {
+			continue
+		}
+
+		slog.Info("migrating cache", slog.Int("from", m.from), slog.Int("to", m.from+1), slog.String("migration", m.description))
+		err := m.migrate(cacheRoot)
+		if err != nil {
+			return fmt.Errorf("failed to migrate cache from version %d: %w", m.from, err)
+		}
+
+		v = m.from + 1
+		err = writeCacheVersion(cacheRoot, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	if v != cacheVersion {
+		errMsg := fmt.Sprintf("no cache migration from version %d", v)
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+// migrateToBlobs は問題ごとのディレクトリに直接置かれていたケースを blob に移し、manifest を作る
+func migrateToBlobs(cacheRoot string) error {
+	cacheDirs, err := filepath.Glob(filepath.Join(cacheRoot, "*", "test"))
+	if err != nil {
+		return err
+	}
+
+	for _, cacheDir := range cacheDirs {
+		inFilepaths, err := aojCaseSchema.listInputs(cacheDir)
+		if err != nil {
+			return err
+		}
+
+		for _, inFilepath := range inFilepaths {
+			files := aojCaseSchema.files(inFilepath)
+			if !existsFileOrDir(files.output) {
+				// 出力の無いケースは中途半端にダウンロードされたものなので、次のダウンロードに任せる
+				continue
+			}
+
+			err := saveTestcaseFiles(cacheDir, filepath.Base(files.name), files.input, files.output)
+			if err != nil {
+				return fmt.Errorf("failed to migrate %s: %w", files.name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/matumoto1234/aoj-verify/stopwatch"
+)
+
+// runCaseCommand は verification file をビルドして、キャッシュ済みの 1 ケースか標準入力を与えて実行し、出力をそのまま表示する。
+// `go run main.go < .aoj-verify/cache/aoj/ITP1_1_A/test/in3.in` を手で打たなくて済むようにする
+func runCaseCommand(args []string) error {
+	fset := flag.NewFlagSet("case", flag.ExitOnError)
+	tags := fset.String("tags", "", "comma-separated list of build tags passed to go build")
+	stdinFromTTY := fset.Bool("stdin-from-tty", false, "read the input from stdin (e.g. typed on the terminal) instead of a cached case")
+	echoIO := fset.Bool("echo-io", false, "show the input fed to the solution (<<) and its output (>>) line by line on stdout")
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	if fset.NArg() != 2 && !(fset.NArg() == 1 && *stdinFromTTY) {
+		return errors.New("usage: aoj-verify case [flags] <file> <case> | aoj-verify case -stdin-from-tty [flags] <file>")
+	}
+	filename := fset.Arg(0)
+
+	annotation, err := readAnnotationInFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if !*stdinFromTTY {
+		files, err := findCachedCase(annotation.ProblemURL, fset.Arg(1))
+		if err != nil {
+			return err
+		}
+
+		inFile, err := os.Open(files.input)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %w", err)
+		}
+		defer inFile.Close()
+		input = inFile
+	} else if isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, message(msgReadingFromTerminal))
+	}
+
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		return &infraError{err: fmt.Errorf("failed to mkdir: %w", err)}
+	}
+
+	tmpDir, err := os.MkdirTemp(workDir, "tmp")
+	if err != nil {
+		return &infraError{err: fmt.Errorf("failed to temporally directory: %w", err)}
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binaryFilepath, err := filepath.Abs(filepath.Join(tmpDir, "main"))
+	if err != nil {
+		return fmt.Errorf("failed to resolve binary path: %w", err)
+	}
+	if runtime.GOOS == "windows" {
+		binaryFilepath += ".exe"
+	}
+
+	buildTags := append(splitList(*tags), annotation.BuildTags...)
+	runArgs, err := buildSolution(annotation.sourceFiles(filename), binaryFilepath, buildTags, templateVars(annotation))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	runCmd := exec.CommandContext(ctx, runArgs[0], runArgs[1:]...)
+	runCmd.Stdin = input
+	runCmd.Stdout = os.Stdout
+	runCmd.Stderr = os.Stderr
+	if *echoIO {
+		term := newEchoTerminal(os.Stdout)
+		defer term.close()
+		// 端末で打った入力はもう画面にあるので、出力にだけ印を付ける。
+		// 入力はパイプに書いた時点で表示するので、解答が読み進めた位置とは限らない
+		if !(*stdinFromTTY && isTerminal(os.Stdin)) {
+			runCmd.Stdin = io.TeeReader(input, term.stream("<< "))
+		}
+		runCmd.Stdout = term.stream(">> ")
+	}
+
+	var stopwatch stopwatch.Stopwatch
+	stopwatch.Start()
+
+	err = runCmd.Run()
+	if runCmd.ProcessState != nil {
+		slog.Info("finished", slog.Duration("time", stopwatch.Elapsed()), slog.Int("exit code", runCmd.ProcessState.ExitCode()))
+	}
+	if err != nil {
+		return fmt.Errorf("solution failed: %w", err)
+	}
+
+	return nil
+}
+
+// findCachedCase は problemURL のキャッシュから name という名前のケースを探す。"in3" と "in3.in" のどちらでも指定できる
+func findCachedCase(problemURL, name string) (*testcaseFiles, error) {
+	cacheDir := constructCacheDirPath(problemURL)
+	schema := caseSchemaForURL(problemURL)
+
+	inFilepaths, err := schema.listCachedInputs(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk dir: %w", err)
+	}
+
+	name = strings.TrimSuffix(name, schema.inputExt)
+	var names []string
+	for _, inFilepath := range inFilepaths {
+		base := filepath.Base(schema.caseName(inFilepath))
+		if base == name {
+			return schema.files(inFilepath), nil
+		}
+		names = append(names, base)
+	}
+
+	if len(names) == 0 {
+		errMsg := message(msgNoCachedTestcases, problemURL)
+		return nil, errors.New(errMsg)
+	}
+
+	errMsg := message(msgNoSuchCase, name, strings.Join(names, ", "))
+	return nil, errors.New(errMsg)
+}
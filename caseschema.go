@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// caseSchema はジャッジごとの、1 ケースを構成するファイルの決まり
+type caseSchema struct {
+	name      string
+	inputExt  string
+	outputExt string
+	// auxiliaryExts はケースに付随するその他のファイルの拡張子 (e.g. .constraints)。無いケースもある
+	auxiliaryExts []string
+}
+
+var (
+	// aojCaseSchema は AOJ の <name>.in, <name>.out
+	aojCaseSchema = &caseSchema{name: "aoj", inputExt: ".in", outputExt: ".out"}
+	// icpcCaseSchema は ICPC 形式の problem package の <name>.in, <name>.ans と付随するファイル
+	icpcCaseSchema = &caseSchema{name: "icpc", inputExt: ".in", outputExt: ".ans", auxiliaryExts: []string{".constraints", ".hint", ".desc", ".timelimit"}}
+)
+
+// testcaseFiles は 1 ケースを構成するファイルのパス
+type testcaseFiles struct {
+	// name は拡張子を除いたパス
+	name   string
+	input  string
+	output string
+	// auxiliary は拡張子から付随するファイルのパスへの対応。存在するものだけを持つ
+	auxiliary map[string]string
+}
+
+// caseName は inFilepath から拡張子を除いたパスを返す
+func (s *caseSchema) caseName(inFilepath string) string {
+	return strings.TrimSuffix(inFilepath, s.inputExt)
+}
+
+// files は inFilepath と同じケースを構成するファイルを返す
+func (s *caseSchema) files(inFilepath string) *testcaseFiles {
+	name := s.caseName(inFilepath)
+	files := &testcaseFiles{
+		name:   name,
+		input:  inFilepath,
+		output: name + s.outputExt,
+	}
+
+	for _, ext := range s.auxiliaryExts {
+		if existsFileOrDir(name + ext) {
+			if files.auxiliary == nil {
+				files.auxiliary = make(map[string]string)
+			}
+			files.auxiliary[ext] = name + ext
+		}
+	}
+
+	return files
+}
+
+// listInputs は dir 以下の入力ファイルのパスを名前順で返す
+func (s *caseSchema) listInputs(dir string) ([]string, error) {
+	var inFilepaths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, s.inputExt) {
+			inFilepaths = append(inFilepaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(inFilepaths)
+	return inFilepaths, nil
+}
+
+// listCachedInputs はキャッシュの cacheDir にある入力ファイルのパスを名前順で返す。
+// AOJ 形式でケースが manifest に記録されていれば、ディレクトリを走査せずに manifest から求める。
+// manifest には保存したケースだけが記録され、ディスクから消えたケースはダウンロードのときに取り直される
+func (s *caseSchema) listCachedInputs(cacheDir string) ([]string, error) {
+	if s != aojCaseSchema {
+		return s.listInputs(cacheDir)
+	}
+
+	m, err := loadCaseManifest(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Cases) == 0 {
+		// blob に移行する前のキャッシュや、manifest を作らない取得元
+		return s.listInputs(cacheDir)
+	}
+
+	inFilepaths := make([]string, 0, len(m.Cases))
+	for name := range m.Cases {
+		inFilepaths = append(inFilepaths, filepath.Join(cacheDir, name+s.inputExt))
+	}
+	slices.Sort(inFilepaths)
+	return inFilepaths, nil
+}
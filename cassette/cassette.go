@@ -0,0 +1,160 @@
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Mode int
+
+const (
+	// Record は実際にリクエストを送り、そのやりとりを Dir に保存する
+	Record Mode = iota
+	// Replay は Dir に保存されたやりとりだけを返し、ネットワークには一切アクセスしない
+	Replay
+)
+
+// ErrNotRecorded は Replay 中に記録されていないリクエストが来たことを表す
+var ErrNotRecorded = errors.New("request is not recorded in the cassette")
+
+// Transport は HTTP のやりとりを記録・再生する http.RoundTripper
+type Transport struct {
+	Mode Mode
+	Dir  string
+	// Base は Record のときに実際にリクエストを送る RoundTripper。nil なら http.DefaultTransport を使う
+	Base http.RoundTripper
+}
+
+// sensitiveHeaders は記録するときに取り除くヘッダ。フィクスチャはリポジトリにコミットするので、セッションや認証の情報を残さない
+var sensitiveHeaders = []string{"Set-Cookie", "Set-Cookie2", "Cookie", "Authorization", "Proxy-Authorization"}
+
+type interaction struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// ParseSpec は "record:dir" または "replay:dir" 形式の指定から Transport を作る
+func ParseSpec(spec string) (*Transport, error) {
+	mode, dir, ok := strings.Cut(spec, ":")
+	if !ok || dir == "" {
+		return nil, fmt.Errorf("invalid cassette spec %q. must be record:dir or replay:dir", spec)
+	}
+
+	switch mode {
+	case "record":
+		return &Transport{Mode: Record, Dir: dir}, nil
+	case "replay":
+		return &Transport{Mode: Replay, Dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %q. must be record or replay", mode)
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := t.fixturePath(req)
+
+	if t.Mode == Replay {
+		return t.replay(req, path)
+	}
+	return t.record(req, path)
+}
+
+// fixturePath はリクエストのメソッドと URL から保存先のファイル名を決める
+func (t *Transport) fixturePath(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	name := req.URL.Hostname() + "-" + hex.EncodeToString(sum[:8]) + ".json"
+	return filepath.Join(t.Dir, name)
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	body, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var it interaction
+	err = json.Unmarshal(body, &it)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cassette %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", it.StatusCode, http.StatusText(it.StatusCode)),
+		StatusCode:    it.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        it.Header,
+		Body:          io.NopCloser(strings.NewReader(it.Body)),
+		ContentLength: int64(len(it.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, path string) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	it := interaction{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     redactHeader(resp.Header),
+		Body:       string(body),
+	}
+
+	fixture, err := json.MarshalIndent(it, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(t.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, fixture, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// redactHeader は h から sensitiveHeaders を取り除いた複製を返す。呼び出し元に返す応答のヘッダはそのままにする
+func redactHeader(h http.Header) http.Header {
+	redacted := h.Clone()
+	for _, name := range sensitiveHeaders {
+		redacted.Del(name)
+	}
+	return redacted
+}
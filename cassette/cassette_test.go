@@ -0,0 +1,157 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeServer は登録した応答だけを返す http.RoundTripper
+type fakeServer map[string]*http.Response
+
+func (f fakeServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, ok := f[req.URL.String()]
+	if !ok {
+		return nil, errors.New("unexpected request: " + req.URL.String())
+	}
+	return resp, nil
+}
+
+func newResponse(status int, header http.Header, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func get(t *testing.T, rt http.RoundTripper, url string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+	}{
+		{name: "ok", url: "https://judgedat.u-aizu.ac.jp/testcases/ITP1_1_B/header", status: http.StatusOK, body: `{"problemId":"ITP1_1_B","headers":[]}`},
+		{name: "not found", url: "https://judgedat.u-aizu.ac.jp/testcases/NO_SUCH/header", status: http.StatusNotFound, body: `[{"id":1,"code":"NOT_FOUND","message":"not found"}]`},
+		{name: "empty body", url: "https://judgeapi.u-aizu.ac.jp/problems/ITP1_1_B?x=1", status: http.StatusNoContent, body: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			server := fakeServer{tt.url: newResponse(tt.status, http.Header{"Content-Type": {"application/json"}}, tt.body)}
+
+			resp, body := get(t, &Transport{Mode: Record, Dir: dir, Base: server}, tt.url)
+			if resp.StatusCode != tt.status || body != tt.body {
+				t.Fatalf("record returned %d %q, want %d %q", resp.StatusCode, body, tt.status, tt.body)
+			}
+
+			resp, body = get(t, &Transport{Mode: Replay, Dir: dir}, tt.url)
+			if resp.StatusCode != tt.status || body != tt.body {
+				t.Errorf("replay returned %d %q, want %d %q", resp.StatusCode, body, tt.status, tt.body)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("replayed Content-Type = %q, want application/json", got)
+			}
+		})
+	}
+}
+
+func TestRecordRedactsSensitiveHeaders(t *testing.T) {
+	const url = "https://yukicoder.me/api/v1/problems/no/1"
+	header := http.Header{
+		"Content-Type":        {"application/json"},
+		"Set-Cookie":          {"session=secret-session"},
+		"Authorization":       {"Bearer secret-token"},
+		"Proxy-Authorization": {"Basic secret-proxy"},
+	}
+	dir := t.TempDir()
+	server := fakeServer{url: newResponse(http.StatusOK, header, "{}")}
+
+	resp, _ := get(t, &Transport{Mode: Record, Dir: dir, Base: server}, url)
+	// 呼び出し元には受け取ったヘッダをそのまま返す
+	if resp.Header.Get("Set-Cookie") == "" {
+		t.Error("recorded response lost Set-Cookie for the caller")
+	}
+
+	fixtures, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(fixtures) != 1 {
+		t.Fatalf("want 1 fixture, got %v (err %v)", fixtures, err)
+	}
+	fixture, err := os.ReadFile(fixtures[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-session", "secret-token", "secret-proxy"} {
+		if strings.Contains(string(fixture), secret) {
+			t.Errorf("fixture contains %q:\n%s", secret, fixture)
+		}
+	}
+	if !strings.Contains(string(fixture), "application/json") {
+		t.Errorf("fixture lost Content-Type:\n%s", fixture)
+	}
+}
+
+func TestReplayNotRecorded(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://judgedat.u-aizu.ac.jp/testcases/ITP1_1_B/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&Transport{Mode: Replay, Dir: t.TempDir()}).RoundTrip(req)
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("RoundTrip error = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		mode    Mode
+		dir     string
+		wantErr bool
+	}{
+		{spec: "record:testdata", mode: Record, dir: "testdata"},
+		{spec: "replay:a/b", mode: Replay, dir: "a/b"},
+		{spec: "replay:", wantErr: true},
+		{spec: "replay", wantErr: true},
+		{spec: "play:dir", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && (got.Mode != tt.mode || got.Dir != tt.dir) {
+				t.Errorf("ParseSpec(%q) = {%v %q}, want {%v %q}", tt.spec, got.Mode, got.Dir, tt.mode, tt.dir)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// checkerCompiler はチェッカーのソースの拡張子ごとのビルド方法
+type checkerCompiler struct {
+	command string
+	flags   []string
+}
+
+var checkerCompilers = map[string]checkerCompiler{
+	".cpp": {command: "g++", flags: []string{"-O2", "-std=c++17"}},
+	".cc":  {command: "g++", flags: []string{"-O2", "-std=c++17"}},
+	".go":  {command: "go", flags: []string{"build"}},
+}
+
+func checkersCacheDirPath() string {
+	return filepath.Join(workDir, "checkers")
+}
+
+// compileChecker はチェッカーのソースをビルドしたバイナリのパスを返す。
+// バイナリはソースの中身とコンパイラ・フラグから決まるキーでキャッシュし、同じチェッカーは 1 度しかビルドしない
+func compileChecker(src string) (string, error) {
+	compiler, ok := checkerCompilers[filepath.Ext(src)]
+	if !ok {
+		errMsg := fmt.Sprintf("unsupported checker source %s: must be one of .cpp, .cc or .go", src)
+		return "", errors.New(errMsg)
+	}
+
+	body, err := os.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checker: %w", err)
+	}
+
+	key := checkerCacheKey(body, compiler)
+	binPath, err := filepath.Abs(filepath.Join(checkersCacheDirPath(), key, "checker"))
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		binPath += ".exe"
+	}
+
+	if existsFileOrDir(binPath) {
+		slog.Debug("checker cache hit", slog.String("checker", src), slog.String("key", key))
+		markCacheUsed(filepath.Dir(binPath))
+		return binPath, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(binPath), 0755)
+	if err != nil {
+		return "", &infraError{err: fmt.Errorf("failed to mkdir: %w", err)}
+	}
+
+	// ビルドが途中で失敗してもキャッシュに壊れたバイナリが残らないように、別名でビルドしてから置き換える
+	tmpPath := binPath + ".tmp"
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return "", err
+	}
+
+	args := append(append([]string{}, compiler.flags...), "-o", tmpPath, absSrc)
+
+	slog.Info("compiling checker", slog.String("checker", src))
+	var stderr bytes.Buffer
+	cmd := exec.Command(compiler.command, args...)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to compile checker %s: %w\n%s", src, err, stderr.String())
+	}
+
+	err = os.Rename(tmpPath, binPath)
+	if err != nil {
+		return "", &infraError{err: fmt.Errorf("failed to cache checker: %w", err)}
+	}
+
+	return binPath, nil
+}
+
+func checkerCacheKey(source []byte, compiler checkerCompiler) string {
+	h := sha256.New()
+	h.Write(source)
+	h.Write([]byte{0})
+	h.Write([]byte(compiler.command + " " + strings.Join(compiler.flags, " ")))
+	h.Write([]byte{0})
+	h.Write([]byte(runtime.GOOS + "/" + runtime.GOARCH))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// runChecker は testlib と同じく `checker <input> <output> <answer>` の形でチェッカーを呼ぶ。
+// 終了コードが 0 なら AC とし、そうでなければチェッカーの出力を理由として返す
+func runChecker(ctx context.Context, checkerPath, inFilepath, answerFilepath, outFilepath string) (bool, string, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, checkerPath, inFilepath, answerFilepath, outFilepath)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, "", nil
+	case errors.As(err, &exitErr):
+		return false, strings.TrimSpace(out.String()), nil
+	default:
+		return false, "", fmt.Errorf("failed to run checker: %w", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// chunkSpec は -chunk i/n の指定。ファイルを n 個に分けたうちの i 番目 (1 始まり) だけを verify する
+type chunkSpec struct {
+	index int
+	count int
+}
+
+func parseChunkSpec(s string) (*chunkSpec, error) {
+	i, n, ok := strings.Cut(s, "/")
+	index, ierr := strconv.Atoi(i)
+	count, nerr := strconv.Atoi(n)
+	if !ok || ierr != nil || nerr != nil || count < 1 || index < 1 || index > count {
+		errMsg := fmt.Sprintf("invalid chunk %q: must be i/n with 1 <= i <= n", s)
+		return nil, errors.New(errMsg)
+	}
+
+	return &chunkSpec{index: index, count: count}, nil
+}
+
+// contains は file がこのチャンクに割り当てられるかを返す。
+// 割り当てはパスのハッシュだけで決まるので、ファイルが増減しても他のファイルのチャンクは変わらず、CI のキャッシュが効き続ける
+func (c *chunkSpec) contains(file string) bool {
+	h := fnv.New32a()
+	io.WriteString(h, filepath.ToSlash(filepath.Clean(file)))
+	return int(h.Sum32()%uint32(c.count)) == c.index-1
+}
+
+func (c *chunkSpec) String() string {
+	return fmt.Sprintf("%d/%d", c.index, c.count)
+}
+
+// filterChunk は targets のうち c に割り当てられたものを返す
+func filterChunk(targets []verifyTarget, c *chunkSpec) []verifyTarget {
+	var selected []verifyTarget
+	for _, t := range targets {
+		if c.contains(t.file) {
+			selected = append(selected, t)
+		}
+	}
+
+	slog.Info("chunk", slog.String("chunk", c.String()), slog.Int("files", len(selected)), slog.Int("total", len(targets)))
+	return selected
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseChunkSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    chunkSpec
+		wantErr bool
+	}{
+		{spec: "1/1", want: chunkSpec{index: 1, count: 1}},
+		{spec: "2/4", want: chunkSpec{index: 2, count: 4}},
+		{spec: "4/4", want: chunkSpec{index: 4, count: 4}},
+		{spec: "0/4", wantErr: true},
+		{spec: "5/4", wantErr: true},
+		{spec: "1/0", wantErr: true},
+		{spec: "-1/4", wantErr: true},
+		{spec: "1", wantErr: true},
+		{spec: "a/b", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseChunkSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChunkSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("parseChunkSpec(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+			}
+		})
+	}
+}
+
+func chunkTargets(files ...string) []verifyTarget {
+	var targets []verifyTarget
+	for _, f := range files {
+		targets = append(targets, verifyTarget{file: f, annotation: &Annotation{}})
+	}
+	return targets
+}
+
+func TestFilterChunkPartitions(t *testing.T) {
+	var files []string
+	for i := range 50 {
+		files = append(files, fmt.Sprintf("verify/problem%02d_test.go", i))
+	}
+
+	for _, n := range []int{1, 2, 3, 7} {
+		seen := make(map[string]int)
+		for i := 1; i <= n; i++ {
+			for _, target := range filterChunk(chunkTargets(files...), &chunkSpec{index: i, count: n}) {
+				seen[target.file]++
+			}
+		}
+		for _, f := range files {
+			if seen[f] != 1 {
+				t.Errorf("with %d chunks, %s is in %d chunk(s), want 1", n, f, seen[f])
+			}
+		}
+	}
+}
+
+func TestChunkAssignmentIsStable(t *testing.T) {
+	// 割り当てはパスだけで決まる。ここが変わると CI のシャードのキャッシュがすべて外れる
+	tests := []struct {
+		file string
+		want int
+	}{
+		{file: "verify/aoj/itp1_1_a_test.go", want: 4},
+		{file: "verify/aoj/dsl_1_a_test.go", want: 3},
+		{file: "verify/yosupo/unionfind_test.go", want: 1},
+		{file: "./verify/yosupo/unionfind_test.go", want: 1},
+	}
+
+	for _, tt := range tests {
+		for i := 1; i <= 4; i++ {
+			c := &chunkSpec{index: i, count: 4}
+			if c.contains(tt.file) && i != tt.want {
+				t.Errorf("%s is in chunk %d/4, want %d/4", tt.file, i, tt.want)
+			}
+		}
+	}
+
+	// 他のファイルが増えても、既存のファイルは同じチャンクのまま
+	c := &chunkSpec{index: 1, count: 3}
+	var before []string
+	for _, target := range filterChunk(chunkTargets("a.go", "b.go", "c.go", "d.go"), c) {
+		before = append(before, target.file)
+	}
+	var kept []string
+	for _, target := range filterChunk(chunkTargets("a.go", "new1.go", "b.go", "c.go", "new2.go", "d.go"), c) {
+		if target.file != "new1.go" && target.file != "new2.go" {
+			kept = append(kept, target.file)
+		}
+	}
+	if fmt.Sprint(before) != fmt.Sprint(kept) {
+		t.Errorf("chunk 1/3 had %v, then %v after adding files", before, kept)
+	}
+}
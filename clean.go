@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runClean は途中で止まったときに残った一時ディレクトリや、残しておいた出力を削除する。
+// -all を付けるとダウンロードしたテストケースとビルドしたチェッカー、解答も削除する。
+// -problem は指定した問題のキャッシュだけを、-older-than はしばらく使っていない問題のキャッシュを削除する
+func runClean(args []string) error {
+	fset := flag.NewFlagSet("clean", flag.ExitOnError)
+	all := fset.Bool("all", false, "also remove all downloaded testcases, built checkers and cached solution binaries")
+	cache := fset.Bool("cache", false, "same as -all (deprecated)")
+	problem := fset.String("problem", "", "remove the cached testcases of this problem URL")
+	olderThan := fset.String("older-than", "", "remove cached problems, built checkers and solution binaries not used for this long (e.g. 30d or 72h)")
+	fset.Parse(args)
+
+	*all = *all || *cache
+	if *all && (*problem != "" || *olderThan != "") {
+		return errors.New(message(msgCleanAllExclusive))
+	}
+
+	var maxAge time.Duration
+	if *olderThan != "" {
+		var err error
+		maxAge, err = parseAge(*olderThan)
+		if err != nil {
+			return fmt.Errorf("invalid -older-than: %w", err)
+		}
+	}
+
+	var targets []string
+
+	tmpDirs, err := filepath.Glob(filepath.Join(workDir, "tmp*"))
+	if err != nil {
+		return err
+	}
+	targets = append(targets, tmpDirs...)
+
+	switch {
+	case *all:
+		targets = append(targets, cacheRootPath(), checkersCacheDirPath(), buildCacheDirPath())
+	case *problem != "" || maxAge > 0:
+		if *problem != "" {
+			dir := filepath.Dir(constructCacheDirPath(*problem))
+			if !existsFileOrDir(dir) {
+				slog.Warn("the problem is not cached", slog.String("problem", *problem))
+			} else {
+				targets = append(targets, dir)
+			}
+		}
+		if maxAge > 0 {
+			stale, err := findUnusedCacheEntries(maxAge)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, stale...)
+		}
+	default:
+		problemDirs, err := problemCacheDirs()
+		if err != nil {
+			return err
+		}
+		for _, dir := range problemDirs {
+			if outputsDir := filepath.Join(dir, "outputs"); existsFileOrDir(outputsDir) {
+				targets = append(targets, outputsDir)
+			}
+		}
+	}
+
+	for _, target := range targets {
+		err := os.RemoveAll(target)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", target, err)
+		}
+		slog.Info("removed", slog.String("path", target))
+	}
+
+	if !*all && (*problem != "" || maxAge > 0) {
+		// 消した問題からしか参照されていなかった blob を片付ける
+		result, err := collectGarbage(false)
+		if err != nil {
+			return fmt.Errorf("failed to collect garbage: %w", err)
+		}
+		slog.Info("removed unreferenced blobs", slog.Int("blobs", result.removedBlobs), slog.String("bytes", formatBytes(result.reclaimedBytes)))
+	}
+
+	return nil
+}
+
+// findUnusedCacheEntries は maxAge より長く使われていない問題のキャッシュと、ビルドしたチェッカーや解答のディレクトリを返す。
+// どれも使うたびに markCacheUsed が更新時刻を進める。blob はどの問題から参照されているかで判断するので、ここでは消さない
+func findUnusedCacheEntries(maxAge time.Duration) ([]string, error) {
+	dirs, err := problemCacheDirs()
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range []string{
+		filepath.Join(checkersCacheDirPath(), "*"),
+		filepath.Join(buildCacheDirPath(), "*"),
+	} {
+		builtDirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, builtDirs...)
+	}
+
+	var stale []string
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			continue
+		}
+		if time.Since(info.ModTime()) > maxAge {
+			stale = append(stale, dir)
+		}
+	}
+
+	return stale, nil
+}
+
+// markCacheUsed は問題のキャッシュやチェッカーのディレクトリ dir の更新時刻を今にして、clean -older-than で消されないようにする
+func markCacheUsed(dir string) {
+	if !existsFileOrDir(dir) {
+		return
+	}
+
+	now := time.Now()
+	err := os.Chtimes(dir, now, now)
+	if err != nil {
+		slog.Warn("failed to mark the cache as used", slog.String("dir", dir), slog.Any("error", err))
+	}
+}
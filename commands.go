@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// command は aoj-verify のサブコマンド
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands は usage に表示する順に並べる
+var commands = []command{
+	{name: "verify", summary: "verify files against the judge's testcases", run: runVerify},
+	{name: "download", summary: "download testcases for problem URLs or files without verifying", run: runDownload},
+	{name: "list", summary: "list verification files with problem titles", run: runList},
+	{name: "case", summary: "run the solution on one cached case or stdin and print the raw output", run: runCaseCommand},
+	{name: "bundle", summary: "inline the non-standard packages a go file imports into one submittable file", run: runBundle},
+	{name: "show", summary: "print a cached case's input or expected output (-copy for the clipboard)", run: runShow},
+	{name: "clean", summary: "remove temporary files and kept outputs (-all, -problem or -older-than for testcases too)", run: runClean},
+	{name: "serve", summary: "serve the latest verification status as JSON (/summary, /badge.json)", run: runServe},
+	{name: "bisect", summary: "find the commit where a case started failing with git bisect", run: runBisect},
+	{name: "history", summary: "compare per-case times of runs named with -label", run: runHistory},
+	{name: "docs", summary: "write markdown pages with per-case timings and history of each verification file", run: runDocs},
+	{name: "run", summary: "verify the files listed in a manifest", run: runManifest},
+	{name: "lint", summary: "validate annotations across the repository", run: runLint},
+	{name: "check-policy", summary: "fail if library files are not verified", run: runCheckPolicy},
+	{name: "lock", summary: "pin checksums of cached testcases to a lockfile", run: runLock},
+	{name: "init", summary: "add the cache directory to .gitignore", run: runInit},
+	{name: "cache", summary: "audit, check or garbage-collect the cache, or install a pre-commit hook", run: runCache},
+	{name: "stats", summary: "show opt-in local statistics", run: runStats},
+	{name: "version", summary: "print version and build metadata", run: runVersion},
+	{name: "self-update", summary: "install the latest release binary", run: runSelfUpdate},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// dispatch は args の先頭をサブコマンドとして実行する
+func dispatch(w io.Writer, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(w)
+		return nil
+	}
+
+	cmd, ok := findCommand(args[0])
+	if ok {
+		return cmd.run(args[1:])
+	}
+
+	// 以前の `aoj-verify [flags] <file>` という使い方も受け付ける
+	if strings.HasPrefix(args[0], "-") || existsFileOrDir(args[0]) {
+		slog.Warn("`aoj-verify <file>` is deprecated; use `aoj-verify verify <file>`")
+		return runVerify(args)
+	}
+
+	printUsage(w)
+	return fmt.Errorf("unknown command: %s", args[0])
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: aoj-verify <command> [flags] [args]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-13s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nglobal flags:")
+	fmt.Fprintf(w, "  %-13s %s\n", "-cache-dir", "where testcases are cached (default $"+cacheDirEnv+" or the user cache directory, e.g. $XDG_CACHE_HOME/aoj-verify)")
+	fmt.Fprintf(w, "  %-13s %s\n", "-lang", "language of messages (en, ja)")
+	fmt.Fprintf(w, "  %-13s %s\n", "-self-profile", "write a CPU profile of aoj-verify itself labeled by phase (download, walk, hash, compare)")
+	fmt.Fprintln(w, "\nrun `aoj-verify <command> -h` for the flags of each command")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// comparatorRule は設定ファイルの comparators の 1 つで、マッチした verification file の出力の比べ方を決める。
+// files と problems のどちらも無ければ全てのファイルにマッチする
+type comparatorRule struct {
+	// Files は verification file のパスのパターン ("**" を使える)
+	Files []string `json:"files,omitempty"`
+	// Problems は問題 ID のパターン (e.g. CGL_*)
+	Problems []string `json:"problems,omitempty"`
+	// Pipeline は順に適用する正規化と比較 (e.g. ["strip-trailing-ws", "float-eps(1e-9)", "token-compare"])
+	Pipeline []string `json:"pipeline"`
+}
+
+// comparePipeline は出力と期待される出力をそれぞれ正規化してから比べる方法。
+// 特殊な判定のたびにチェッカーを書かなくて済むようにする
+type comparePipeline struct {
+	spec        string
+	normalizers []lineNormalizer
+	// stripTrailingBlankLines が true なら最後の空行を無視する
+	stripTrailingBlankLines bool
+	// tokens が true なら空白区切りのトークンごとに比べる
+	tokens bool
+	// tolerance が 0 より大きければ、数のトークンはこの絶対誤差か相対誤差まで許す
+	tolerance float64
+}
+
+// lineNormalizer は 1 行 (改行を除く) を正規化する
+type lineNormalizer func(line []byte) []byte
+
+func (p *comparePipeline) String() string {
+	return p.spec
+}
+
+// parseComparePipeline は pipeline の各段を読む。
+// 正規化は strip-trailing-ws, crlf, ignore-case, squash-spaces、比較は exact (既定), token-compare, float-eps(誤差)
+func parseComparePipeline(steps []string) (*comparePipeline, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("pipeline is empty")
+	}
+
+	p := &comparePipeline{spec: strings.Join(steps, " → ")}
+	var comparator string
+	for _, step := range steps {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(step), "(")
+		if hasArg {
+			var ok bool
+			arg, ok = strings.CutSuffix(arg, ")")
+			if !ok {
+				errMsg := fmt.Sprintf("malformed step %q: missing )", step)
+				return nil, errors.New(errMsg)
+			}
+		}
+		if hasArg != (name == "float-eps") {
+			errMsg := fmt.Sprintf("malformed step %q: only float-eps takes an argument", step)
+			return nil, errors.New(errMsg)
+		}
+
+		switch name {
+		case "strip-trailing-ws":
+			p.normalizers = append(p.normalizers, func(line []byte) []byte { return bytes.TrimRight(line, " \t\r") })
+			p.stripTrailingBlankLines = true
+			continue
+		case "crlf":
+			p.normalizers = append(p.normalizers, func(line []byte) []byte { return bytes.TrimSuffix(line, []byte{'\r'}) })
+			continue
+		case "ignore-case":
+			p.normalizers = append(p.normalizers, bytes.ToLower)
+			continue
+		case "squash-spaces":
+			p.normalizers = append(p.normalizers, func(line []byte) []byte { return []byte(strings.Join(strings.Fields(string(line)), " ")) })
+			continue
+		case "exact":
+		case "token-compare":
+			p.tokens = true
+		case "float-eps":
+			eps, err := strconv.ParseFloat(arg, 64)
+			// !(eps > 0) は NaN も弾く
+			if err != nil || !(eps > 0) || math.IsInf(eps, 0) {
+				errMsg := fmt.Sprintf("float-eps needs a positive number: %q", arg)
+				return nil, errors.New(errMsg)
+			}
+			p.tolerance = eps
+			// 誤差を許すには数を切り出さなければならないので、トークンごとに比べる
+			p.tokens = true
+		default:
+			errMsg := fmt.Sprintf("unknown step %q: use strip-trailing-ws, crlf, ignore-case, squash-spaces, exact, token-compare or float-eps(eps)", step)
+			return nil, errors.New(errMsg)
+		}
+
+		// float-eps と token-compare は組み合わせられるが、exact とは組み合わせられない
+		if comparator != "" && (comparator == "exact" || name == "exact") {
+			errMsg := fmt.Sprintf("%s cannot be combined with %s", comparator, name)
+			return nil, errors.New(errMsg)
+		}
+		comparator = name
+	}
+
+	return p, nil
+}
+
+// compareOptions は出力の比べ方。どれも指定が無ければバイト列をそのまま比べる
+type compareOptions struct {
+	// tolerance が正なら、出力をトークンごとに比べて数はこの誤差までを許す
+	tolerance float64
+	// tokenCompare が true なら、出力をトークンごとに比べて空白や改行の違いを問わない
+	tokenCompare bool
+	// pipeline が nil でなければ、出力をこれで正規化してから比べる。tolerance や tokenCompare があれば使わない
+	pipeline *comparePipeline
+}
+
+// resolveCompareOptions は filename の出力の比べ方を決める。
+// ファイルに書いた ERROR や COMPARE、-tokens (tokens) の方が設定ファイルの comparators より優先される
+func resolveCompareOptions(filename string, annotation *Annotation, tokens bool) (compareOptions, error) {
+	opts := compareOptions{
+		tolerance:    annotation.Tolerance,
+		tokenCompare: tokens || annotation.TokenCompare,
+	}
+	if opts.tolerance > 0 || opts.tokenCompare {
+		return opts, nil
+	}
+
+	problemID, _ := extractProblemID(annotation.ProblemURL)
+	pipeline, err := projectCfg.comparePipelineFor(filename, problemID)
+	if err != nil {
+		return opts, err
+	}
+	if pipeline != nil {
+		slog.Debug("comparator pipeline", slog.String("file", filename), slog.String("pipeline", pipeline.String()))
+	}
+	opts.pipeline = pipeline
+	return opts, nil
+}
+
+// comparePipelineFor は filename (problemID の問題を解く verification file) に最初にマッチした comparators の pipeline を返す。
+// マッチするものが無ければ nil を返す
+func (c *projectConfig) comparePipelineFor(filename, problemID string) (*comparePipeline, error) {
+	for _, rule := range c.Comparators {
+		if len(rule.Files) > 0 {
+			ok, err := matchAnyGlob(rule.Files, filename)
+			if err != nil || !ok {
+				continue
+			}
+		}
+		if len(rule.Problems) > 0 {
+			ok, err := matchAnyGlob(rule.Problems, problemID)
+			if err != nil || !ok {
+				continue
+			}
+		}
+		return parseComparePipeline(rule.Pipeline)
+	}
+	return nil, nil
+}
+
+// normalizedReader は r を 1 行ずつ pipeline の正規化にかけて読む。行は全て改行で終わるようにそろえる
+type normalizedReader struct {
+	r        *bufio.Reader
+	pipeline *comparePipeline
+	// lineLimit が正なら、これより長い行は読み切らずに errLineTooLong を返す
+	lineLimit int64
+	buf       bytes.Buffer
+	// blankLines は最後の空行を捨てるときに、後ろに空でない行が来るまで保留している空行の数
+	blankLines int
+	eof        bool
+}
+
+func newNormalizedReader(r io.Reader, pipeline *comparePipeline, lineLimit int64) *normalizedReader {
+	return &normalizedReader{r: getBufioReader(r), pipeline: pipeline, lineLimit: lineLimit}
+}
+
+// errLineTooLong は正規化するために読んだ 1 行が lineLimit を超えたことを表す
+var errLineTooLong = errors.New("line too long")
+
+// readLine は改行を含めて 1 行を読む。改行が無いまま lineLimit を超えたら、そこで読むのをやめる
+func (n *normalizedReader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := n.r.ReadSlice('\n')
+		if n.lineLimit > 0 && int64(len(line)+len(chunk)) > n.lineLimit {
+			return nil, errLineTooLong
+		}
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+}
+
+// release は bufio.Reader をプールに返す
+func (n *normalizedReader) release() {
+	putBufioReader(n.r)
+}
+
+func (n *normalizedReader) Read(p []byte) (int, error) {
+	for n.buf.Len() == 0 {
+		if n.eof {
+			return 0, io.EOF
+		}
+
+		line, err := n.readLine()
+		if errors.Is(err, io.EOF) {
+			n.eof = true
+			if len(line) == 0 {
+				continue
+			}
+		} else if err != nil {
+			return 0, err
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		for _, normalize := range n.pipeline.normalizers {
+			line = normalize(line)
+		}
+
+		if n.pipeline.stripTrailingBlankLines && len(line) == 0 {
+			n.blankLines++
+			continue
+		}
+		for ; n.blankLines > 0; n.blankLines-- {
+			n.buf.WriteByte('\n')
+		}
+		n.buf.Write(line)
+		n.buf.WriteByte('\n')
+	}
+
+	return n.buf.Read(p)
+}
+
+// minPipelineLineLimit は出力の 1 行として読む大きさの下限。
+// 正規化は行ごとなので、改行の無い出力は丸ごと読まなければならない
+const minPipelineLineLimit = 16 << 20
+
+// compareFilesWithPipeline は actualPath と expectedPath をそれぞれ pipeline で正規化してから比べる。
+// 食い違った位置は正規化した後の出力での位置になる。
+// 出力に期待される出力のファイル全体 (少なくとも minPipelineLineLimit) よりも長い行があれば、読み切らずに errLineTooLong を返す
+func compareFilesWithPipeline(actualPath, expectedPath string, pipeline *comparePipeline) (*mismatch, error) {
+	actualFile, err := os.Open(actualPath)
+	if err != nil {
+		return nil, err
+	}
+	defer actualFile.Close()
+
+	expectedFile, err := os.Open(expectedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer expectedFile.Close()
+
+	info, err := expectedFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// 期待される出力はキャッシュにある大きさのものなので、そのまま読む
+	actual := newNormalizedReader(actualFile, pipeline, max(minPipelineLineLimit, info.Size()))
+	expected := newNormalizedReader(expectedFile, pipeline, 0)
+	defer actual.release()
+	defer expected.release()
+
+	if pipeline.tokens {
+		return compareTokens(actual, expected, pipeline.tolerance)
+	}
+	return compareStreams(actual, expected)
+}
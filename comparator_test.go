@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveCompareOptions(t *testing.T) {
+	saved := projectCfg
+	t.Cleanup(func() { projectCfg = saved })
+	projectCfg = &projectConfig{Comparators: []*comparatorRule{
+		{Problems: []string{"CGL_*"}, Pipeline: []string{"strip-trailing-ws", "float-eps(1e-9)"}},
+	}}
+
+	const cglURL = "https://onlinejudge.u-aizu.ac.jp/problems/CGL_1_A"
+	tests := []struct {
+		name         string
+		annotation   *Annotation
+		tokens       bool
+		wantPipeline string
+		wantTokens   bool
+	}{
+		{name: "comparator of the problem", annotation: &Annotation{ProblemURL: cglURL}, wantPipeline: "strip-trailing-ws → float-eps(1e-9)"},
+		{name: "no matching comparator", annotation: &Annotation{ProblemURL: "https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A"}},
+		// ファイルに書いた指定や -tokens は設定ファイルより優先する
+		{name: "ERROR annotation", annotation: &Annotation{ProblemURL: cglURL, Tolerance: 1e-6}},
+		{name: "COMPARE tokens annotation", annotation: &Annotation{ProblemURL: cglURL, TokenCompare: true}, wantTokens: true},
+		{name: "-tokens", annotation: &Annotation{ProblemURL: cglURL}, tokens: true, wantTokens: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveCompareOptions("verify/sol_test.go", tt.annotation, tt.tokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pipeline string
+			if got.pipeline != nil {
+				pipeline = got.pipeline.String()
+			}
+			if pipeline != tt.wantPipeline || got.tokenCompare != tt.wantTokens || got.tolerance != tt.annotation.Tolerance {
+				t.Errorf("resolveCompareOptions() = %+v (pipeline %q), want pipeline %q, tokenCompare %v", got, pipeline, tt.wantPipeline, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestParseComparePipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		// line は正規化を順に適用する行、wantLine はその結果
+		line          string
+		wantLine      string
+		wantTokens    bool
+		wantTolerance float64
+		wantErr       bool
+	}{
+		{name: "normalizers only", steps: []string{"crlf", "strip-trailing-ws"}, line: "1 2 \r", wantLine: "1 2"},
+		{name: "normalizers in order", steps: []string{"squash-spaces", "ignore-case"}, line: "  A   b ", wantLine: "a b"},
+		// 比較の段は正規化の前後どちらに書いてもよく、後ろの正規化も使われる
+		{name: "comparator before normalizer", steps: []string{"float-eps(1e-9)", "strip-trailing-ws"}, line: "0.5 \t", wantLine: "0.5", wantTokens: true, wantTolerance: 1e-9},
+		{name: "token compare and float eps", steps: []string{"token-compare", "float-eps(1e-6)"}, line: "x", wantLine: "x", wantTokens: true, wantTolerance: 1e-6},
+		{name: "exact", steps: []string{"exact"}, line: "x ", wantLine: "x "},
+		{name: "spaces around a step", steps: []string{" ignore-case "}, line: "X", wantLine: "x"},
+		{name: "empty", steps: nil, wantErr: true},
+		{name: "empty step", steps: []string{""}, wantErr: true},
+		{name: "unknown step", steps: []string{"sort-lines"}, wantErr: true},
+		{name: "float-eps without )", steps: []string{"float-eps("}, wantErr: true},
+		{name: "float-eps with unclosed argument", steps: []string{"float-eps(1e-9"}, wantErr: true},
+		{name: "float-eps without argument", steps: []string{"float-eps"}, wantErr: true},
+		{name: "float-eps with empty argument", steps: []string{"float-eps()"}, wantErr: true},
+		{name: "float-eps zero", steps: []string{"float-eps(0)"}, wantErr: true},
+		{name: "float-eps negative", steps: []string{"float-eps(-1e-9)"}, wantErr: true},
+		{name: "float-eps inf", steps: []string{"float-eps(inf)"}, wantErr: true},
+		{name: "float-eps nan", steps: []string{"float-eps(nan)"}, wantErr: true},
+		{name: "argument to a normalizer", steps: []string{"crlf()"}, wantErr: true},
+		{name: "exact after token compare", steps: []string{"token-compare", "exact"}, wantErr: true},
+		{name: "float eps after exact", steps: []string{"exact", "float-eps(1e-9)"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseComparePipeline(tt.steps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseComparePipeline(%q) error = %v, wantErr %v", tt.steps, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			line := []byte(tt.line)
+			for _, normalize := range got.normalizers {
+				line = normalize(line)
+			}
+			if string(line) != tt.wantLine {
+				t.Errorf("normalized %q = %q, want %q", tt.line, line, tt.wantLine)
+			}
+			if got.tokens != tt.wantTokens || got.tolerance != tt.wantTolerance {
+				t.Errorf("tokens = %v, tolerance = %g, want %v, %g", got.tokens, got.tolerance, tt.wantTokens, tt.wantTolerance)
+			}
+		})
+	}
+}
+
+func TestNormalizedReaderLineLimit(t *testing.T) {
+	pipeline, err := parseComparePipeline([]string{"strip-trailing-ws"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		lineLimit int64
+		want      string
+		wantErr   error
+	}{
+		{name: "within limit", input: "1234567\n12 \n", lineLimit: 8, want: "1234567\n12\n"},
+		{name: "no limit", input: strings.Repeat("a", 10000), want: strings.Repeat("a", 10000) + "\n"},
+		{name: "line without newline beyond limit", input: "12\n" + strings.Repeat("a", 10000), lineLimit: 8, wantErr: errLineTooLong},
+		// bufio.Reader のバッファより長い行も、つなげて 1 行として読む
+		{name: "line longer than the buffer", input: strings.Repeat("a", 10000) + " \n", lineLimit: 20000, want: strings.Repeat("a", 10000) + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newNormalizedReader(strings.NewReader(tt.input), pipeline, tt.lineLimit)
+			defer r.release()
+
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("ReadAll = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareFilesWithPipelineLongLine(t *testing.T) {
+	pipeline, err := parseComparePipeline([]string{"strip-trailing-ws"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	actualPath, expectedPath := filepath.Join(dir, "actual"), filepath.Join(dir, "expected")
+	if err := os.WriteFile(expectedPath, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 改行を出さずに暴走した出力
+	if err := os.WriteFile(actualPath, bytes.Repeat([]byte{'1'}, minPipelineLineLimit+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = compareFilesWithPipeline(actualPath, expectedPath, pipeline)
+	if !errors.Is(err, errLineTooLong) {
+		t.Errorf("compareFilesWithPipeline() error = %v, want %v", err, errLineTooLong)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// mismatch は出力と期待される出力が最初に食い違った位置
+type mismatch struct {
+	// offset は 0 始まりのバイト位置、line と column は 1 始まり
+	offset int64
+	line   int
+	column int
+}
+
+func (m *mismatch) String() string {
+	return fmt.Sprintf("line %d, column %d (byte %d)", m.line, m.column, m.offset)
+}
+
+// advance は matched を読み進めた分だけ m を進める
+func (m *mismatch) advance(matched []byte) {
+	m.offset += int64(len(matched))
+
+	lines := bytes.Count(matched, []byte{'\n'})
+	if lines == 0 {
+		m.column += len(matched)
+		return
+	}
+
+	m.line += lines
+	m.column = len(matched) - bytes.LastIndexByte(matched, '\n')
+}
+
+var errOutputMismatch = errors.New("output mismatch")
+
+// streamComparer は書き込まれた出力を expected と少しずつ照合する io.Writer。
+// 食い違いが見つかると diverged を呼び、それ以降の書き込みは errOutputMismatch で拒む。
+// 使い終わったら release でバッファをプールに返す
+type streamComparer struct {
+	expected io.Reader
+	// buf は expected を読むバッファで、copyBufferPool から借りる
+	buf      *[]byte
+	pos      mismatch
+	mismatch *mismatch
+	diverged func()
+}
+
+func newStreamComparer(expected io.Reader) *streamComparer {
+	return &streamComparer{
+		expected: expected,
+		buf:      copyBufferPool.Get().(*[]byte),
+		pos:      mismatch{line: 1, column: 1},
+	}
+}
+
+func (c *streamComparer) Write(p []byte) (int, error) {
+	if c.mismatch != nil {
+		return 0, errOutputMismatch
+	}
+
+	// 大きな書き込みは buf の大きさずつ照合する
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), len(*c.buf))]
+		n, err := io.ReadFull(c.expected, (*c.buf)[:len(chunk)])
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return written, fmt.Errorf("failed to read expected output: %w", err)
+		}
+
+		i := commonPrefixLen(chunk[:n], (*c.buf)[:n])
+		c.pos.advance(chunk[:i])
+		if i < len(chunk) {
+			// 中身が違うか、期待される出力より長い
+			c.diverge()
+			return written + i, errOutputMismatch
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+// ReadFrom は os/exec や io.Copy が書き込みのたびにバッファを確保しないように、プールのバッファで r を読む
+func (c *streamComparer) ReadFrom(r io.Reader) (int64, error) {
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+
+	return io.CopyBuffer(struct{ io.Writer }{c}, struct{ io.Reader }{r}, *buf)
+}
+
+// release は buf をプールに返す。その後は c を使わない
+func (c *streamComparer) release() {
+	if c.buf != nil {
+		copyBufferPool.Put(c.buf)
+		c.buf = nil
+	}
+}
+
+// finish は出力が終わったときに呼び、期待される出力が残っていないかを確かめて最初に食い違った位置を返す。
+// 一致すれば nil を返す
+func (c *streamComparer) finish() (*mismatch, error) {
+	if c.mismatch != nil {
+		return c.mismatch, nil
+	}
+
+	_, err := io.ReadFull(c.expected, (*c.buf)[:1])
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected output: %w", err)
+	}
+
+	// 期待される出力より短い
+	c.diverge()
+	return c.mismatch, nil
+}
+
+func (c *streamComparer) diverge() {
+	m := c.pos
+	c.mismatch = &m
+	if c.diverged != nil {
+		c.diverged()
+	}
+}
+
+func commonPrefixLen(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return len(a)
+}
+
+// compareStreams は actual と expected を先頭から少しずつ比べ、食い違いが見つかった時点で読むのをやめる。
+// 一致すれば nil を返す
+func compareStreams(actual, expected io.Reader) (*mismatch, error) {
+	c := newStreamComparer(expected)
+	defer c.release()
+
+	_, err := c.ReadFrom(actual)
+	if err != nil && !errors.Is(err, errOutputMismatch) {
+		return nil, err
+	}
+
+	return c.finish()
+}
+
+// hashCompareMinSize 以上の大きさの期待される出力は、manifest の sha256 と比べて AC を確かめる。
+// 小さい出力は読み比べても変わらないので、sha256 を計算する手間を省く
+const hashCompareMinSize = 1 << 20
+
+// compareFilesWithChecksum は出力を書きながら計算した sha256 の actualSum が expectedSum と一致すれば、どちらのファイルも読まずに nil を返す。
+// ほとんどのケースが AC になるので、出力を書き終えた時点で判定が済む。一致しなければ compareFiles で食い違った位置を探す
+func compareFilesWithChecksum(actualPath, expectedPath, actualSum, expectedSum string) (*mismatch, error) {
+	if actualSum == expectedSum {
+		return nil, nil
+	}
+
+	return compareFiles(actualPath, expectedPath)
+}
+
+// compareFiles は actualPath と expectedPath の中身を比べ、最初に食い違った位置を返す。一致すれば nil を返す
+func compareFiles(actualPath, expectedPath string) (*mismatch, error) {
+	actual, err := os.Open(actualPath)
+	if err != nil {
+		return nil, err
+	}
+	defer actual.Close()
+
+	expected, err := os.Open(expectedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer expected.Close()
+
+	return compareStreams(actual, expected)
+}
+
+// tokenReader は空白区切りのトークンを、出力の中での位置と一緒に読む
+type tokenReader struct {
+	r   *bufio.Reader
+	pos mismatch
+}
+
+func newTokenReader(r io.Reader) *tokenReader {
+	return &tokenReader{r: getBufioReader(r), pos: mismatch{line: 1, column: 1}}
+}
+
+// release は bufio.Reader をプールに返す
+func (t *tokenReader) release() {
+	putBufioReader(t.r)
+}
+
+func isSpaceByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	default:
+		return false
+	}
+}
+
+// next は次のトークンとその先頭の位置を返す。トークンが残っていなければ io.EOF を返す
+func (t *tokenReader) next() ([]byte, mismatch, error) {
+	var token []byte
+	var start mismatch
+	for {
+		b, err := t.r.ReadByte()
+		if errors.Is(err, io.EOF) && len(token) > 0 {
+			return token, start, nil
+		}
+		if err != nil {
+			return nil, t.pos, err
+		}
+
+		if isSpaceByte(b) {
+			t.pos.advance([]byte{b})
+			if len(token) > 0 {
+				return token, start, nil
+			}
+			continue
+		}
+
+		if len(token) == 0 {
+			start = t.pos
+		}
+		token = append(token, b)
+		t.pos.advance([]byte{b})
+	}
+}
+
+// parseDecimal は token を10進表記の数として読む。
+// ParseFloat が受け付ける nan や inf、16進表記、桁区切りの _ は数とみなさない
+func parseDecimal(token []byte) (float64, bool) {
+	for _, b := range token {
+		switch {
+		case '0' <= b && b <= '9', b == '.', b == '+', b == '-', b == 'e', b == 'E':
+		default:
+			return 0, false
+		}
+	}
+
+	x, err := strconv.ParseFloat(string(token), 64)
+	return x, err == nil
+}
+
+// tokensMatch は a と e が同じトークンか、どちらも数で、その差が絶対誤差か相対誤差で tolerance 以内かを返す。
+// tolerance が 0 ならトークンが同じかだけを見る
+func tokensMatch(a, e []byte, tolerance float64) bool {
+	if bytes.Equal(a, e) {
+		return true
+	}
+	if tolerance <= 0 {
+		return false
+	}
+
+	x, ok := parseDecimal(a)
+	if !ok {
+		return false
+	}
+	y, ok := parseDecimal(e)
+	if !ok {
+		return false
+	}
+
+	diff := math.Abs(x - y)
+	return diff <= tolerance || diff <= tolerance*math.Abs(y)
+}
+
+// compareFilesWithTolerance は actualPath と expectedPath をトークンごとに比べ、数は tolerance までの誤差を許す。
+// 空白の違い (行末の空白、最後の改行の有無、CRLF と LF) は問わない。tolerance が 0 ならトークンが完全に一致するかを見る。
+// 最初に食い違ったトークンの位置を返し、一致すれば nil を返す
+func compareFilesWithTolerance(actualPath, expectedPath string, tolerance float64) (*mismatch, error) {
+	actualFile, err := os.Open(actualPath)
+	if err != nil {
+		return nil, err
+	}
+	defer actualFile.Close()
+
+	expectedFile, err := os.Open(expectedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer expectedFile.Close()
+
+	return compareTokens(actualFile, expectedFile, tolerance)
+}
+
+// compareTokens は actualReader と expectedReader をトークンごとに比べ、最初に食い違ったトークンの位置を返す。一致すれば nil を返す
+func compareTokens(actualReader, expectedReader io.Reader, tolerance float64) (*mismatch, error) {
+	actual, expected := newTokenReader(actualReader), newTokenReader(expectedReader)
+	defer actual.release()
+	defer expected.release()
+	for {
+		a, pos, aerr := actual.next()
+		if aerr != nil && !errors.Is(aerr, io.EOF) {
+			return nil, aerr
+		}
+		e, _, eerr := expected.next()
+		if eerr != nil && !errors.Is(eerr, io.EOF) {
+			return nil, fmt.Errorf("failed to read expected output: %w", eerr)
+		}
+
+		switch {
+		case aerr != nil && eerr != nil:
+			return nil, nil
+		case aerr != nil || eerr != nil:
+			// どちらかのトークンが足りない
+			return &pos, nil
+		case !tokensMatch(a, e, tolerance):
+			return &pos, nil
+		}
+	}
+}
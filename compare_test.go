@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokensMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, e      string
+		tolerance float64
+		want      bool
+	}{
+		{name: "same token", a: "abc", e: "abc", tolerance: 1e-6, want: true},
+		{name: "different token", a: "abc", e: "abd", tolerance: 1e-6, want: false},
+		{name: "same number written differently", a: "1.0", e: "1", tolerance: 1e-6, want: true},
+		{name: "negative zero", a: "-0", e: "0", tolerance: 1e-6, want: true},
+		{name: "within absolute error", a: "0.1000001", e: "0.1", tolerance: 1e-6, want: true},
+		{name: "beyond absolute error", a: "0.100002", e: "0.1", tolerance: 1e-6, want: false},
+		{name: "within relative error", a: "1000000.5", e: "1000000", tolerance: 1e-6, want: true},
+		{name: "beyond relative error", a: "1000002", e: "1000000", tolerance: 1e-6, want: false},
+		{name: "exponent", a: "1e-7", e: "0", tolerance: 1e-6, want: true},
+		{name: "number and word", a: "1", e: "one", tolerance: 1e-6, want: false},
+		{name: "nan as is", a: "nan", e: "nan", tolerance: 1e-6, want: true},
+		{name: "nan spelled differently", a: "NaN", e: "nan", tolerance: 1e-6, want: false},
+		{name: "inf spelled differently", a: "+Inf", e: "inf", tolerance: 1e-6, want: false},
+		{name: "infinity and huge number", a: "inf", e: "1e308", tolerance: 1e-6, want: false},
+		{name: "hex float", a: "0x1p4", e: "16", tolerance: 1e-6, want: false},
+		{name: "digit separator", a: "1_000", e: "1000", tolerance: 1e-6, want: false},
+		{name: "overflow", a: "1e400", e: "1e401", tolerance: 1e-6, want: false},
+		// COMPARE tokens は tolerance 0 で比べる
+		{name: "exact mode same token", a: "1.0", e: "1.0", want: true},
+		{name: "exact mode same number", a: "1.0", e: "1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tokensMatch([]byte(tt.a), []byte(tt.e), tt.tolerance)
+			if got != tt.want {
+				t.Errorf("tokensMatch(%q, %q, %g) = %v, want %v", tt.a, tt.e, tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareFilesWithTolerance(t *testing.T) {
+	tests := []struct {
+		name      string
+		actual    string
+		expected  string
+		tolerance float64
+		// wantMismatch が空でなければ、その位置で食い違うことを期待する
+		wantMismatch string
+	}{
+		{name: "same", actual: "1 2\n3\n", expected: "1 2\n3\n"},
+		{name: "trailing spaces", actual: "1 2  \n3 \n", expected: "1 2\n3\n"},
+		{name: "missing final newline", actual: "1 2\n3", expected: "1 2\n3\n"},
+		{name: "crlf", actual: "1 2\r\n3\r\n", expected: "1 2\n3\n"},
+		{name: "different token", actual: "1 2\n4\n", expected: "1 2\n3\n", wantMismatch: "line 2, column 1 (byte 4)"},
+		{name: "missing token", actual: "1 2\n", expected: "1 2\n3\n", wantMismatch: "line 2, column 1 (byte 4)"},
+		{name: "extra token", actual: "1 2\n3 4\n", expected: "1 2\n3\n", wantMismatch: "line 2, column 3 (byte 6)"},
+		{name: "within tolerance", actual: "0.3333334\n", expected: "0.3333333\n", tolerance: 1e-6},
+		{name: "beyond tolerance", actual: "0.34\n", expected: "0.3333333\n", tolerance: 1e-6, wantMismatch: "line 1, column 1 (byte 0)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			actualPath, expectedPath := filepath.Join(dir, "actual"), filepath.Join(dir, "expected")
+			if err := os.WriteFile(actualPath, []byte(tt.actual), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(expectedPath, []byte(tt.expected), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := compareFilesWithTolerance(actualPath, expectedPath, tt.tolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.wantMismatch == "" && got != nil:
+				t.Errorf("compareFilesWithTolerance() = %s, want match", got)
+			case tt.wantMismatch != "" && got == nil:
+				t.Errorf("compareFilesWithTolerance() = match, want mismatch at %s", tt.wantMismatch)
+			case tt.wantMismatch != "" && got.String() != tt.wantMismatch:
+				t.Errorf("compareFilesWithTolerance() = %s, want %s", got, tt.wantMismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/matumoto1234/aoj-verify/language"
+)
+
+// projectConfigNames はリポジトリのルートに置く設定ファイルの候補。フラグを毎回渡さなくて済むようにする。
+// どの形式でもキーは同じ名前 (json タグ) を使う
+var projectConfigNames = []string{".aoj-verify.json", ".aoj-verify.toml", ".aoj-verify.yaml", ".aoj-verify.yml"}
+
+// projectConfigPath は読み込んだ設定ファイル。無ければ案内に使う .aoj-verify.json のまま
+var projectConfigPath = projectConfigNames[0]
+
+// workDir はテストケースのキャッシュや出力、履歴を置くディレクトリ。設定ファイルの cacheDir で変えられる
+var workDir = ".aoj-verify"
+
+// projectConfig は projectConfigPath の中身。フラグで指定したものが優先される
+type projectConfig struct {
+	// CacheDir は workDir を置き換える。指定すると、テストケースのキャッシュもユーザーのキャッシュディレクトリではなくこの下に置く
+	CacheDir string `json:"cacheDir,omitempty"`
+	// BuildTags は go build に常に渡すビルドタグ
+	BuildTags []string `json:"buildTags,omitempty"`
+	// CppCompiler は C++ の解答をビルドするコマンドとフラグ (既定は g++ -O2 -std=c++17)
+	CppCompiler []string `json:"cppCompiler,omitempty"`
+	// CheckerCompilers はチェッカーのソースの拡張子ごとのコンパイルコマンド。先頭がコマンドで残りがフラグ
+	CheckerCompilers map[string][]string `json:"checkerCompilers,omitempty"`
+	// RunTimeout, MaxTime, TimeMargin, TimeoutGrace は同名のフラグの既定値 ("30m" のような time.Duration の書式)
+	RunTimeout   string `json:"runTimeout,omitempty"`
+	MaxTime      string `json:"maxTime,omitempty"`
+	TimeMargin   string `json:"timeMargin,omitempty"`
+	TimeoutGrace string `json:"timeoutGrace,omitempty"`
+	// TimeFactor は -time-factor の既定値で、ジャッジの制限時間に掛ける係数
+	TimeFactor float64 `json:"timeFactor,omitempty"`
+	// Politeness は -politeness と同じ書式で、ジャッジごとのアクセス間隔と並列度を指定する
+	Politeness string `json:"politeness,omitempty"`
+	// Sources は -sources と同じく、テストケースを取りに行く先の順番
+	Sources []string `json:"sources,omitempty"`
+	// Jobs は -jobs の既定値で、同時に実行するケースの数
+	Jobs int `json:"jobs,omitempty"`
+	// Ignore はディレクトリを探索するときに除外するパスのパターン ("**" を使える)
+	Ignore []string `json:"ignore,omitempty"`
+	// ScanToolDirs が true ならディレクトリの探索で aoj-verify 自身のソースやキャッシュ、一時ディレクトリも除外しない
+	ScanToolDirs bool `json:"scanToolDirs,omitempty"`
+	// SkipVerified が true なら、最後に verify して成功してからソースが変わっていないファイルを飛ばす (-skip-verified)
+	SkipVerified bool `json:"skipVerified,omitempty"`
+	// Comparators は問題やディレクトリごとの出力の比べ方。最初にマッチしたものを使い、ERROR や COMPARE のアノテーションがあればそちらを優先する
+	Comparators []*comparatorRule `json:"comparators,omitempty"`
+	// Credentials はジャッジのホストごとの認証情報。秘密をコミットしないように、トークンは環境変数から読む
+	Credentials map[string]*judgeCredential `json:"credentials,omitempty"`
+	// Languages は言語の名前ごとの拡張子、コメント記号、ビルドと実行のコマンドのテンプレート。
+	// 組み込みの go, cpp と同じ名前なら置き換える
+	Languages map[string]*language.Language `json:"languages,omitempty"`
+}
+
+type judgeCredential struct {
+	// TokenEnv はトークンを入れた環境変数の名前。Authorization: Bearer で送る
+	TokenEnv string `json:"tokenEnv"`
+}
+
+// defaultCredentials は設定ファイルに credentials が無いときに使う認証情報
+var defaultCredentials = map[string]*judgeCredential{
+	yukicoderHost: {TokenEnv: yukicoderTokenEnv},
+}
+
+// projectCfg は読み込んだ設定。設定ファイルが無ければ空のまま
+var projectCfg = &projectConfig{}
+
+// loadProjectConfig はカレントディレクトリの設定ファイルを読み込んで反映する。ファイルが無ければ何もしない
+func loadProjectConfig() error {
+	var found []string
+	for _, name := range projectConfigNames {
+		if existsFileOrDir(name) {
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil
+	case 1:
+		projectConfigPath = found[0]
+	default:
+		errMsg := message(msgSeveralConfigFiles, strings.Join(found, ", "))
+		return errors.New(errMsg)
+	}
+
+	body, err := os.ReadFile(projectConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := &projectConfig{}
+	err = unmarshalByExt(projectConfigPath, body, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", projectConfigPath, err)
+	}
+	for name, l := range cfg.Languages {
+		if l != nil {
+			l.Name = name
+		}
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", projectConfigPath, err)
+	}
+
+	projectCfg = cfg
+	if cfg.CacheDir != "" {
+		err := checkCacheDirPlacement(cfg.CacheDir)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", projectConfigPath, err)
+		}
+		workDir = filepath.Clean(cfg.CacheDir)
+	}
+	scanToolDirs = cfg.ScanToolDirs
+	if len(cfg.CppCompiler) > 0 {
+		cppCompiler = cfg.CppCompiler
+	}
+	for ext, command := range cfg.CheckerCompilers {
+		checkerCompilers[ext] = checkerCompiler{command: command[0], flags: command[1:]}
+	}
+	for name, l := range cfg.Languages {
+		languages.Register(l)
+		if l.TimeFactor > 0 {
+			languageFactors[name] = l.TimeFactor
+		}
+	}
+
+	return nil
+}
+
+func (c *projectConfig) validate() error {
+	for ext, command := range c.CheckerCompilers {
+		if !strings.HasPrefix(ext, ".") {
+			errMsg := fmt.Sprintf("checker compiler key %q must be an extension such as .cpp", ext)
+			return errors.New(errMsg)
+		}
+		if len(command) == 0 {
+			errMsg := fmt.Sprintf("checker compiler for %s has no command", ext)
+			return errors.New(errMsg)
+		}
+	}
+
+	for _, p := range c.Ignore {
+		_, err := matchGlob(p, "")
+		if err != nil {
+			return fmt.Errorf("malformed ignore pattern %q: %w", p, err)
+		}
+	}
+
+	for i, rule := range c.Comparators {
+		if rule == nil {
+			errMsg := fmt.Sprintf("comparators[%d] is empty", i)
+			return errors.New(errMsg)
+		}
+		for _, p := range append(slices.Clone(rule.Files), rule.Problems...) {
+			_, err := matchGlob(p, "")
+			if err != nil {
+				return fmt.Errorf("malformed pattern %q in comparators[%d]: %w", p, i, err)
+			}
+		}
+		_, err := parseComparePipeline(rule.Pipeline)
+		if err != nil {
+			return fmt.Errorf("invalid pipeline in comparators[%d]: %w", i, err)
+		}
+	}
+
+	for name, l := range c.Languages {
+		if l == nil {
+			errMsg := fmt.Sprintf("language %s is empty", name)
+			return errors.New(errMsg)
+		}
+		err := l.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	for host, cred := range c.Credentials {
+		if cred == nil || cred.TokenEnv == "" {
+			errMsg := fmt.Sprintf("credential for %s must have tokenEnv", host)
+			return errors.New(errMsg)
+		}
+	}
+
+	return nil
+}
+
+// applyFlagDefaults は設定ファイルの値を fset のフラグの既定値にする。Parse より前に呼ぶので、コマンドラインの指定が優先される
+func (c *projectConfig) applyFlagDefaults(fset *flag.FlagSet) error {
+	defaults := map[string]string{
+		"run-timeout":   c.RunTimeout,
+		"max-time":      c.MaxTime,
+		"time-margin":   c.TimeMargin,
+		"timeout-grace": c.TimeoutGrace,
+		"politeness":    c.Politeness,
+		"tags":          strings.Join(c.BuildTags, ","),
+		"sources":       strings.Join(c.Sources, ","),
+	}
+	if c.Jobs > 0 {
+		defaults["jobs"] = strconv.Itoa(c.Jobs)
+	}
+	if c.ScanToolDirs {
+		defaults["scan-tool-dirs"] = "true"
+	}
+	if c.SkipVerified {
+		defaults["skip-verified"] = "true"
+	}
+	if c.TimeFactor > 0 {
+		defaults["time-factor"] = strconv.FormatFloat(c.TimeFactor, 'g', -1, 64)
+	}
+
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		value := defaults[name]
+		if value == "" || fset.Lookup(name) == nil {
+			continue
+		}
+
+		err := fset.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s: %w", name, projectConfigPath, err)
+		}
+	}
+
+	return nil
+}
+
+// ignored は path が Ignore のパターンのどれかにマッチするかを返す
+func (c *projectConfig) ignored(path string) bool {
+	ok, _ := matchAnyGlob(c.Ignore, path)
+	return ok
+}
+
+// authorization は host に送る Authorization ヘッダの値を返す。認証情報が無ければ空文字列
+func (c *projectConfig) authorization(host string) string {
+	cred, ok := c.Credentials[host]
+	if !ok {
+		cred, ok = defaultCredentials[host]
+	}
+	if !ok {
+		return ""
+	}
+
+	token := os.Getenv(cred.TokenEnv)
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
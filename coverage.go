@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dependentPackageDirs は各 verification file が依存している (標準ライブラリ以外の) パッケージのディレクトリを求め、
+// ディレクトリ → それを使っている verification file の対応を返す
+func dependentPackageDirs(files []string) (map[string][]string, error) {
+	dirs := make(map[string][]string)
+
+	for _, file := range files {
+		if filepath.Ext(file) != ".go" {
+			continue
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.Command("go", "list", "-deps", "-f", `{{if and (not .Standard) (ne .ImportPath "command-line-arguments")}}{{.Dir}}{{end}}`, file)
+		cmd.Stderr = &stderr
+
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dependencies of %s: %w\n%s", file, err, stderr.String())
+		}
+
+		for dir := range strings.Lines(string(out)) {
+			dir = strings.TrimSpace(dir)
+			if dir == "" {
+				continue
+			}
+			dirs[dir] = append(dirs[dir], file)
+		}
+	}
+
+	return dirs, nil
+}
+
+// packageCoverage はライブラリのパッケージとそれを使っている verification file の対応
+type packageCoverage struct {
+	dir        string
+	verifiedBy []string
+}
+
+// computePackageCoverage は root 以下のライブラリのパッケージごとに、どの verification file から使われているかを求める
+func computePackageCoverage(root string, verificationFiles []string) ([]*packageCoverage, error) {
+	libraryFiles, err := findLibraryFiles(root, []string{"**/*.go"}, []string{"**/*_test.go"}, verificationFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find library files: %w", err)
+	}
+
+	verifiedDirs, err := dependentPackageDirs(verificationFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var coverages []*packageCoverage
+	seen := make(map[string]bool)
+	for _, file := range libraryFiles {
+		dir := filepath.Dir(file)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		coverages = append(coverages, &packageCoverage{
+			dir:        dir,
+			verifiedBy: verifiedDirs[absDir],
+		})
+	}
+
+	return coverages, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// cppCompiler は C++ の解答をビルドするコマンドとフラグ。設定ファイルの cppCompiler で変えられる
+var cppCompiler = []string{"g++", "-O2", "-std=c++17"}
+
+// buildCppSolution は C++ のソースファイルをビルドして binaryFilepath に出力する。
+// expanded にあるソースは展開したものをコンパイルし、#include "..." が元の場所から解決されるように元のディレクトリを -I に加える
+func buildCppSolution(buildFilenames []string, binaryFilepath string, expanded map[string]string) error {
+	args, err := cppBuildArgs(buildFilenames, binaryFilepath)
+	if err != nil {
+		return err
+	}
+	var includes []string
+	for i, arg := range args {
+		if dst, ok := expanded[arg]; ok {
+			args[i] = dst
+			includes = append(includes, "-I", filepath.Dir(arg))
+		}
+	}
+	args = slices.Insert(args, 1, includes...)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to build c++ file: %w\n%s", err, stderr.String())
+	}
+
+	return nil
+}
+
+// cppBuildArgs はコンパイラを先頭にしたビルドのコマンドを組み立てる。
+// ライブラリを #include "path/to/lib.hpp" のようにリポジトリのルートから書けるように、カレントディレクトリを -I に加える
+func cppBuildArgs(buildFilenames []string, binaryFilepath string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	args := slices.Clone(cppCompiler)
+	args = append(args, "-I", wd, "-o", binaryFilepath)
+	for _, f := range buildFilenames {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve source path: %w", err)
+		}
+		args = append(args, abs)
+	}
+
+	return args, nil
+}
+
+// cppDependencies は filename が #include しているシステム以外のヘッダを返す
+func cppDependencies(filename string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append(slices.Clone(cppCompiler[1:]), "-I", wd, "-MM", filename)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(cppCompiler[0], args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dependencies of %s: %w\n%s", filename, err, stderr.String())
+	}
+
+	// "main.o: main.cpp lib/a.hpp \
+	//   lib/b.hpp" の形式
+	_, deps, _ := strings.Cut(string(out), ":")
+	return strings.Fields(strings.ReplaceAll(deps, "\\\n", " ")), nil
+}
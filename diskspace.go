@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+)
+
+// checkDiskSpace は dir のあるボリュームに needed バイトを書き込めるだけの空きがあるかを調べる。
+// 足りなければ警告し、strict なら中断する。空き容量が分からない環境では何もしない
+func checkDiskSpace(dir string, needed int64, strict bool) error {
+	if needed <= 0 {
+		return nil
+	}
+
+	// キャッシュディレクトリはまだ無いことがあるので、存在する親で調べる
+	path := dir
+	for !existsFileOrDir(path) && filepath.Dir(path) != path {
+		path = filepath.Dir(path)
+	}
+
+	free, ok := freeDiskSpace(path)
+	if !ok || free >= needed {
+		return nil
+	}
+
+	if strict {
+		return &infraError{err: fmt.Errorf("not enough disk space for testcases: need %s, %s free on %s", formatBytes(needed), formatBytes(free), path)}
+	}
+	slog.Warn("not enough disk space for testcases; the download may fail",
+		slog.String("need", formatBytes(needed)),
+		slog.String("free", formatBytes(free)),
+		slog.String("path", path),
+	)
+	return nil
+}
+
+// formatBytes は n を KiB, MiB などの単位で表す
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
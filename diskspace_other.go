@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// freeDiskSpace は空き容量を調べられない環境では false を返す
+func freeDiskSpace(path string) (int64, bool) {
+	return 0, false
+}
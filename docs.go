@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// docsHistoryRuns はドキュメントの履歴の表に載せる直近の run の数
+const docsHistoryRuns = 10
+
+// runDocs は verification file ごとのページと一覧を Markdown で書き出す。
+// 各ページには最新の run のケースごとの実行時間と、履歴の推移を載せて性能の記録にも使えるようにする
+func runDocs(args []string) error {
+	fset := flag.NewFlagSet("docs", flag.ExitOnError)
+	outDir := fset.String("out", "docs", "directory to write the markdown pages to")
+	fset.Parse(args)
+
+	root := "."
+	if fset.NArg() > 0 {
+		root = fset.Arg(0)
+	}
+
+	status, err := collectRepoStatus(root)
+	if err != nil {
+		return err
+	}
+
+	histories := make(map[string][]*historyRecord)
+	err = scanHistory(func(r *historyRecord) {
+		if r.SamplesOnly {
+			return
+		}
+		file := filepath.Clean(r.File)
+		histories[file] = append(histories[file], r)
+	})
+	if err != nil {
+		return err
+	}
+
+	var index strings.Builder
+	index.WriteString("# Verification status\n\n")
+	fmt.Fprintf(&index, "%d/%d verified, %d failed, %d unverified (generated at %s)\n\n", status.Verified, status.Total, status.Failed, status.Unverified, status.GeneratedAt.Format(time.DateTime))
+	index.WriteString("| File | Status | Last run | History |\n|---|---|---|---|\n")
+
+	for _, st := range status.Files {
+		records := histories[filepath.Clean(st.File)]
+		page := filepath.ToSlash(st.File) + ".md"
+
+		body := renderFileDoc(st, records)
+		err := writeFileWithDir(filepath.Join(*outDir, filepath.FromSlash(page)), []byte(body))
+		if err != nil {
+			return err
+		}
+
+		lastRun := "-"
+		if st.LastRun != nil {
+			lastRun = st.LastRun.Format(time.DateTime)
+		}
+		fmt.Fprintf(&index, "| [%s](%s) | %s | %s | %s |\n", st.File, page, st.Status, lastRun, sparkline(slowestTimes(records)))
+	}
+
+	indexPath := filepath.Join(*outDir, "index.md")
+	err = writeFileWithDir(indexPath, []byte(index.String()))
+	if err != nil {
+		return err
+	}
+
+	slog.Info("docs written", slog.String("index", indexPath), slog.Int("pages", len(status.Files)))
+	return nil
+}
+
+// renderFileDoc は 1 つの verification file のページを組み立てる。records は古い順の履歴
+func renderFileDoc(st fileStatus, records []*historyRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", st.File)
+
+	if st.ProblemURL != "" {
+		title := st.ProblemURL
+		metadata, err := loadProblemMetadata(st.ProblemURL)
+		if err != nil {
+			slog.Warn("failed to load problem metadata", slog.String("file", st.File), slog.Any("error", err))
+		} else {
+			title = fmt.Sprintf("%s %s", metadata.ProblemID, metadata.Title)
+		}
+		fmt.Fprintf(&b, "- Problem: [%s](%s)\n", title, st.ProblemURL)
+	}
+	fmt.Fprintf(&b, "- Status: %s\n", st.Status)
+	if st.Reason != "" {
+		fmt.Fprintf(&b, "- Reason: %s\n", strings.ReplaceAll(st.Reason, "\n", " "))
+	}
+
+	if len(records) == 0 {
+		b.WriteString("\nNot verified yet.\n")
+		return b.String()
+	}
+
+	latest := records[len(records)-1]
+	fmt.Fprintf(&b, "\n## Cases (%s)\n\n", latest.StartedAt.Format(time.DateTime))
+	b.WriteString("| Case | Status | Time | Average |\n|---|---|---|---|\n")
+	for _, c := range latest.Cases {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", c.Name, c.Status, formatExecTime(c.ExecTime), formatExecTime(averageTimeOfCase(records, c.Name)))
+	}
+
+	b.WriteString("\n## History\n\n")
+	fmt.Fprintf(&b, "Slowest case time per run: `%s`\n\n", sparkline(slowestTimes(records)))
+	b.WriteString("| Run | Result | Slowest |\n|---|---|---|\n")
+	recent := records[max(0, len(records)-docsHistoryRuns):]
+	for _, r := range slices.Backward(recent) {
+		summary := r.summary()
+		fmt.Fprintf(&b, "| %s | %s | %s (%s) |\n", r.StartedAt.Format(time.DateTime), summary.verdict(), formatExecTime(summary.slowestTime), summary.slowestTestcaseName)
+	}
+
+	return b.String()
+}
+
+// averageTimeOfCase は履歴の中でジャッジされた name のケースの平均実行時間を返す
+func averageTimeOfCase(records []*historyRecord, name string) time.Duration {
+	var total time.Duration
+	var count int
+	for _, r := range records {
+		for _, c := range r.Cases {
+			if status, _ := parseRunStatus(c.Status); c.Name != name || !status.judged() {
+				continue
+			}
+			total += c.ExecTime
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+func slowestTimes(records []*historyRecord) []time.Duration {
+	times := make([]time.Duration, 0, len(records))
+	for _, r := range records {
+		times = append(times, r.summary().slowestTime)
+	}
+	return times
+}
+
+func formatExecTime(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond / 10).String()
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline は values を最小値から最大値までの高さのブロックで並べる
+func sparkline(values []time.Duration) string {
+	if len(values) == 0 {
+		return "-"
+	}
+
+	lo, hi := slices.Min(values), slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int(int64(v-lo) * int64(len(sparkBlocks)-1) / int64(hi-lo))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultDownloadJobs は同時にダウンロードするケースの数の既定値。
+// 実際にジャッジへ同時に送るリクエストの数と頻度は、ホストごとの politeness が抑える
+const defaultDownloadJobs = 4
+
+type downloadOptions struct {
+	// refresh が true ならキャッシュされた header を使わない
+	refresh   bool
+	headerTTL time.Duration
+	// samples が正なら入力サイズの小さい順に samples 個のケースだけをダウンロードする
+	samples int
+	// sources は順に試すテストケースの取得元
+	sources []testcaseSource
+	// stats が nil でなければキャッシュの効き具合を記録する
+	stats *downloadStats
+	// strictSpace が true ならディスクの空きが足りないときにダウンロードを始めない
+	strictSpace bool
+	// jobs は同時にダウンロードするケースの数。0 なら defaultDownloadJobs
+	jobs int
+}
+
+// downloadTestcases は problemURL のテストケースのうちキャッシュに無いものをダウンロードし、キャッシュディレクトリを返す
+func downloadTestcases(ctx context.Context, problemURL string, opts *downloadOptions) (string, error) {
+	err := registerProblemCacheDir(problemURL)
+	if err != nil {
+		return "", err
+	}
+
+	// キャッシュが揃っていてダウンロードしなかったときも、使ったことを記録する
+	defer markCacheUsed(filepath.Dir(constructCacheDirPath(problemURL)))
+
+	if u, err := url.Parse(problemURL); err == nil && u.Host == libraryCheckerHost {
+		// Library Checker はテストケースを配布していないので、generator から生成する
+		return downloadLibraryCheckerTestcases(ctx, problemURL, opts)
+	}
+
+	problemID, err := extractProblemID(problemURL)
+	if err != nil {
+		return "", err
+	}
+
+	sources := testcaseSourcesFor(problemURL, opts.sources)
+
+	headerCachePath := constructHeaderCachePath(problemURL)
+	testcasesHeaderResponse, ok := loadCachedTestcasesHeader(headerCachePath, opts.headerTTL)
+	stats := opts.stats
+	if stats == nil {
+		stats = &downloadStats{}
+	}
+	stats.headerCached = ok && !opts.refresh
+	if !stats.headerCached {
+		testcasesHeaderResponse, err = fetchHeaderFromSources(ctx, sources, problemID)
+		if err != nil {
+			return "", err
+		}
+
+		err = saveTestcasesHeaderCache(headerCachePath, testcasesHeaderResponse)
+		if err != nil {
+			slog.Warn("failed to cache testcase header", slog.Any("error", err))
+		}
+	}
+
+	cacheDir := constructCacheDirPath(problemURL)
+
+	// 新しい問題や非公開の問題では header にケースが 1 つも無いことがある
+	if len(testcasesHeaderResponse.Headers) == 0 {
+		if opts.samples <= 0 {
+			errMsg := message(msgNoTestcasesOnJudge, problemID)
+			return "", errors.New(errMsg)
+		}
+
+		err := downloadSampleTestcases(ctx, sources, problemID, cacheDir)
+		if err != nil {
+			return "", err
+		}
+		return cacheDir, nil
+	}
+
+	multiErr := &multiError{}
+
+	headers := testcasesHeaderResponse.Headers
+	if opts.samples > 0 {
+		headers = smallestHeaders(headers, opts.samples)
+	}
+
+	// header の大きさから必要な容量を見積もって、途中でディスクが一杯にならないか確かめる
+	var needed int64
+	for _, h := range headers {
+		if !isTestcaseCached(cacheDir, h.Name) {
+			needed += int64(h.InputSize) + int64(h.OutputSize)
+		}
+	}
+	err = checkDiskSpace(cacheDir, needed, opts.strictSpace)
+	if err != nil {
+		return "", err
+	}
+
+	jobs := opts.jobs
+	if jobs <= 0 {
+		jobs = defaultDownloadJobs
+	}
+
+	// アクセスの間隔と同時接続数は judgeTransport がホストごとの politeness に従って抑えるので、
+	// ここでは待っている間に次のケースの取得や保存を進められるように並べるだけにする
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, jobs)
+	)
+	for _, h := range headers {
+		if isTestcaseCached(cacheDir, h.Name) {
+			stats.cachedCases++
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			testcase, err := fetchTestcaseFromSources(ctx, sources, problemID, h)
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, errTruncatedTestcase) {
+				// 切り詰められたケースで WA にならないように保存しない
+				warnStrict("skipped truncated testcase", slog.String("testcase", h.Name), slog.Any("error", err))
+				return
+			}
+			if err == nil {
+				err = saveTestcase(cacheDir, h.Name, testcase)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				multiErr.add(phaseDownload, h.Name, err)
+				return
+			}
+			stats.fetchedCases++
+			stats.fetchedBytes += int64(len(testcase.In) + len(testcase.Out))
+		}()
+	}
+	wg.Wait()
+
+	if err := multiErr.errOrNil(); err != nil {
+		return "", err
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("download aborted: %w", context.Cause(ctx))
+	}
+
+	err = recordCaseTimeLimits(cacheDir, headers)
+	if err != nil {
+		return "", err
+	}
+
+	// サンプルだけのときは header の一部しか見ていないので比べられない
+	if opts.samples <= 0 {
+		warnStaleCases(cacheDir, headers)
+	}
+
+	return cacheDir, nil
+}
+
+// warnStaleCases はジャッジの header から消えたのにキャッシュに残っているケースを警告する。
+// 差し替えられる前の古いケースで verify していることになるので、-strict では失敗にする
+func warnStaleCases(cacheDir string, headers []*header) {
+	inFilepaths, err := aojCaseSchema.listCachedInputs(cacheDir)
+	if err != nil {
+		slog.Warn("failed to list cached testcases", slog.Any("error", err))
+		return
+	}
+
+	listed := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		listed[h.Name] = true
+	}
+	for _, inFilepath := range inFilepaths {
+		name := filepath.Base(aojCaseSchema.caseName(inFilepath))
+		if !listed[name] {
+			warnStrict("cached testcase is no longer listed by the judge; `clean -problem` drops it", slog.String("testcase", name))
+		}
+	}
+}
+
+// testcaseSourcesFor は problemURL のテストケースを取得するときに試す取得元を返す
+func testcaseSourcesFor(problemURL string, sources []testcaseSource) []testcaseSource {
+	if u, err := url.Parse(problemURL); err == nil && u.Host == yukicoderHost {
+		// -sources は AOJ の取得元の指定なので、yukicoder の問題には使わない
+		return []testcaseSource{&yukicoderSource{}}
+	}
+	return sources
+}
+
+// fetchHeaderFromSources は sources を順に試して最初に取得できた header を返す
+func fetchHeaderFromSources(ctx context.Context, sources []testcaseSource, problemID string) (*testcasesHeaderResponse, error) {
+	var errs error
+	for _, source := range sources {
+		header, err := source.fetchHeader(ctx, problemID)
+		if err == nil {
+			err = header.validate(problemID)
+		}
+		if err == nil {
+			return header, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		slog.Warn("failed to fetch testcase header; trying next source", slog.String("source", source.String()), slog.Any("error", err))
+		errs = errors.Join(errs, fmt.Errorf("%s: %w", source, err))
+	}
+
+	return nil, fmt.Errorf("failed to fetch testcase header from any source: %w", errs)
+}
+
+// fetchTestcaseFromSources は sources を順に試して最初に取得できたテストケースを返す
+func fetchTestcaseFromSources(ctx context.Context, sources []testcaseSource, problemID string, h *header) (*testcase, error) {
+	var errs error
+	for _, source := range sources {
+		testcase, err := source.fetchTestcase(ctx, problemID, h)
+		if err == nil {
+			err = testcase.validate(problemID, h)
+		}
+		if err == nil {
+			return testcase, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		slog.Warn("failed to fetch testcase; trying next source", slog.String("source", source.String()), slog.String("testcase", h.Name), slog.Any("error", err))
+		errs = errors.Join(errs, fmt.Errorf("%s: %w", source, err))
+	}
+
+	return nil, errs
+}
+
+// downloadSampleTestcases は問題文のサンプルケースを sample1, sample2, ... として保存する
+func downloadSampleTestcases(ctx context.Context, sources []testcaseSource, problemID, cacheDir string) error {
+	var errs error
+	for _, source := range sources {
+		ss, ok := source.(sampleSource)
+		if !ok {
+			continue
+		}
+
+		samples, err := ss.fetchSamples(ctx, problemID)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", source, err))
+			continue
+		}
+		if len(samples) == 0 {
+			continue
+		}
+
+		for i, sample := range samples {
+			err := saveTestcase(cacheDir, fmt.Sprintf("sample%d", i+1), sample)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errMsg := fmt.Sprintf("no testcases nor sample cases are available for %s", problemID)
+	if errs != nil {
+		return fmt.Errorf("%s: %w", errMsg, errs)
+	}
+	return errors.New(errMsg)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runDownload はテストケースのダウンロードだけを行う。引数には問題の URL か verification file を渡す
+func runDownload(args []string) error {
+	fset := flag.NewFlagSet("download", flag.ExitOnError)
+	refresh := fset.Bool("refresh", false, "ignore the cached testcase header and fetch it again")
+	headerTTL := fset.Duration("header-ttl", time.Hour, "how long the cached testcase header stays valid")
+	samplesOnly := fset.Bool("samples-only", false, "download only the smallest cases")
+	samples := fset.Int("samples", 3, "number of cases downloaded by -samples-only")
+	sourcesSpec := fset.String("sources", "aoj", "ordered testcase sources to try: aoj, a mirror URL with the judgedat layout, or dir:path")
+	strictSpace := fset.Bool("strict-space", false, "abort instead of warning when the cache volume lacks room for the testcases")
+	politenessSpec := fset.String("politeness", "", "per-judge request interval (or rate like 2/s), concurrency and burst, e.g. judgedat.u-aizu.ac.jp=3s:1,judge.yosupo.jp=4/s:4:8")
+	downloadJobs := fset.Int("download-jobs", defaultDownloadJobs, "number of cases downloaded concurrently; requests to each judge are still limited by -politeness")
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	if fset.NArg() == 0 {
+		return errors.New("usage: aoj-verify download [flags] <problem url|file>...")
+	}
+
+	overrides, err := parsePolitenessOverrides(*politenessSpec)
+	if err != nil {
+		return err
+	}
+	judgeTransport.setOverrides(overrides)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	prepareFirstRun()
+
+	err = migrateCache()
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range fset.Args() {
+		problemURL, spec := arg, *sourcesSpec
+		if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+			annotation, err := readAnnotationInFile(arg)
+			if err != nil {
+				return err
+			}
+			problemURL = annotation.ProblemURL
+			if annotation.TestcaseSources != "" {
+				spec = annotation.TestcaseSources
+			}
+		}
+
+		sources, err := parseTestcaseSources(spec)
+		if err != nil {
+			return err
+		}
+
+		opts := &downloadOptions{
+			refresh:     *refresh,
+			headerTTL:   *headerTTL,
+			sources:     sources,
+			stats:       &downloadStats{},
+			strictSpace: *strictSpace,
+			jobs:        *downloadJobs,
+		}
+		if *samplesOnly {
+			opts.samples = *samples
+		}
+
+		donePhase := profilePhase(ctx, profileDownload)
+		cacheDir, err := downloadTestcases(ctx, problemURL, opts)
+		donePhase()
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		slog.Info("downloaded", slog.String("problem", problemURL), slog.String("dir", cacheDir), slog.String("bytes", formatBytes(opts.stats.fetchedBytes)))
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// echoTerminal は解答への入力と解答の出力を、行ごとに接頭辞を付けて 1 つの出力先に交互に書く (case -echo-io)。
+// パーサが入力のどこでずれたかを、入力と出力を並べて見られるようにする
+type echoTerminal struct {
+	w io.Writer
+
+	mu sync.Mutex
+	// open は行の途中まで書いた echoStream。別のストリームが書くときは先に改行する
+	open *echoStream
+}
+
+// echoStream は echoTerminal に prefix を付けて書く片方の流れ
+type echoStream struct {
+	term   *echoTerminal
+	prefix []byte
+}
+
+func newEchoTerminal(w io.Writer) *echoTerminal {
+	return &echoTerminal{w: w}
+}
+
+func (t *echoTerminal) stream(prefix string) *echoStream {
+	return &echoStream{term: t, prefix: []byte(prefix)}
+}
+
+func (s *echoStream) Write(p []byte) (int, error) {
+	n := len(p)
+	t := s.term
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b bytes.Buffer
+	if t.open != nil && t.open != s {
+		b.WriteByte('\n')
+		t.open = nil
+	}
+	for len(p) > 0 {
+		if t.open == nil {
+			b.Write(s.prefix)
+			t.open = s
+		}
+		line, rest, found := bytes.Cut(p, []byte{'\n'})
+		b.Write(line)
+		if found {
+			b.WriteByte('\n')
+			t.open = nil
+		}
+		p = rest
+	}
+
+	_, err := t.w.Write(b.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// close は最後の行が改行で終わっていなければ改行する
+func (t *echoTerminal) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.open != nil {
+		io.WriteString(t.w, "\n")
+		t.open = nil
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// environmentInfo は実行時間などを後から解釈・再現するための実行環境の情報
+type environmentInfo struct {
+	ToolVersion string `json:"toolVersion"`
+	// ToolCommit と ToolBuildDate はユーザーからの報告を調べたり、キャッシュの互換性を確かめたりするのに使う
+	ToolCommit    string `json:"toolCommit,omitempty"`
+	ToolBuildDate string `json:"toolBuildDate,omitempty"`
+	GoVersion     string `json:"goVersion"`
+	GxxVersion    string `json:"gxxVersion,omitempty"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	CPU           string `json:"cpu,omitempty"`
+}
+
+func collectEnvironmentInfo() *environmentInfo {
+	tool := currentBuildMetadata()
+	return &environmentInfo{
+		ToolVersion:   tool.Version,
+		ToolCommit:    tool.Commit,
+		ToolBuildDate: tool.BuildDate,
+		GoVersion:     commandVersion("go", "version"),
+		GxxVersion:    commandVersion("g++", "--version"),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		CPU:           cpuModel(),
+	}
+}
+
+// toolVersion は aoj-verify 自身のバージョンを返す
+func toolVersion() string {
+	return currentBuildMetadata().Version
+}
+
+// commandVersion はコマンドのバージョン表示の 1 行目を返す。コマンドが無ければ空文字を返す
+func commandVersion(name string, args ...string) string {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	first, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(first)
+}
+
+func cpuModel() string {
+	switch runtime.GOOS {
+	case "linux":
+		f, err := os.Open("/proc/cpuinfo")
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if ok && strings.TrimSpace(key) == "model name" {
+				return strings.TrimSpace(value)
+			}
+		}
+		return ""
+
+	case "darwin":
+		return commandVersion("sysctl", "-n", "machdep.cpu.brand_string")
+
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/matumoto1234/aoj-verify/cassette"
+)
+
+const (
+	phaseDownload = "download"
+	phaseJudge    = "judge"
+)
+
+// caseError はどのフェーズ・どのテストケースで起きたエラーかを保持する
+type caseError struct {
+	phase    string
+	testcase string
+	err      error
+}
+
+func (e *caseError) Error() string {
+	return fmt.Sprintf("[%s] %s: %v", e.phase, e.testcase, e.err)
+}
+
+func (e *caseError) Unwrap() error {
+	return e.err
+}
+
+// multiError は複数の caseError をまとめたもの。Error() ではフェーズごとにまとめて表示する
+type multiError struct {
+	errs []*caseError
+}
+
+func (m *multiError) add(phase, testcase string, err error) {
+	m.errs = append(m.errs, &caseError{phase: phase, testcase: testcase, err: err})
+}
+
+// errOrNil はエラーが 1 つも無ければ nil を返す
+func (m *multiError) errOrNil() error {
+	if m == nil || len(m.errs) == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *multiError) Error() string {
+	var phases []string
+	byPhase := make(map[string][]*caseError)
+	for _, e := range m.errs {
+		if _, ok := byPhase[e.phase]; !ok {
+			phases = append(phases, e.phase)
+		}
+		byPhase[e.phase] = append(byPhase[e.phase], e)
+	}
+
+	var b strings.Builder
+	b.WriteString(message(msgErrorsOccurred, len(m.errs)))
+	for _, phase := range phases {
+		fmt.Fprintf(&b, "\n[%s]", phase)
+		for _, e := range byPhase[phase] {
+			msg := strings.ReplaceAll(e.err.Error(), "\n", "\n    ")
+			fmt.Fprintf(&b, "\n  %s: %s", e.testcase, msg)
+		}
+	}
+
+	return b.String()
+}
+
+func (m *multiError) Unwrap() []error {
+	errs := make([]error, 0, len(m.errs))
+	for _, e := range m.errs {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// 終了コード。CI がインフラの失敗だけを自動で再試行できるように、解答の失敗と分ける
+const (
+	exitOK = 0
+	// exitFailure は解答が WA などで落ちたり、アノテーションが間違っていたりしたとき
+	exitFailure = 1
+	// exitInfra はネットワークやディスク、ツールチェインなど環境の問題で verify できなかったとき
+	exitInfra = 3
+)
+
+// infraError は解答ではなく環境の問題による失敗であることを明示する
+type infraError struct {
+	err error
+}
+
+func (e *infraError) Error() string {
+	return e.err.Error()
+}
+
+func (e *infraError) Unwrap() error {
+	return e.err
+}
+
+// isInfraError は err がネットワークの不調やディスクの不足、コンパイラが無いなど環境の問題によるものかを返す
+func isInfraError(err error) bool {
+	var infraErr *infraError
+	// syscall.Errno も net.Error を満たしてしまうので、ネットワークのエラーは具体的な型で見る
+	var urlErr *url.Error
+	var opErr *net.OpError
+	var schemaErr *schemaError
+	var apiErr *apiError
+	switch {
+	case errors.Is(err, cassette.ErrNotRecorded):
+		// 記録していないリクエストは何度やり直しても失敗する。http.Client が url.Error で包むので先に見る
+		return false
+	case errors.As(err, &infraErr):
+		return true
+	case errors.As(err, &apiErr):
+		// やり直しても失敗したサーバ側の不調だけを環境の問題とし、存在しない問題などは含めない
+		return apiErr.code >= 500 || apiErr.code == http.StatusTooManyRequests
+	case errors.As(err, &urlErr), errors.As(err, &opErr):
+		return true
+	case errors.As(err, &schemaErr):
+		// ジャッジが壊れた応答を返した
+		return true
+	case errors.Is(err, exec.ErrNotFound):
+		return true
+	case errors.Is(err, syscall.ENOSPC):
+		return true
+	}
+	return false
+}
+
+// exitCode は err に応じた終了コードを返す
+func exitCode(err error) int {
+	var stepErr *bisectStepError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &stepErr):
+		return stepErr.code
+	case isInfraError(err):
+		return exitInfra
+	default:
+		return exitFailure
+	}
+}
+
+// failureKind はサマリーに出すための失敗の種類を返す
+func failureKind(err error) string {
+	if isInfraError(err) {
+		return "infrastructure"
+	}
+	if errors.Is(err, errNotRun) {
+		return "not run"
+	}
+	var strictErr *strictError
+	if errors.As(err, &strictErr) {
+		return "strict"
+	}
+	return "solution"
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// unmarshalByExt は path の拡張子で形式を決めて body を v に読み込む。
+// YAML と TOML は一度 JSON に直してから読むので、キーは JSON と同じ名前 (json タグ) を使う
+func unmarshalByExt(path string, body []byte, v any) error {
+	switch filepath.Ext(path) {
+	case ".json":
+		return json.Unmarshal(body, v)
+	case ".yaml", ".yml":
+		var doc any
+		err := yaml.Unmarshal(body, &doc)
+		if err != nil {
+			return err
+		}
+		return unmarshalViaJSON(doc, v)
+	case ".toml":
+		var doc map[string]any
+		err := toml.Unmarshal(body, &doc)
+		if err != nil {
+			return err
+		}
+		return unmarshalViaJSON(doc, v)
+	default:
+		errMsg := fmt.Sprintf("unknown file format: %s (use .json, .toml, .yaml or .yml)", path)
+		return errors.New(errMsg)
+	}
+}
+
+// unmarshalViaJSON は YAML や TOML から読んだ値を JSON に直して v に読み込む。
+// 構造体ごとに別のタグを書かずに済み、json.Unmarshaler を実装した型もそのまま使える
+func unmarshalViaJSON(doc any, v any) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to convert to JSON: %w", err)
+	}
+	return json.Unmarshal(body, v)
+}
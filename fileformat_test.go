@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalByExtConfig(t *testing.T) {
+	tests := []struct {
+		path string
+		body string
+	}{
+		{
+			path: ".aoj-verify.json",
+			body: `{
+  "cacheDir": ".cache",
+  "buildTags": ["aoj"],
+  "checkerCompilers": {".cpp": ["g++", "-O2"]},
+  "maxTime": "10s",
+  "politeness": "judgedat.u-aizu.ac.jp=1s:2",
+  "ignore": ["vendor/**"],
+  "credentials": {"yukicoder.me": {"tokenEnv": "YUKICODER_TOKEN"}},
+  "comparators": [{"problems": ["CGL_*"], "pipeline": ["strip-trailing-ws", "float-eps(1e-9)"]}]
+}`,
+		},
+		{
+			path: ".aoj-verify.yaml",
+			body: `cacheDir: .cache
+buildTags: [aoj]
+checkerCompilers:
+  .cpp: [g++, -O2]
+maxTime: 10s
+politeness: judgedat.u-aizu.ac.jp=1s:2
+ignore: ["vendor/**"]
+credentials:
+  yukicoder.me:
+    tokenEnv: YUKICODER_TOKEN
+comparators:
+  - problems: ["CGL_*"]
+    pipeline: [strip-trailing-ws, float-eps(1e-9)]
+`,
+		},
+		{
+			path: ".aoj-verify.toml",
+			body: `cacheDir = ".cache"
+buildTags = ["aoj"]
+maxTime = "10s"
+politeness = "judgedat.u-aizu.ac.jp=1s:2"
+ignore = ["vendor/**"]
+
+[checkerCompilers]
+".cpp" = ["g++", "-O2"]
+
+[credentials."yukicoder.me"]
+tokenEnv = "YUKICODER_TOKEN"
+
+[[comparators]]
+problems = ["CGL_*"]
+pipeline = ["strip-trailing-ws", "float-eps(1e-9)"]
+`,
+		},
+	}
+
+	var want *projectConfig
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := &projectConfig{}
+			err := unmarshalByExt(tt.path, []byte(tt.body), got)
+			if err != nil {
+				t.Fatalf("unmarshalByExt: %v", err)
+			}
+			if err := got.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+
+			// 最初の JSON を基準に、どの形式でも同じ設定になることを確かめる
+			if want == nil {
+				if got.CacheDir != ".cache" || len(got.Credentials) != 1 || len(got.Comparators) != 1 {
+					t.Fatalf("config from %s = %+v", tt.path, got)
+				}
+				want = got
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("config from %s = %+v, want %+v", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalByExtErrors(t *testing.T) {
+	tests := []struct {
+		path string
+		body string
+	}{
+		{path: "manifest.yaml", body: "entries: ["},
+		{path: "manifest.toml", body: "entries = ["},
+		{path: "manifest.json", body: "{"},
+		// 型が合わないものは JSON に直してから読むときに失敗する
+		{path: "manifest.yaml", body: "entries: 1"},
+		{path: "manifest.ini", body: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := unmarshalByExt(tt.path, []byte(tt.body), &manifest{})
+			if err == nil {
+				t.Errorf("unmarshalByExt(%s, %q) succeeded", tt.path, tt.body)
+			}
+		})
+	}
+}
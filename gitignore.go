@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreEntry は .gitignore に追記する workDir のエントリ
+func gitignoreEntry() string {
+	return filepath.ToSlash(workDir) + "/"
+}
+
+// ensureGitignored は git リポジトリの .gitignore に workDir が無ければ追記する。
+// confirm が false を返した場合は何もしない
+func ensureGitignored(confirm func(question string) bool) error {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		// git リポジトリでなければ何もしない
+		return nil
+	}
+	gitignorePath := filepath.Join(strings.TrimSpace(string(out)), ".gitignore")
+
+	body, err := os.ReadFile(gitignorePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read .gitignore: %w", err)
+	}
+
+	for line := range strings.Lines(string(body)) {
+		entry := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(line), "/"), "/")
+		if entry == filepath.ToSlash(workDir) {
+			return nil
+		}
+	}
+
+	if !confirm(message(msgConfirmGitignore, gitignoreEntry(), gitignorePath)) {
+		slog.Warn("cache dir is not gitignored; testcases may be committed by accident", slog.String("entry", gitignoreEntry()))
+		return nil
+	}
+
+	entry := gitignoreEntry() + "\n"
+	if len(body) > 0 && !strings.HasSuffix(string(body), "\n") {
+		entry = "\n" + entry
+	}
+
+	f, err := os.OpenFile(gitignorePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open .gitignore: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry)
+	if err != nil {
+		return fmt.Errorf("failed to write .gitignore: %w", err)
+	}
+
+	slog.Info("added to .gitignore", slog.String("entry", gitignoreEntry()), slog.String("path", gitignorePath))
+	return nil
+}
+
+// confirmOnTerminal は標準入力が端末のときだけ y/N を尋ねる。端末でなければ false を返す
+func confirmOnTerminal(question string) bool {
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// runInit はリポジトリで aoj-verify を使い始めるための準備をする
+func runInit(args []string) error {
+	fset := flag.NewFlagSet("init", flag.ExitOnError)
+	yes := fset.Bool("yes", false, "update .gitignore without asking")
+	fset.Parse(args)
+
+	confirm := confirmOnTerminal
+	if *yes {
+		confirm = func(string) bool { return true }
+	}
+
+	return ensureGitignored(confirm)
+}
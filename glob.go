@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob は filepath.Match に加えて "**" (0 個以上のディレクトリ) を扱えるマッチを行う。
+// パスの区切りは "/" に正規化して比較する
+func matchGlob(pattern, name string) (bool, error) {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	name = filepath.ToSlash(filepath.Clean(name))
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(patterns, names []string) (bool, error) {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				ok, err := matchSegments(patterns[1:], names[i:])
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(names) == 0 {
+			return false, nil
+		}
+
+		ok, err := path.Match(patterns[0], names[0])
+		if err != nil || !ok {
+			return false, err
+		}
+
+		patterns, names = patterns[1:], names[1:]
+	}
+
+	return len(names) == 0, nil
+}
+
+// matchAnyGlob は patterns のどれかに name がマッチするかを返す
+func matchAnyGlob(patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		ok, err := matchGlob(p, name)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// hasGlobMeta は pattern がワイルドカードを含むかを返す
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// expandGlob は pattern にマッチするファイルを名前順で返す。
+// シェルが "**" を展開しない環境でも同じように使えるように、自前でディレクトリをたどる。隠しディレクトリは見ない
+func expandGlob(pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+
+	// ワイルドカードを含まない先頭の部分からたどり始める
+	i := 0
+	for i < len(segments)-1 && !hasGlobMeta(segments[i]) {
+		i++
+	}
+	root := "."
+	if i > 0 {
+		root = filepath.FromSlash(strings.Join(segments[:i], "/"))
+		if segments[0] == "" {
+			// 絶対パス
+			root = string(filepath.Separator) + root
+		}
+	}
+
+	if !existsFileOrDir(root) {
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ok, err := matchGlob(pattern, p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*.go", name: "a.go", want: true},
+		{pattern: "*.go", name: "dir/a.go", want: false},
+		{pattern: "dir/*.go", name: "dir/a.go", want: true},
+		{pattern: "**/*.go", name: "a.go", want: true},
+		{pattern: "**/*.go", name: "x/y/z/a.go", want: true},
+		{pattern: "x/**/a.go", name: "x/a.go", want: true},
+		{pattern: "x/**/a.go", name: "x/y/z/a.go", want: true},
+		{pattern: "x/**/a.go", name: "y/a.go", want: false},
+		{pattern: "x/**", name: "x/y/a.go", want: true},
+		{pattern: "./x/*.go", name: "x/a.go", want: true},
+		{pattern: "x/a?.go", name: "x/ab.go", want: true},
+		{pattern: "x/[ab].go", name: "x/c.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			got, err := matchGlob(tt.pattern, tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := matchGlob("x/[.go", "x/a.go"); err == nil {
+		t.Error("matchGlob with a malformed pattern succeeded")
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, f := range []string{"a.go", "b.txt", "lib/c.go", "lib/deep/d.go", "lib/deep/e_test.go", ".hidden/f.go", "lib/.git/g.go"} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "*.go", want: []string{"a.go"}},
+		// 隠しディレクトリの下は見ない
+		{pattern: "**/*.go", want: []string{"a.go", "lib/c.go", "lib/deep/d.go", "lib/deep/e_test.go"}},
+		{pattern: "lib/**/*_test.go", want: []string{"lib/deep/e_test.go"}},
+		{pattern: "lib/*.go", want: []string{"lib/c.go"}},
+		{pattern: "**/*.rs", want: nil},
+		{pattern: "missing/**/*.go", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := expandGlob(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandGlob(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// historyRecord は 1 ファイル分の verify 結果。history.jsonl に 1 行ずつ追記される
+type historyRecord struct {
+	File       string    `json:"file"`
+	ProblemURL string    `json:"problemUrl"`
+	StartedAt  time.Time `json:"startedAt"`
+	// SamplesOnly は一部のケースだけを対象にした run かどうか
+	SamplesOnly bool             `json:"samplesOnly,omitempty"`
+	Environment *environmentInfo `json:"environment,omitempty"`
+	// SourceHash は verify したときのソースと依存しているパッケージのハッシュ
+	SourceHash string `json:"sourceHash,omitempty"`
+	// Label は -label で付けた run の名前
+	Label string `json:"label,omitempty"`
+	// RunID は同じ実行で verify したファイルに共通の ID
+	RunID string        `json:"runId,omitempty"`
+	Cases []historyCase `json:"cases"`
+}
+
+type historyCase struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// ExecTime は JSON ではミリ秒の execTimeMs になる
+	ExecTime time.Duration `json:"-"`
+	// ExitCode は解答の終了コード。シグナルで止められたときは -1 で、実行しなかったケースには無い
+	ExitCode *int `json:"exitCode,omitempty"`
+}
+
+// historyCaseJSON は historyCase の JSON での形
+type historyCaseJSON struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	ExecTimeMs float64 `json:"execTimeMs"`
+	// ExecTime は以前の形式の、単位を書いていないナノ秒。読むときだけ使う
+	ExecTime *time.Duration `json:"execTime,omitempty"`
+	ExitCode *int           `json:"exitCode,omitempty"`
+}
+
+func (c historyCase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(historyCaseJSON{
+		Name:       c.Name,
+		Status:     c.Status,
+		ExecTimeMs: float64(c.ExecTime) / float64(time.Millisecond),
+		ExitCode:   c.ExitCode,
+	})
+}
+
+func (c *historyCase) UnmarshalJSON(data []byte) error {
+	var v historyCaseJSON
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	*c = historyCase{
+		Name:     v.Name,
+		Status:   v.Status,
+		ExecTime: time.Duration(math.Round(v.ExecTimeMs * float64(time.Millisecond))),
+		ExitCode: v.ExitCode,
+	}
+	if v.ExecTime != nil {
+		c.ExecTime = *v.ExecTime
+	}
+	return nil
+}
+
+func historyFilePath() string {
+	return filepath.Join(workDir, "history.jsonl")
+}
+
+func appendHistory(record *historyRecord) error {
+	path := historyFilePath()
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	return nil
+}
+
+// loadHistory は file に関する履歴を古い順に返す。履歴が無ければ空を返す
+func loadHistory(file string) ([]*historyRecord, error) {
+	var records []*historyRecord
+	err := scanHistory(func(r *historyRecord) {
+		if r.File == file {
+			records = append(records, r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// loadLatestHistory はファイルごとに、全ケースを対象にした最新の履歴を返す
+func loadLatestHistory() (map[string]*historyRecord, error) {
+	latest := make(map[string]*historyRecord)
+	err := scanHistory(func(r *historyRecord) {
+		if r.SamplesOnly {
+			return
+		}
+		latest[filepath.Clean(r.File)] = r
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+// scanHistory は履歴を古い順に fn に渡す。壊れた行は読み飛ばす
+func scanHistory(fn func(r *historyRecord)) error {
+	f, err := os.Open(historyFilePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		r := &historyRecord{}
+		err := json.Unmarshal(scanner.Bytes(), r)
+		if err != nil {
+			continue
+		}
+		fn(r)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	return nil
+}
+
+// averageCaseTime は履歴中の全ケースの平均実行時間を返す。履歴が無ければ 0 を返す
+func averageCaseTime(records []*historyRecord) time.Duration {
+	var total time.Duration
+	var count int
+	for _, r := range records {
+		for _, c := range r.Cases {
+			if status, _ := parseRunStatus(c.Status); !status.judged() {
+				continue
+			}
+			total += c.ExecTime
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+func newHistoryRecord(file, problemURL string, startedAt time.Time, runResults []*runResult) *historyRecord {
+	record := &historyRecord{
+		File:       file,
+		ProblemURL: problemURL,
+		StartedAt:  startedAt,
+	}
+	for _, r := range runResults {
+		record.Cases = append(record.Cases, historyCase{
+			Name:     filepath.Base(r.testcaseName),
+			Status:   r.status.String(),
+			ExecTime: r.execTime,
+			ExitCode: r.exitCode,
+		})
+	}
+	return record
+}
+
+// orderByHistory は過去に失敗した割合が高いケース、遅いケースの順に inFilepaths を並べ替える。
+// 履歴に無いケースは元の順序のまま後ろに回す
+func orderByHistory(inFilepaths []string, records []*historyRecord) {
+	type caseStat struct {
+		runs     int
+		failures int
+		total    time.Duration
+	}
+
+	stats := make(map[string]*caseStat)
+	for _, r := range records {
+		for _, c := range r.Cases {
+			if status, _ := parseRunStatus(c.Status); !status.judged() {
+				continue
+			}
+			st, ok := stats[c.Name]
+			if !ok {
+				st = &caseStat{}
+				stats[c.Name] = st
+			}
+			st.runs++
+			st.total += c.ExecTime
+			if c.Status != accepted.String() {
+				st.failures++
+			}
+		}
+	}
+
+	if len(stats) == 0 {
+		return
+	}
+
+	statOf := func(inFilepath string) *caseStat {
+		base := filepath.Base(inFilepath)
+		return stats[strings.TrimSuffix(base, filepath.Ext(base))]
+	}
+
+	slices.SortStableFunc(inFilepaths, func(a, b string) int {
+		sa, sb := statOf(a), statOf(b)
+		switch {
+		case sa == nil && sb == nil:
+			return 0
+		case sa == nil:
+			return 1
+		case sb == nil:
+			return -1
+		}
+
+		// 失敗率の降順 (sa.failures/sa.runs > sb.failures/sb.runs)
+		if c := cmp.Compare(sb.failures*sa.runs, sa.failures*sb.runs); c != 0 {
+			return c
+		}
+		// 平均実行時間の降順
+		return cmp.Compare(sb.total/time.Duration(sb.runs), sa.total/time.Duration(sa.runs))
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryCaseJSON(t *testing.T) {
+	c := historyCase{Name: "1", Status: "AC", ExecTime: 1234567 * time.Nanosecond}
+
+	body, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"execTimeMs":1.234567`) || strings.Contains(string(body), `"execTime"`) {
+		t.Errorf("marshaled %s, want execTimeMs in milliseconds only", body)
+	}
+
+	var got historyCase
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ExecTime != c.ExecTime {
+		t.Errorf("round trip ExecTime = %v, want %v", got.ExecTime, c.ExecTime)
+	}
+
+	// 以前の history.jsonl はナノ秒を execTime に書いていた
+	if err := json.Unmarshal([]byte(`{"name":"1","status":"AC","execTime":1234567}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ExecTime != c.ExecTime {
+		t.Errorf("legacy ExecTime = %v, want %v", got.ExecTime, c.ExecTime)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// runHistory は history 以下のサブコマンドを実行する
+func runHistory(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: aoj-verify history compare [flags] <before> <after>")
+	}
+
+	switch args[0] {
+	case "compare":
+		return runHistoryCompare(args[1:])
+	default:
+		errMsg := fmt.Sprintf("unknown history subcommand: %s", args[0])
+		return errors.New(errMsg)
+	}
+}
+
+// runHistoryCompare は -label で名前を付けた 2 つの run を、ファイルごと・ケースごとの実行時間の差の表にする。
+// 書き換えの前後で verify して性能を比べる使い方を手作業の比較に頼らずにできるようにする
+func runHistoryCompare(args []string) error {
+	fset := flag.NewFlagSet("history compare", flag.ExitOnError)
+	file := fset.String("file", "", "compare only runs of this verification file")
+	fset.Parse(args)
+
+	if fset.NArg() != 2 {
+		return errors.New("usage: aoj-verify history compare [flags] <before> <after>")
+	}
+	before, after := fset.Arg(0), fset.Arg(1)
+
+	// ファイルごとに、それぞれのラベルが付いた最新の run を比べる
+	befores := make(map[string]*historyRecord)
+	afters := make(map[string]*historyRecord)
+	err := scanHistory(func(r *historyRecord) {
+		f := filepath.Clean(r.File)
+		if *file != "" && f != filepath.Clean(*file) {
+			return
+		}
+		switch r.Label {
+		case before:
+			befores[f] = r
+		case after:
+			afters[f] = r
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for f := range afters {
+		if _, ok := befores[f]; ok {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		errMsg := fmt.Sprintf("no verification file has runs labeled both %q and %q", before, after)
+		return errors.New(errMsg)
+	}
+	slices.Sort(files)
+
+	for i, f := range files {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		err := printHistoryComparison(os.Stdout, f, befores[f], afters[f])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printHistoryComparison は 1 ファイル分の比較の表を書き出す。ケースは after の順に並べ、before にしか無いケースは後ろに回す
+func printHistoryComparison(w io.Writer, file string, before, after *historyRecord) error {
+	fmt.Fprintf(w, "%s (%s → %s)\n", file, before.StartedAt.Format(time.DateTime), after.StartedAt.Format(time.DateTime))
+
+	beforeCases := make(map[string]historyCase)
+	for _, c := range before.Cases {
+		beforeCases[c.Name] = c
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "CASE\t%s\t%s\tDELTA\n", before.Label, after.Label)
+
+	var beforeTotal, afterTotal time.Duration
+	seen := make(map[string]bool)
+	for _, a := range after.Cases {
+		seen[a.Name] = true
+		b, ok := beforeCases[a.Name]
+		if !ok {
+			fmt.Fprintf(tw, "%s\t-\t%s\t-\n", a.Name, formatHistoryCase(a))
+			continue
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Name, formatHistoryCase(b), formatHistoryCase(a), formatTimeDelta(b.ExecTime, a.ExecTime))
+		beforeTotal += b.ExecTime
+		afterTotal += a.ExecTime
+	}
+	for _, b := range before.Cases {
+		if !seen[b.Name] {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\n", b.Name, formatHistoryCase(b))
+		}
+	}
+
+	// 合計は両方の run にあるケースだけで比べる
+	fmt.Fprintf(tw, "total\t%s\t%s\t%s\n", formatExecTime(beforeTotal), formatExecTime(afterTotal), formatTimeDelta(beforeTotal, afterTotal))
+
+	return tw.Flush()
+}
+
+// formatHistoryCase はケースの実行時間を、AC でなければ結果と一緒に表す
+func formatHistoryCase(c historyCase) string {
+	if c.Status == accepted.String() {
+		return formatExecTime(c.ExecTime)
+	}
+	return fmt.Sprintf("%s %s", formatExecTime(c.ExecTime), c.Status)
+}
+
+// formatTimeDelta は before から after への変化を "+1.2ms (+10.0%)" の形で表す
+func formatTimeDelta(before, after time.Duration) string {
+	delta := (after - before).Round(time.Millisecond / 10)
+	sign := "+"
+	if delta < 0 {
+		sign = ""
+	}
+	if before == 0 {
+		return sign + delta.String()
+	}
+	return fmt.Sprintf("%s%s (%+.1f%%)", sign, delta, float64(after-before)/float64(before)*100)
+}
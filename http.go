@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/matumoto1234/aoj-verify/cassette"
+)
+
+// cassetteEnv に "record:dir" か "replay:dir" を指定すると、ジャッジとのやりとりを記録・再生する。
+// ネットワーク無しで downloader から verify までを通して動かすために使う。テストは testdata/cassettes に記録したものを再生する
+const cassetteEnv = "AOJ_VERIFY_CASSETTE"
+
+var judgeTransport = newPoliteTransport(http.DefaultTransport)
+
+// httpClient はジャッジの API を呼ぶときに使うクライアント
+var httpClient = &http.Client{Transport: judgeTransport}
+
+// configureCassette は cassetteEnv の指定に従って httpClient の transport を差し替える
+func configureCassette() error {
+	spec := os.Getenv(cassetteEnv)
+	if spec == "" {
+		return nil
+	}
+
+	t, err := cassette.ParseSpec(spec)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", cassetteEnv, err)
+	}
+
+	switch t.Mode {
+	case cassette.Replay:
+		// 再生するだけなので間隔を空ける必要はない
+		httpClient.Transport = t
+	case cassette.Record:
+		t.Base = judgeTransport.base
+		judgeTransport.base = t
+	}
+
+	return nil
+}
+
+const (
+	// httpRetries は一時的な失敗のときに httpGet がリクエストをやり直す回数
+	httpRetries = 3
+	// httpBackoffBase は最初にやり直すまでの待ち時間の目安。やり直すたびに倍にする
+	httpBackoffBase = time.Second
+	httpBackoffMax  = 30 * time.Second
+)
+
+// httpGet は url を GET する。接続の失敗や 5xx などの一時的な失敗なら、間隔を指数的に広げながらやり直す
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := httpGetOnce(ctx, url)
+		reason := transientHTTPFailure(resp, err)
+		if reason == "" || attempt == httpRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := httpBackoff(attempt, resp)
+		if resp != nil {
+			// 接続を使い回せるように本文を読み捨ててから閉じる
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		slog.Warn("transient failure; retrying", slog.String("url", url), slog.String("reason", reason), slog.Int("attempt", attempt+1), slog.Duration("wait", wait))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// transientHTTPFailure はやり直せば成功しうる失敗なら、その理由を返す
+func transientHTTPFailure(resp *http.Response, err error) string {
+	if err != nil {
+		var dnsErr *net.DNSError
+		var opErr *net.OpError
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return ""
+		case errors.As(err, &dnsErr):
+			// 存在しないホストはやり直しても見つからない
+			if dnsErr.IsTimeout || dnsErr.IsTemporary {
+				return err.Error()
+			}
+			return ""
+		case errors.As(err, &opErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+			return err.Error()
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return err.Error()
+		}
+		return ""
+	}
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return resp.Status
+	}
+	return ""
+}
+
+// httpBackoff は attempt 回目の失敗の後に待つ時間を返す。
+// 同時に失敗したリクエストが揃ってやり直さないように、半分はランダムにずらす。Retry-After があればそれに従う
+func httpBackoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, httpBackoffMax)
+		}
+	}
+
+	d := min(httpBackoffBase<<attempt, httpBackoffMax)
+	return d/2 + rand.N(d/2+1)
+}
+
+// httpGetOnce は url を 1 回だけ GET する
+func httpGetOnce(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth := projectCfg.authorization(req.URL.Hostname()); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return httpClient.Do(req)
+}
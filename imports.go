@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// externalImport は標準ライブラリ以外の import を表す
+type externalImport struct {
+	path string
+	// inModule はファイルと同じ module 内のパッケージかどうか
+	inModule bool
+}
+
+// findExternalImports は filename が import している標準ライブラリ以外のパッケージを返す。
+// AOJ には標準ライブラリしか無いので、これらは提出時に同梱する必要がある
+func findExternalImports(filename string) ([]externalImport, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	modulePath, err := findModulePath(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	var imports []externalImport
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if path == "C" || isStandardImportPath(path) {
+			continue
+		}
+
+		inModule := modulePath != "" && (path == modulePath || strings.HasPrefix(path, modulePath+"/"))
+		imports = append(imports, externalImport{path: path, inModule: inModule})
+	}
+
+	return imports, nil
+}
+
+// isStandardImportPath は cmd/go と同じく、最初の要素にドットを含まないパスを標準ライブラリとみなす
+func isStandardImportPath(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// findModulePath は dir から親方向に go.mod を探して module パスを返す。見つからなければ空文字を返す
+func findModulePath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		f, err := os.Open(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			defer f.Close()
+
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				// "module" の後ろは空白で区切られている。modulex のような行は別物
+				fields := strings.Fields(scanner.Text())
+				if len(fields) >= 2 && fields[0] == "module" {
+					return strings.Trim(fields[1], `"`), nil
+				}
+			}
+			return "", scanner.Err()
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// warnExternalImports は提出時に AOJ で利用できない import を警告する
+func warnExternalImports(filename string) {
+	imports, err := findExternalImports(filename)
+	if err != nil {
+		slog.Warn("failed to inspect imports", slog.String("file", filename), slog.Any("error", err))
+		return
+	}
+
+	for _, imp := range imports {
+		if imp.inModule {
+			slog.Warn("package is not available on AOJ; submit the output of `aoj-verify bundle`", slog.String("file", filename), slog.String("import", imp.path))
+		} else {
+			slog.Warn("third-party package is not available on AOJ; submit the output of `aoj-verify bundle` if it is pure Go", slog.String("file", filename), slog.String("import", imp.path))
+		}
+	}
+}
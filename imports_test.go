@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindModulePath(t *testing.T) {
+	tests := []struct {
+		name  string
+		gomod string
+		want  string
+	}{
+		{name: "plain", gomod: "module example.com/a\n\ngo 1.24\n", want: "example.com/a"},
+		{name: "quoted", gomod: "module \"example.com/a\"\n", want: "example.com/a"},
+		{name: "trailing comment", gomod: "module example.com/a // lib\n", want: "example.com/a"},
+		{name: "not a module line", gomod: "modulex example.com/x\nmodule example.com/a\n", want: "example.com/a"},
+		{name: "no module line", gomod: "go 1.24\n", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(tt.gomod), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := findModulePath(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("findModulePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
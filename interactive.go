@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matumoto1234/aoj-verify/stopwatch"
+)
+
+// runInteractiveCase は解答とジャッジのプログラムを双方向のパイプでつないで実行し、ジャッジの終了コードで判定する。
+// ジャッジは `judge <input> <output>` の形で呼び、解答の標準出力を標準入力で受け取り、標準出力に書いたものが解答の標準入力になる。
+// 終了コードが 0 でなければ WA とし、標準エラー出力をその理由にする。やり取りは transcript として tmpDir に書き出す
+func runInteractiveCase(ctx context.Context, runArgs []string, judgePath string, files *testcaseFiles, tmpDir string, opts *runCaseOptions) (*runResult, error) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if opts.timeLimit > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeoutCause(runCtx, opts.timeLimit, errTimeLimitExceeded)
+		defer cancelTimeout()
+	}
+
+	transcriptFile, err := os.Create(filepath.Join(tmpDir, "transcript"+rand.Text()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript file: %w", err)
+	}
+	defer transcriptFile.Close()
+	transcript := &transcript{w: transcriptFile}
+
+	solutionCmd := exec.CommandContext(runCtx, runArgs[0], runArgs[1:]...)
+	solutionStderr := &cappedBuffer{limit: stderrCaptureLimit}
+	solutionCmd.Stderr = solutionStderr
+	solutionCmd.WaitDelay = time.Second
+	judgeCmd := exec.CommandContext(runCtx, judgePath, files.input, files.output)
+	var judgeMessage bytes.Buffer
+	judgeCmd.Stderr = &judgeMessage
+
+	solutionIn, solutionOut, err := pipes(solutionCmd)
+	if err != nil {
+		return nil, err
+	}
+	judgeIn, judgeOut, err := pipes(judgeCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var stopwatch stopwatch.Stopwatch
+	stopwatch.Start()
+
+	err = solutionCmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start solution: %w", err)
+	}
+	err = judgeCmd.Start()
+	if err != nil {
+		solutionCmd.Process.Kill()
+		solutionCmd.Wait()
+		return nil, fmt.Errorf("failed to start interactive judge: %w", err)
+	}
+
+	// 片方が終わったら相手の標準入力を閉じて、読み続けて止まらないようにする
+	toJudge, toSolution := transcript.writer("> "), transcript.writer("< ")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		relay(judgeIn, solutionOut, toJudge)
+	}()
+	go func() {
+		defer wg.Done()
+		relay(solutionIn, judgeOut, toSolution)
+	}()
+	wg.Wait()
+
+	solutionErr := solutionCmd.Wait()
+	judgeErr := judgeCmd.Wait()
+	elapsed := stopwatch.Elapsed()
+	transcript.flush()
+
+	result := newRunResult(files.name, unknown, elapsed)
+	result.answerFilepath = transcriptFile.Name()
+	result.interactive = true
+	result.stderr = solutionStderr.String()
+	result.exitCode = processExitCode(solutionCmd.ProcessState)
+
+	var exitErr *exec.ExitError
+	switch {
+	case (solutionErr != nil || judgeErr != nil) && ctx.Err() != nil:
+		result.status = notRun
+	case errors.Is(context.Cause(runCtx), errTimeLimitExceeded):
+		result.status = timeLimitExceeded
+		result.timeout = &timeoutDetail{limit: opts.timeLimit, killed: true}
+	case judgeErr != nil && !errors.As(judgeErr, &exitErr):
+		return nil, fmt.Errorf("failed to run interactive judge: %w", judgeErr)
+	case judgeErr != nil:
+		// 解答が途中で終わってもジャッジが判定を出せるので、ジャッジの判定を優先する
+		result.status = wrongAnswer
+		result.checkerMessage = strings.TrimSpace(judgeMessage.String())
+	case solutionErr != nil:
+		result.status = runtimeError
+	case opts.timeLimit > 0 && elapsed > opts.timeLimit:
+		result.status = timeLimitExceeded
+	default:
+		result.status = accepted
+	}
+
+	return result, nil
+}
+
+func pipes(cmd *exec.Cmd) (io.WriteCloser, io.ReadCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	return stdin, stdout, nil
+}
+
+// relay は src を dst と記録に流し、src が終わったら dst を閉じる。
+// 相手が先に終わって dst に書けなくなっても、src の書き手が止まらないように読み続ける
+func relay(dst io.WriteCloser, src io.Reader, record io.Writer) {
+	_, err := io.Copy(io.MultiWriter(record, dst), src)
+	if err != nil {
+		io.Copy(record, src)
+	}
+	dst.Close()
+}
+
+// transcript はインタラクティブな問題でのやり取りを、向きを表す接頭辞付きで 1 行ずつ記録する
+type transcript struct {
+	mu      sync.Mutex
+	w       io.Writer
+	writers []*transcriptWriter
+}
+
+func (t *transcript) writer(prefix string) *transcriptWriter {
+	tw := &transcriptWriter{t: t, prefix: prefix}
+	t.writers = append(t.writers, tw)
+	return tw
+}
+
+// flush は改行で終わっていない最後の行を書き出す
+func (t *transcript) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tw := range t.writers {
+		if len(tw.pending) > 0 {
+			fmt.Fprintf(t.w, "%s%s\n", tw.prefix, tw.pending)
+			tw.pending = nil
+		}
+	}
+}
+
+type transcriptWriter struct {
+	t       *transcript
+	prefix  string
+	pending []byte
+}
+
+func (tw *transcriptWriter) Write(p []byte) (int, error) {
+	tw.t.mu.Lock()
+	defer tw.t.mu.Unlock()
+
+	tw.pending = append(tw.pending, p...)
+	for {
+		i := bytes.IndexByte(tw.pending, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintf(tw.t.w, "%s%s\n", tw.prefix, tw.pending[:i])
+		tw.pending = tw.pending[i+1:]
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// supportedJudge は PROBLEM に書ける URL の形式
+type supportedJudge struct {
+	name    string
+	host    string
+	example string
+	// schema はテストケースを構成するファイルの決まり
+	schema *caseSchema
+}
+
+// supportedJudges は対応しているジャッジの一覧。extractProblemID で扱えるホストと揃える
+var supportedJudges = []supportedJudge{
+	{name: "AOJ (legacy)", host: "judge.u-aizu.ac.jp", example: "https://judge.u-aizu.ac.jp/onlinejudge/description.jsp?id=ALDS1_14_A", schema: aojCaseSchema},
+	{name: "AOJ", host: "onlinejudge.u-aizu.ac.jp", example: "https://onlinejudge.u-aizu.ac.jp/courses/lesson/1/ALDS1/14/ALDS1_14_A", schema: aojCaseSchema},
+	{name: "yukicoder", host: yukicoderHost, example: "https://yukicoder.me/problems/no/1", schema: aojCaseSchema},
+	{name: "Library Checker", host: libraryCheckerHost, example: "https://judge.yosupo.jp/problem/aplusb", schema: aojCaseSchema},
+}
+
+// caseSchemaForURL は problemURL のジャッジのケースの決まりを返す。分からなければ AOJ のものを返す
+func caseSchemaForURL(problemURL string) *caseSchema {
+	u, err := url.Parse(problemURL)
+	if err != nil {
+		return aojCaseSchema
+	}
+	for _, j := range supportedJudges {
+		if j.host == u.Host {
+			return j.schema
+		}
+	}
+	return aojCaseSchema
+}
+
+// unsupportedURLMessage は対応していない URL について、近いホストがあればそれを挙げつつ書ける形式を案内する
+func unsupportedURLMessage(problemURL, host string) string {
+	var b strings.Builder
+	b.WriteString(message(msgUnsupportedURL, problemURL))
+
+	if j, ok := closestJudge(host); ok {
+		b.WriteString("\n" + message(msgDidYouMean, j.host, j.example))
+	}
+
+	b.WriteString("\n" + message(msgSupportedJudges))
+	for _, j := range supportedJudges {
+		fmt.Fprintf(&b, "\n  %-14s %s", j.name, j.example)
+	}
+
+	return b.String()
+}
+
+// closestJudge は host の打ち間違いとみなせるほど近いホストのジャッジを返す
+func closestJudge(host string) (supportedJudge, bool) {
+	host = strings.ToLower(strings.TrimPrefix(host, "www."))
+
+	best, bestDistance := supportedJudge{}, -1
+	for _, j := range supportedJudges {
+		d := editDistance(host, j.host)
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = j, d
+		}
+	}
+
+	// ホストの長さの 1/4 までの違いなら打ち間違いとみなす (e.g. judge.u-aizu.jp)
+	if bestDistance < 0 || bestDistance > len(best.host)/4 {
+		return supportedJudge{}, false
+	}
+	return best, true
+}
+
+// editDistance は a と b のレーベンシュタイン距離を返す
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
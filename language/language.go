@@ -0,0 +1,163 @@
+// Package language は verification file の言語ごとのコメント記号と、ビルド・実行のコマンドを扱う
+package language
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Language struct {
+	Name string `json:"-"`
+	// Extensions はこの言語のソースの拡張子 (e.g. ".java")
+	Extensions []string `json:"extensions"`
+	// Comment は行コメントの書き出し。アノテーションはこれに続けて書く。空なら "//"
+	Comment string `json:"comment,omitempty"`
+	// Compile はビルドのコマンドのテンプレート。空ならビルドせずに Run を実行する
+	Compile string `json:"compile,omitempty"`
+	// Run は実行のコマンドのテンプレート。空なら {bin} を実行する
+	Run string `json:"run,omitempty"`
+	// TimeFactor が正ならジャッジの制限時間にこれを掛ける
+	TimeFactor float64 `json:"timeFactor,omitempty"`
+}
+
+// Vars はコマンドのテンプレートに埋め込む値
+type Vars struct {
+	// Src は verification file、Srcs は SOURCES も含めたビルドに渡す全てのファイル
+	Src  string
+	Srcs []string
+	// Bin はビルドの出力先、Dir はビルドの成果物を置いてよい一時ディレクトリ
+	Bin string
+	Dir string
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{[a-z]*\}`)
+
+var knownPlaceholders = []string{"{src}", "{srcs}", "{bin}", "{dir}"}
+
+// Validate は l の設定に誤りがあればその理由を返す
+func (l *Language) Validate() error {
+	if len(l.Extensions) == 0 {
+		errMsg := fmt.Sprintf("language %s has no extensions", l.Name)
+		return errors.New(errMsg)
+	}
+	for _, ext := range l.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			errMsg := fmt.Sprintf("extension %q of language %s must start with a dot", ext, l.Name)
+			return errors.New(errMsg)
+		}
+	}
+
+	if l.Compile == "" && l.Run == "" {
+		errMsg := fmt.Sprintf("language %s needs compile or run", l.Name)
+		return errors.New(errMsg)
+	}
+
+	for _, template := range []string{l.Compile, l.Run} {
+		for _, p := range placeholderRegexp.FindAllString(template, -1) {
+			if !slices.Contains(knownPlaceholders, p) {
+				errMsg := fmt.Sprintf("unknown placeholder %s in language %s (available: %s)", p, l.Name, strings.Join(knownPlaceholders, ", "))
+				return errors.New(errMsg)
+			}
+		}
+		if !isWholeField(template, "{srcs}") {
+			errMsg := fmt.Sprintf("{srcs} must be a separate argument in language %s", l.Name)
+			return errors.New(errMsg)
+		}
+	}
+
+	return nil
+}
+
+func isWholeField(template, placeholder string) bool {
+	for _, field := range strings.Fields(template) {
+		if strings.Contains(field, placeholder) && field != placeholder {
+			return false
+		}
+	}
+	return true
+}
+
+// CommentPrefix は行コメントの書き出しを返す
+func (l *Language) CommentPrefix() string {
+	if l.Comment == "" {
+		return "//"
+	}
+	return l.Comment
+}
+
+// HasTemplates は Compile か Run が設定されているかを返す。
+// 設定されていない言語は、呼び出し側がビルドの仕方を知っている組み込みの言語
+func (l *Language) HasTemplates() bool {
+	return l.Compile != "" || l.Run != ""
+}
+
+// CompileCommand は v を埋め込んだビルドのコマンドを返す。ビルドが要らなければ nil を返す
+func (l *Language) CompileCommand(v Vars) []string {
+	if l.Compile == "" {
+		return nil
+	}
+	return expand(l.Compile, v)
+}
+
+// RunCommand は v を埋め込んだ実行のコマンドを返す
+func (l *Language) RunCommand(v Vars) []string {
+	if l.Run == "" {
+		return []string{v.Bin}
+	}
+	return expand(l.Run, v)
+}
+
+// expand は template を空白で区切り、それぞれにプレースホルダの値を埋め込む。
+// シェルは通さないので、値に空白が含まれていても 1 つの引数のままになる
+func expand(template string, v Vars) []string {
+	r := strings.NewReplacer("{src}", v.Src, "{bin}", v.Bin, "{dir}", v.Dir)
+
+	var args []string
+	for _, field := range strings.Fields(template) {
+		if field == "{srcs}" {
+			args = append(args, v.Srcs...)
+			continue
+		}
+		args = append(args, r.Replace(field))
+	}
+	return args
+}
+
+// Registry は拡張子から言語を引く
+type Registry struct {
+	byName map[string]*Language
+	byExt  map[string]*Language
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]*Language),
+		byExt:  make(map[string]*Language),
+	}
+}
+
+// Register は l を登録する。同じ名前の言語があれば置き換え、同じ拡張子は後から登録したものを優先する
+func (r *Registry) Register(l *Language) {
+	if old, ok := r.byName[l.Name]; ok {
+		for _, ext := range old.Extensions {
+			if r.byExt[ext] == old {
+				delete(r.byExt, ext)
+			}
+		}
+	}
+
+	r.byName[l.Name] = l
+	for _, ext := range l.Extensions {
+		r.byExt[ext] = l
+	}
+}
+
+// Lookup は filename の拡張子の言語を返す
+func (r *Registry) Lookup(filename string) (*Language, bool) {
+	l, ok := r.byExt[filepath.Ext(filename)]
+	return l, ok
+}
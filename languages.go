@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/matumoto1234/aoj-verify/language"
+)
+
+// 組み込みの言語。ビルドの仕方は buildGoSolution, buildCppSolution が知っている
+var (
+	goLanguage  = &language.Language{Name: "go", Extensions: []string{".go"}}
+	cppLanguage = &language.Language{Name: "cpp", Extensions: []string{".cpp", ".cc", ".cxx"}}
+)
+
+// languages は拡張子から verification file の言語を引く。設定ファイルの languages で言語を足したり組み込みの言語を置き換えたりできる
+var languages = newLanguageRegistry()
+
+func newLanguageRegistry() *language.Registry {
+	r := language.NewRegistry()
+	r.Register(goLanguage)
+	r.Register(cppLanguage)
+	return r
+}
+
+// lookupLanguage は filename の言語を返す。知らない拡張子なら Go として扱う
+func lookupLanguage(filename string) *language.Language {
+	l, ok := languages.Lookup(filename)
+	if !ok {
+		return goLanguage
+	}
+	return l
+}
+
+// buildWithTemplates は設定ファイルで定義された言語の解答をビルドし、実行するコマンドを返す
+func buildWithTemplates(lang *language.Language, buildFilenames []string, binaryFilepath string, expanded map[string]string) ([]string, error) {
+	vars, err := languageVars(buildFilenames, binaryFilepath)
+	if err != nil {
+		return nil, err
+	}
+	// プレースホルダを展開したソースがあればそちらを渡す
+	for i, src := range vars.Srcs {
+		if dst, ok := expanded[src]; ok {
+			vars.Srcs[i] = dst
+		}
+	}
+	vars.Src = vars.Srcs[0]
+
+	if args := lang.CompileCommand(vars); len(args) > 0 {
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+
+		err := cmd.Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build %s file: %w\n%s", lang.Name, err, stderr.String())
+		}
+	}
+
+	runArgs := lang.RunCommand(vars)
+	if len(runArgs) == 0 {
+		errMsg := fmt.Sprintf("run command of language %s is empty", lang.Name)
+		return nil, errors.New(errMsg)
+	}
+	slog.Debug("built", slog.String("language", lang.Name), slog.Any("run", runArgs))
+
+	return runArgs, nil
+}
+
+// languageVars はコマンドのテンプレートに埋め込む値を作る。実行するディレクトリによらないようにパスは絶対パスにする
+func languageVars(buildFilenames []string, binaryFilepath string) (language.Vars, error) {
+	var srcs []string
+	for _, f := range buildFilenames {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return language.Vars{}, fmt.Errorf("failed to resolve source path: %w", err)
+		}
+		srcs = append(srcs, abs)
+	}
+
+	return language.Vars{
+		Src:  srcs[0],
+		Srcs: srcs,
+		Bin:  binaryFilepath,
+		Dir:  filepath.Dir(binaryFilepath),
+	}, nil
+}
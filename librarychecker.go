@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const (
+	libraryCheckerHost = "judge.yosupo.jp"
+	// libraryCheckerRepoURL はテストケースの generator とチェッカーがあるリポジトリ。Library Checker はテストケースを配布していないので、手元で生成する
+	libraryCheckerRepoURL = "https://github.com/yosupo06/library-checker-problems"
+)
+
+func libraryCheckerRepoPath() string {
+	return filepath.Join(workDir, "library-checker-problems")
+}
+
+// bundledCheckerPath は cacheDir のケースに付属するチェッカーのバイナリのパスを返す。
+// Library Checker のようにジャッジがチェッカーを配布している場合だけ存在する
+func bundledCheckerPath(cacheDir string) string {
+	return filepath.Join(filepath.Dir(cacheDir), "checker")
+}
+
+// downloadLibraryCheckerTestcases は library-checker-problems を取得して problemURL のケースを生成し、キャッシュディレクトリにコピーする。
+// 生成には git と python3、C++ コンパイラが必要
+func downloadLibraryCheckerTestcases(ctx context.Context, problemURL string, opts *downloadOptions) (string, error) {
+	problemID, err := extractProblemID(problemURL)
+	if err != nil {
+		return "", err
+	}
+
+	cacheDir := constructCacheDirPath(problemURL)
+	stats := opts.stats
+	if stats == nil {
+		stats = &downloadStats{}
+	}
+
+	inFilepaths, err := aojCaseSchema.listInputs(cacheDir)
+	if err == nil && len(inFilepaths) > 0 && existsFileOrDir(bundledCheckerPath(cacheDir)) && !opts.refresh {
+		stats.cachedCases = len(inFilepaths)
+		return cacheDir, nil
+	}
+
+	repo := libraryCheckerRepoPath()
+	err = updateLibraryCheckerRepo(ctx, repo, opts.refresh)
+	if err != nil {
+		return "", err
+	}
+
+	problemDir, err := findLibraryCheckerProblem(repo, problemID)
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("generating testcases", slog.String("problem", problemID), slog.String("dir", problemDir))
+	err = runInDir(ctx, repo, "python3", "generate.py", "-p", problemID)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate testcases: %w", err)
+	}
+
+	generated, err := aojCaseSchema.listInputs(filepath.Join(problemDir, "in"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list generated testcases: %w", err)
+	}
+	if len(generated) == 0 {
+		errMsg := fmt.Sprintf("generate.py produced no testcases for %s", problemID)
+		return "", errors.New(errMsg)
+	}
+
+	err = os.MkdirAll(cacheDir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	for _, inFilepath := range generated {
+		name := aojCaseSchema.caseName(filepath.Base(inFilepath))
+		outFilepath := filepath.Join(problemDir, "out", name+".out")
+
+		err := saveTestcaseFiles(cacheDir, name, inFilepath, outFilepath)
+		if err != nil {
+			return "", fmt.Errorf("failed to save testcase: %w", err)
+		}
+		stats.fetchedCases++
+	}
+
+	// generate.py がビルドしたチェッカーをケースと一緒に置く
+	checker := bundledCheckerPath(cacheDir)
+	err = copyFile(filepath.Join(problemDir, "checker"), checker)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy checker: %w", err)
+	}
+	err = os.Chmod(checker, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = saveLibraryCheckerMetadata(problemURL, problemID, problemDir)
+	if err != nil {
+		slog.Warn("failed to save problem metadata", slog.Any("error", err))
+	}
+
+	return cacheDir, nil
+}
+
+// updateLibraryCheckerRepo は repo が無ければ clone し、refresh なら最新にする
+func updateLibraryCheckerRepo(ctx context.Context, repo string, refresh bool) error {
+	if !existsFileOrDir(repo) {
+		slog.Info("cloning library-checker-problems", slog.String("url", libraryCheckerRepoURL))
+		err := runInDir(ctx, ".", "git", "clone", "--depth", "1", libraryCheckerRepoURL, repo)
+		if err != nil {
+			return &infraError{err: fmt.Errorf("failed to clone library-checker-problems: %w", err)}
+		}
+		return nil
+	}
+
+	if refresh {
+		err := runInDir(ctx, repo, "git", "pull", "--ff-only")
+		if err != nil {
+			return &infraError{err: fmt.Errorf("failed to update library-checker-problems: %w", err)}
+		}
+	}
+
+	return nil
+}
+
+// findLibraryCheckerProblem は <category>/<problemID>/info.toml を探し、問題のディレクトリを返す
+func findLibraryCheckerProblem(repo, problemID string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(repo, "*", problemID, "info.toml"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		errMsg := message(msgLibraryCheckerNotFound, problemID)
+		return "", errors.New(errMsg)
+	}
+
+	return filepath.Dir(matches[0]), nil
+}
+
+var (
+	infoTimeLimitRegexp = regexp.MustCompile(`(?m)^timelimit\s*=\s*([0-9.]+)`)
+	infoTitleRegexp     = regexp.MustCompile(`(?m)^title\s*=\s*['"](.*)['"]`)
+)
+
+// saveLibraryCheckerMetadata は info.toml の制限時間とタイトルを問題情報としてキャッシュする
+func saveLibraryCheckerMetadata(problemURL, problemID, problemDir string) error {
+	body, err := os.ReadFile(filepath.Join(problemDir, "info.toml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	metadata := &problemMetadata{ProblemID: problemID, Title: problemID, Category: filepath.Base(filepath.Dir(problemDir))}
+	if m := infoTitleRegexp.FindSubmatch(body); m != nil {
+		metadata.Title = string(m[1])
+	}
+	if m := infoTimeLimitRegexp.FindSubmatch(body); m != nil {
+		seconds, err := strconv.ParseFloat(string(m[1]), 64)
+		if err == nil {
+			metadata.TimeLimit = seconds
+		}
+	}
+
+	out, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(constructProblemMetadataCachePath(problemURL), out, 0644)
+}
+
+func runInDir(ctx context.Context, dir, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s: %w\n%s", name, err, stderr.String())
+	}
+	return nil
+}
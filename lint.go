@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// knownAnnotationKeys は lint が認識するキー
+var knownAnnotationKeys = map[string]bool{
+	"PROBLEM":          true,
+	"BUILD_TAGS":       true,
+	"TAGS":             true,
+	"TESTCASE_SOURCES": true,
+	"CHECKER":          true,
+	"SOURCES":          true,
+	"EXPECT":           true,
+	"SKIP_CASES":       true,
+	"TIME_LIMIT":       true,
+	"ERROR":            true,
+	"INTERACTIVE":      true,
+	"COMPARE":          true,
+	"DEFINE":           true,
+}
+
+// runLint は root 以下のアノテーションを検査し、誤りがあれば行番号付きで報告する。
+// 長い CI が途中で落ちる前に、書き間違いに気付けるようにする
+func runLint(args []string) error {
+	fset := flag.NewFlagSet("lint", flag.ExitOnError)
+	fset.BoolVar(&scanToolDirs, "scan-tool-dirs", false, "also search the cache, temporary directories and aoj-verify's own source")
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	root := "."
+	if fset.NArg() > 0 {
+		root = fset.Arg(0)
+	}
+
+	files, err := findFilesWithAnnotations(root)
+	if err != nil {
+		return fmt.Errorf("failed to find annotated files: %w", err)
+	}
+
+	var diags annotationDiagnostics
+	for _, file := range files {
+		ds, err := lintFile(file)
+		if err != nil {
+			return err
+		}
+		diags = append(diags, ds...)
+	}
+
+	for _, d := range diags {
+		fmt.Fprintln(os.Stdout, d.String())
+	}
+
+	if len(diags) > 0 {
+		errMsg := message(msgLintProblems, len(diags), len(files))
+		return errors.New(errMsg)
+	}
+
+	fmt.Fprintln(os.Stdout, message(msgLintOK, len(files)))
+	return nil
+}
+
+// lintFile は filename のアノテーションの誤りを返す
+func lintFile(filename string) ([]annotationDiagnostic, error) {
+	body, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var diags []annotationDiagnostic
+
+	// 書式の誤りや重複は readAnnotationInFile が見つける
+	_, err = readAnnotationInFile(filename)
+	var ds annotationDiagnostics
+	switch {
+	case errors.As(err, &ds):
+		diags = append(diags, ds...)
+	case err != nil:
+		diags = append(diags, annotationDiagnostic{file: filename, line: 0, message: err.Error()})
+	}
+
+	prefix := annotationPrefix(filename)
+	lineNumber := 0
+	for line := range strings.Lines(string(body)) {
+		lineNumber++
+		if !isAnnotationComment(prefix, line) {
+			continue
+		}
+
+		key, value, err := parseAnnotationComment(prefix, strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			continue
+		}
+
+		msg := lintAnnotationValue(filename, key, value)
+		if msg != "" {
+			diags = append(diags, annotationDiagnostic{file: filename, line: lineNumber, message: msg})
+		}
+	}
+
+	return diags, nil
+}
+
+// lintAnnotationValue は key の値が正しくなければその理由を返す
+func lintAnnotationValue(filename, key, value string) string {
+	if !knownAnnotationKeys[key] {
+		return fmt.Sprintf("unknown annotation key %s", key)
+	}
+
+	switch key {
+	case "PROBLEM":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Sprintf("malformed problem url %q", value)
+		}
+		id, err := extractProblemID(value)
+		if err != nil {
+			return err.Error()
+		}
+		if id == "" {
+			return fmt.Sprintf("no problem id in url %q", value)
+		}
+
+	case "TESTCASE_SOURCES":
+		_, err := parseTestcaseSources(value)
+		if err != nil {
+			return err.Error()
+		}
+
+	case "SOURCES":
+		if value == "" {
+			return "SOURCES annotation requires at least one file"
+		}
+		a := &Annotation{Sources: splitList(value)}
+		for _, path := range a.sourceFiles(filename)[1:] {
+			if !existsFileOrDir(path) {
+				return fmt.Sprintf("source %s does not exist", path)
+			}
+		}
+
+	case "CHECKER", "INTERACTIVE":
+		if value == "" {
+			return fmt.Sprintf("%s annotation requires a path", key)
+		}
+		path := resolveAnnotationPath(filename, value)
+		if !existsFileOrDir(path) {
+			return fmt.Sprintf("%s %s does not exist", strings.ToLower(key), path)
+		}
+	}
+
+	return ""
+}
+
+// findFilesWithAnnotations は root 以下からアノテーションを 1 つでも含むファイルを探す。
+// PROBLEM を書き忘れたファイルも検査できるように、findAnnotatedFiles と違ってキーは問わない
+func findFilesWithAnnotations(root string) ([]string, error) {
+	defer profilePhase(context.Background(), profileWalk)()
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && projectCfg.ignored(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if walkSkipToolDir(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(body, []byte(annotationPrefix(path))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// runList は verification file の一覧を問題のタイトルやカテゴリと一緒に表示する
+func runList(args []string) error {
+	fset := flag.NewFlagSet("list", flag.ExitOnError)
+	tagFilter := fset.String("tag", "", "comma-separated list of TAGS; list only files that have one of them")
+	coverage := fset.Bool("coverage", false, "list library packages and the verification files that exercise them")
+	fset.Parse(args)
+
+	root := "."
+	if fset.NArg() > 0 {
+		root = fset.Arg(0)
+	}
+
+	files, err := findAnnotatedFiles(root)
+	if err != nil {
+		return fmt.Errorf("failed to find verification files: %w", err)
+	}
+
+	if *coverage {
+		return listCoverage(root, files)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tPROBLEM\tTITLE\tCATEGORY\tTAGS")
+
+	for _, file := range files {
+		annotation, err := readAnnotationInFile(file)
+		if err != nil {
+			slog.Warn("failed to read annotation", slog.String("file", file), slog.Any("error", err))
+			continue
+		}
+		if !annotation.hasAnyTag(splitList(*tagFilter)) {
+			continue
+		}
+
+		metadata, err := loadProblemMetadata(annotation.ProblemURL)
+		if err != nil {
+			slog.Warn("failed to load problem metadata", slog.String("file", file), slog.Any("error", err))
+			problemID, _ := extractProblemID(annotation.ProblemURL)
+			metadata = &problemMetadata{ProblemID: problemID, Category: problemCategory(problemID)}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", file, metadata.ProblemID, metadata.Title, metadata.Category, strings.Join(annotation.Tags, ","))
+	}
+
+	return w.Flush()
+}
+
+// listCoverage はライブラリのパッケージごとに、それを使っている verification file を表示する
+func listCoverage(root string, verificationFiles []string) error {
+	coverages, err := computePackageCoverage(root, verificationFiles)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tVERIFIED BY")
+
+	var uncovered int
+	for _, c := range coverages {
+		verifiedBy := strings.Join(c.verifiedBy, ",")
+		if len(c.verifiedBy) == 0 {
+			verifiedBy = "-"
+			uncovered++
+		}
+		fmt.Fprintf(w, "%s\t%s\n", c.dir, verifiedBy)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "\n%s\n", message(msgUncoveredPackages, uncovered, len(coverages)))
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/matumoto1234/aoj-verify/render"
+)
+
+// newLiveDiffWriter は解答の出力を書き込まれた端から 1 行ずつ、期待される出力と左右に並べて w に表示する。
+// 食い違った行は強調するので、無限ループや出力順の誤りを実行中に見つけられる
+func newLiveDiffWriter(w io.Writer, testcase string, expected io.Reader, color bool) *render.DiffWriter {
+	fmt.Fprintf(w, "== %s ==\n", testcase)
+	return render.NewDiffWriter(w, expected, render.Options{Color: color})
+}
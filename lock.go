@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const defaultLockfilePath = "aoj-verify.lock"
+
+// lockfile は問題ごとのテストケースのチェックサムを固定する。
+// ジャッジ側のテストケースが黙って差し替えられたことを検出するために使う
+type lockfile struct {
+	// Problems は problem URL → ケース名 → チェックサム
+	Problems map[string]map[string]caseChecksum `json:"problems"`
+}
+
+type caseChecksum struct {
+	In  string `json:"in"`
+	Out string `json:"out"`
+}
+
+// loadLockfile は path の lockfile を読む。ファイルが無ければ nil を返す
+func loadLockfile(path string) (*lockfile, error) {
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	lf := &lockfile{}
+	err = json.Unmarshal(body, lf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lockfile: %w", err)
+	}
+
+	return lf, nil
+}
+
+func (lf *lockfile) save(path string) error {
+	body, err := json.MarshalIndent(lf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+
+	err = os.WriteFile(path, append(body, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	return nil
+}
+
+// computeCaseChecksums はキャッシュされているテストケースの sha256 をケース名ごとに求める
+func computeCaseChecksums(cacheDir string, schema *caseSchema) (map[string]caseChecksum, error) {
+	inFilepaths, err := schema.listInputs(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[string]caseChecksum, len(inFilepaths))
+	for _, inFilepath := range inFilepaths {
+		files := schema.files(inFilepath)
+
+		in, err := sha256File(files.input)
+		if err != nil {
+			return nil, err
+		}
+		out, err := sha256File(files.output)
+		if err != nil {
+			return nil, err
+		}
+
+		checksums[filepath.Base(files.name)] = caseChecksum{In: in, Out: out}
+	}
+
+	return checksums, nil
+}
+
+// fetchCaseChecksums はキャッシュを使わずにジャッジから header と全ケースを取得し直して、その sha256 をケース名ごとに求める。
+// Library Checker はケースを配布していないので、generator で生成し直したものから求める
+func fetchCaseChecksums(ctx context.Context, problemURL string, sources []testcaseSource) (map[string]caseChecksum, error) {
+	if u, err := url.Parse(problemURL); err == nil && u.Host == libraryCheckerHost {
+		cacheDir, err := downloadTestcases(ctx, problemURL, &downloadOptions{refresh: true, sources: sources})
+		if err != nil {
+			return nil, err
+		}
+		return computeCaseChecksums(cacheDir, caseSchemaForURL(problemURL))
+	}
+
+	problemID, err := extractProblemID(problemURL)
+	if err != nil {
+		return nil, err
+	}
+
+	sources = testcaseSourcesFor(problemURL, sources)
+	resp, err := fetchHeaderFromSources(ctx, sources, problemID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Headers) == 0 {
+		errMsg := message(msgNoTestcasesOnJudge, problemID)
+		return nil, errors.New(errMsg)
+	}
+
+	checksums := make(map[string]caseChecksum, len(resp.Headers))
+	for _, h := range resp.Headers {
+		testcase, err := fetchTestcaseFromSources(ctx, sources, problemID, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch testcase %s: %w", h.Name, err)
+		}
+
+		// キャッシュに保存するときと同じ名前で記録する
+		checksums[sanitizeFilename(h.Name)] = caseChecksum{In: sha256String(testcase.In), Out: sha256String(testcase.Out)}
+	}
+
+	return checksums, nil
+}
+
+func sha256String(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256File(path string) (string, error) {
+	defer profilePhase(context.Background(), profileHash)()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = pooledCopy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksums はテストケースのチェックサム actual が lockfile に固定されたものと一致するか調べる。
+// partial が true (一部のケースだけをダウンロードした場合) なら、actual に無いケースは問題にしない
+func (lf *lockfile) verifyChecksums(problemURL string, actual map[string]caseChecksum, partial bool) error {
+	locked, ok := lf.Problems[problemURL]
+	if !ok {
+		return nil
+	}
+
+	var problems []string
+	for name, sum := range actual {
+		lockedSum, ok := locked[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: not in lockfile", name))
+		case lockedSum != sum:
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", name))
+		}
+	}
+	if !partial {
+		for name := range locked {
+			if _, ok := actual[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing from cache", name))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		errMsg := message(msgLockMismatch, problemURL, strings.Join(problems, "\n  "))
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+// runLock は verification file が参照する問題のテストケースをジャッジから取得し直し、そのチェックサムを lockfile に書き出す
+func runLock(args []string) error {
+	fset := flag.NewFlagSet("lock", flag.ExitOnError)
+	lockfilePath := fset.String("lockfile", defaultLockfilePath, "path of the lockfile to write")
+	fset.Parse(args)
+
+	root := "."
+	if fset.NArg() > 0 {
+		root = fset.Arg(0)
+	}
+
+	files, err := findAnnotatedFiles(root)
+	if err != nil {
+		return fmt.Errorf("failed to find verification files: %w", err)
+	}
+
+	lf := &lockfile{Problems: make(map[string]map[string]caseChecksum)}
+	for _, file := range files {
+		annotation, err := readAnnotationInFile(file)
+		if err != nil {
+			return err
+		}
+		if _, ok := lf.Problems[annotation.ProblemURL]; ok {
+			continue
+		}
+
+		sources, err := parseTestcaseSources(annotation.TestcaseSources)
+		if err != nil {
+			return err
+		}
+
+		// キャッシュが古くなっていても、ジャッジの今のケースを固定する
+		checksums, err := fetchCaseChecksums(context.Background(), annotation.ProblemURL, sources)
+		if err != nil {
+			return fmt.Errorf("failed to fetch checksums: %w", err)
+		}
+		lf.Problems[annotation.ProblemURL] = checksums
+	}
+
+	err = lf.save(*lockfilePath)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("lockfile written", slog.String("path", *lockfilePath), slog.Int("problems", len(lf.Problems)))
+	return nil
+}
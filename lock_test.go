@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeCaseChecksumsUsesSchema(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{"1.in": "1 2\n", "1.ans": "3\n", "1.hint": "ignored\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := computeCaseChecksums(dir, icpcCaseSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := caseChecksum{In: sha256String("1 2\n"), Out: sha256String("3\n")}
+	if len(got) != 1 || got["1"] != want {
+		t.Errorf("computeCaseChecksums() = %v, want {1: %v}", got, want)
+	}
+}
+
+func TestFetchCaseChecksums(t *testing.T) {
+	const problemURL = "https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A"
+	dir := t.TempDir()
+	write := func(name, body string) {
+		t.Helper()
+		path := filepath.Join(dir, "ITP1_1_A", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("1.in", "1 2\n")
+	write("1.out", "3\n")
+	sources := []testcaseSource{&localDirSource{dir: dir}}
+
+	got, err := fetchCaseChecksums(context.Background(), problemURL, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := caseChecksum{In: sha256String("1 2\n"), Out: sha256String("3\n")}
+	if len(got) != 1 || got["1"] != want {
+		t.Fatalf("fetchCaseChecksums() = %v, want {1: %v}", got, want)
+	}
+
+	lf := &lockfile{Problems: map[string]map[string]caseChecksum{problemURL: got}}
+	if err := lf.verifyChecksums(problemURL, got, false); err != nil {
+		t.Errorf("verifyChecksums() = %v, want nil", err)
+	}
+
+	// ジャッジ側でケースが差し替えられたら取得し直したチェックサムで気付ける
+	write("1.out", "4\n")
+	replaced, err := fetchCaseChecksums(context.Background(), problemURL, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.verifyChecksums(problemURL, replaced, false); err == nil {
+		t.Error("verifyChecksums() = nil after the judge replaced a case")
+	}
+}
@@ -1,78 +1,88 @@
 package main
 
 import (
-	"bytes"
-	"crypto/md5"
-	"crypto/rand"
-	"encoding/json"
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"log"
 	"log/slog"
-	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/matumoto1234/aoj-verify/render"
 	"github.com/matumoto1234/aoj-verify/stopwatch"
 )
 
 func main() {
-	filename := os.Args[1]
-
-	annotation, err := readAnnotationInFile(filename)
+	err := configureCassette()
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
-	// テストケースダウンロード編
-	problemID, err := extractProblemID(annotation.ProblemURL)
+	err = loadProjectConfig()
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
-	testcasesHeaderResponse, err := fetchProblemTestcasesHeader(problemID)
+	cacheDir, args, err := extractGlobalFlag(os.Args[1:], "cache-dir")
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	cacheRoot = resolveCacheRoot(cacheDir)
 
-	cacheDir := constructCacheDirPath(annotation.ProblemURL)
-
-	var multiErr error
-
-	for _, h := range testcasesHeaderResponse.Headers {
-		apiURL := fmt.Sprintf("https://judgedat.u-aizu.ac.jp/testcases/%s/%d", problemID, h.Serial)
-
-		if isTestcaseCached(cacheDir, h.Name) {
-			continue
-		}
-
-		err := fetchTestcaseAndSaveToFile(apiURL, cacheDir, h.Name)
-		if err != nil {
-			multiErr = errors.Join(multiErr, err)
-		}
-
-		time.Sleep(3 * time.Second)
+	lang, args, err := extractLangFlag(args)
+	if err != nil {
+		fatal(err)
+	}
+	if lang == "" {
+		lang = detectLanguage()
+	}
+	err = setLanguage(lang)
+	if err != nil {
+		fatal(err)
 	}
 
-	if multiErr != nil {
-		log.Fatal(multiErr)
+	profilePath, args, err := extractGlobalFlag(args, "self-profile")
+	if err != nil {
+		fatal(err)
+	}
+	stopProfile, err := startSelfProfile(profilePath)
+	if err != nil {
+		fatal(err)
 	}
 
-	// Verify編
-	err = verify(cacheDir, filename)
+	err = dispatch(os.Stderr, args)
+	// fatal は os.Exit するので、その前にプロファイルを書き出す
+	stopProfile()
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 }
 
+// fatal は err を表示して、失敗の種類に応じた終了コードで終了する
+func fatal(err error) {
+	code := exitCode(err)
+	if code == exitInfra {
+		log.Printf("infrastructure failure (exit %d; safe to retry): %v", code, err)
+	} else {
+		log.Print(err)
+	}
+	os.Exit(code)
+}
+
+// phaseDurations は各フェーズにかかった時間
+type phaseDurations struct {
+	download time.Duration
+	build    time.Duration
+	judge    time.Duration
+}
+
 type runStatus int
 
 const (
@@ -81,12 +91,82 @@ const (
 	wrongAnswer
 	runtimeError
 	timeLimitExceeded
+	// outputLimitExceeded は出力が大きすぎて途中で打ち切ったケース
+	outputLimitExceeded
+	// notRun は中断などで実行されなかったケース
+	notRun
+	// skippedCase は SKIP_CASES で実行しないことにしたケース
+	skippedCase
 )
 
+func (s runStatus) String() string {
+	switch s {
+	case accepted:
+		return "AC"
+	case wrongAnswer:
+		return "WA"
+	case runtimeError:
+		return "RE"
+	case timeLimitExceeded:
+		return "TLE"
+	case outputLimitExceeded:
+		return "OLE"
+	case notRun:
+		return "NOT_RUN"
+	case skippedCase:
+		return "SKIPPED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// parseRunStatus は "AC" や "TLE" などの表記から runStatus を返す
+func parseRunStatus(s string) (runStatus, bool) {
+	for status := accepted; status <= skippedCase; status++ {
+		if status.String() == strings.ToUpper(s) {
+			return status, true
+		}
+	}
+	return unknown, false
+}
+
+// judged は実際に実行してジャッジしたかどうかを返す
+func (s runStatus) judged() bool {
+	return s != notRun && s != skippedCase && s != unknown
+}
+
 type runResult struct {
 	testcaseName string
 	status       runStatus
 	execTime     time.Duration
+	// answerFilepath は解答プログラムの出力を書き込んだファイル
+	answerFilepath string
+	// mismatch は WA のときに出力が最初に食い違った位置
+	mismatch *mismatch
+	// checkerMessage はチェッカーが WA の理由として出力したもの
+	checkerMessage string
+	// timeout は TLE のときにどう止めたか
+	timeout *timeoutDetail
+	// inputPreview は失敗したケースの入力が小さいときの入力全体
+	inputPreview string
+	// interactive が true なら answerFilepath は出力ではなく、ジャッジとのやり取りの記録
+	interactive bool
+	// diff は WA のときの期待される出力と出力の unified diff
+	diff string
+	// stderr は解答が標準エラー出力に書いたもの。大きければ先頭だけを残す。
+	// RE でなければ -show-stderr のときだけ残す
+	stderr string
+	// exitCode は解答の終了コード。シグナルで止められたときは -1、実行しなかったときは nil
+	exitCode *int
+}
+
+// processExitCode は終了した解答のプロセスの終了コードを返す。起動できなかったときは nil を返す
+func processExitCode(state *os.ProcessState) *int {
+	if state == nil {
+		return nil
+	}
+	code := state.ExitCode()
+	return &code
 }
 
 func newRunResult(testcaseName string, status runStatus, execTime time.Duration) *runResult {
@@ -97,344 +177,564 @@ func newRunResult(testcaseName string, status runStatus, execTime time.Duration)
 	}
 }
 
-func verify(cacheDir, buildFilename string) error {
+type verifyOptions struct {
+	buildTags []string
+	// extraSources は SOURCES で指定された、verification file と一緒にビルドするファイル
+	extraSources []string
+	// failFast が true なら AC 以外のケースが出た時点でジャッジを打ち切る
+	failFast bool
+	// samples が正なら入力サイズの小さい順に samples 個のケースだけをジャッジする
+	samples int
+
+	retentionPolicy retentionPolicy
+	// retentionMaxAge より古い残した出力は削除する
+	retentionMaxAge time.Duration
+
+	// emitRepro が true なら失敗したケースを再現する repro.sh を書き出す
+	emitRepro bool
+
+	timeLimit *timeLimitPolicy
+	// maxOutput が正なら 1 ケースの出力がこのバイト数を超えた時点で OLE として打ち切る
+	maxOutput int64
+	// pipe が true なら出力をファイルに書かずにパイプ越しに照合する
+	pipe bool
+
+	// checker は CHECKER で指定されたチェッカーのソース。空なら出力を完全一致で比べる
+	checker string
+	// compareOptions は checker が無いときの出力の比べ方
+	compareOptions
+	// interactive は INTERACTIVE で指定されたジャッジのソース。空でなければ解答とジャッジを対話させて判定する
+	interactive string
+
+	// skipCases は SKIP_CASES で指定された、実行しないケースの名前
+	skipCases []string
+
+	// liveDiff が nil でなければ、実行中の出力を期待される出力と並べてここに流す
+	liveDiff io.Writer
+
+	// previewInputLimit 以下の大きさの入力で失敗したら、その入力を結果に載せる
+	previewInputLimit int64
+	// showStderr が true なら RE 以外のケースでも解答の標準エラー出力を結果に載せる
+	showStderr bool
+	// diffLines が正なら、WA のときに食い違った行をこの行数まで diff として結果に載せる
+	diffLines int
+
+	// sinks は結果の出力先
+	sinks []ResultSink
+
+	// timeoutGrace は制限時間を過ぎてから SIGTERM で終わるのを待つ時間
+	timeoutGrace time.Duration
+
+	// jobs は同時に実行するケースの数。1 以下なら 1 ケースずつ実行する
+	jobs int
+
+	// label は -label で付けた run の名前。history compare で run を選ぶのに使う
+	label string
+
+	// runID は verify している実行の ID
+	runID string
+
+	// templateVars はビルドの前にソースの {{NAME}} に埋め込む値
+	templateVars map[string]string
+}
+
+func verify(ctx context.Context, cacheDir, buildFilename, problemURL string, opts *verifyOptions, phases *phaseDurations) (*runSummary, error) {
 	// tmp作って〜
-	tmpDir, err := os.MkdirTemp(".aoj-verify", "tmp")
+	err := os.MkdirAll(workDir, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to temporally directory: %w", err)
+		return nil, &infraError{err: fmt.Errorf("failed to mkdir: %w", err)}
 	}
-	defer os.RemoveAll(tmpDir)
-
-	binaryFilepath := filepath.Join(tmpDir, "main")
-
-	// Goファイルをビルドして〜
-	var buildCmdStdErr bytes.Buffer
-	buildCmd := exec.Command("go", "build", "-o", binaryFilepath, buildFilename)
-	buildCmd.Stderr = &buildCmdStdErr
 
-	err = buildCmd.Run()
+	tmpDir, err := os.MkdirTemp(workDir, "tmp")
 	if err != nil {
-		return fmt.Errorf("failed to build go file: %w\n%s", err, buildCmdStdErr.String())
+		return nil, &infraError{err: fmt.Errorf("failed to temporally directory: %w", err)}
 	}
+	defer os.RemoveAll(tmpDir)
 
-	// .in を取得して〜
-	var inFilepaths []string
-	err = filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !d.IsDir() && strings.HasSuffix(path, ".in") {
-			inFilepaths = append(inFilepaths, path)
-		}
-		return nil
-	})
+	binaryFilepath, err := filepath.Abs(filepath.Join(tmpDir, "main"))
 	if err != nil {
-		return fmt.Errorf("failed to walk dir: %w", err)
+		return nil, fmt.Errorf("failed to resolve binary path: %w", err)
+	}
+	if runtime.GOOS == "windows" {
+		binaryFilepath += ".exe"
 	}
 
-	slices.Sort(inFilepaths)
+	var phaseStopwatch stopwatch.Stopwatch
+	phaseStopwatch.Start()
 
-	var multiErr error
-	var runResults []*runResult
+	// AOJ に無いパッケージを使っていたら警告して〜
+	buildFilenames := append([]string{buildFilename}, opts.extraSources...)
+	for _, f := range buildFilenames {
+		if filepath.Ext(f) == ".go" {
+			warnExternalImports(f)
+		}
+	}
 
-	for _, inFilepath := range inFilepaths {
-		// 標準入力に入力ケース渡して実行 & その標準出力と出力ケースを比較してジャッジ
-		base := strings.TrimSuffix(inFilepath, ".in")
-		outFilepath := base + ".out"
+	// ビルドして〜
+	runArgs, err := buildSolutionCached(buildFilenames, binaryFilepath, opts.buildTags, opts.templateVars)
+	if err != nil {
+		return nil, err
+	}
 
-		inFile, err := os.Open(inFilepath)
+	var checkerPath, judgePath string
+	if opts.interactive != "" {
+		// インタラクティブな問題は出力を比べずにジャッジの判定に従う
+		judgePath, err = compileChecker(opts.interactive)
 		if err != nil {
-			multiErr = errors.Join(multiErr, fmt.Errorf("failed to read .in file: %w", err))
-			continue
+			return nil, err
 		}
-
-		answerFilepath := filepath.Join(tmpDir, "answer"+rand.Text())
-		answerFile, err := os.Create(answerFilepath)
+		if opts.pipe || opts.liveDiff != nil {
+			slog.Warn("-pipe and -live-diff are ignored for interactive problems")
+			opts.liveDiff = nil
+		}
+	} else if opts.checker != "" {
+		checkerPath, err = compileChecker(opts.checker)
 		if err != nil {
-			multiErr = errors.Join(multiErr, fmt.Errorf("failed to create answer file: %w", err))
-			continue
+			return nil, err
 		}
+		if opts.pipe {
+			slog.Warn("-pipe is ignored because the checker needs the whole output")
+		}
+	} else if bundled := bundledCheckerPath(cacheDir); existsFileOrDir(bundled) {
+		// Library Checker のようにジャッジが配布しているチェッカーで判定する
+		checkerPath, err = filepath.Abs(bundled)
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.tolerance > 0 && opts.pipe {
+		slog.Warn("-pipe is ignored because outputs are compared with the ERROR tolerance")
+	} else if opts.tokenCompare && opts.pipe {
+		slog.Warn("-pipe is ignored because outputs are compared token by token")
+	} else if opts.pipeline != nil && opts.pipe {
+		slog.Warn("-pipe is ignored because outputs are compared through the comparator pipeline", slog.String("pipeline", opts.pipeline.String()))
+	}
 
-		// run
-		runCmd := exec.Command(binaryFilepath)
-		runCmd.Stdin = inFile
-		runCmd.Stdout = answerFile
-
-		var stopwatch stopwatch.Stopwatch
-		stopwatch.Start()
+	phases.build = phaseStopwatch.Lap()
 
-		err = runCmd.Run()
+	// .in を取得して〜
+	schema := caseSchemaForURL(problemURL)
+	inFilepaths, err := schema.listCachedInputs(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk dir: %w", err)
+	}
 
-		elapsed := stopwatch.Elapsed()
+	// ケースが無いまま「成功」にしてしまわないようにする
+	if len(inFilepaths) == 0 {
+		errMsg := message(msgNoTestcasesFound, cacheDir)
+		return nil, errors.New(errMsg)
+	}
 
+	if opts.samples > 0 {
+		inFilepaths, err = smallestFiles(inFilepaths, opts.samples)
 		if err != nil {
-			slog.Info("RE", slog.String("testcase", base), slog.Any("time", elapsed))
-			runResults = append(runResults, newRunResult(base, runtimeError, elapsed))
-			continue
+			return nil, fmt.Errorf("failed to select sample cases: %w", err)
 		}
+		warnStrict("verified only sample cases", slog.Int("cases", len(inFilepaths)))
+	}
 
-		// TODO: defer
-		inFile.Close()
-		answerFile.Close()
+	history, err := loadHistory(buildFilename)
+	if err != nil {
+		slog.Warn("failed to load history", slog.Any("error", err))
+	}
 
-		// compare output
-		equal, err := filesAreEqual(answerFilepath, outFilepath)
-		if err != nil {
-			multiErr = errors.Join(multiErr, fmt.Errorf("failed to compare files: %w", err))
-			continue
-		}
+	// 過去に落ちた・遅かったケースから実行して〜
+	orderByHistory(inFilepaths, history)
 
-		if equal {
-			slog.Info("AC", slog.String("testcase", base), slog.Any("time", elapsed))
-			runResults = append(runResults, newRunResult(base, accepted, elapsed))
-		} else {
-			slog.Info("WA", slog.String("testcase", base), slog.Any("time", elapsed))
-			runResults = append(runResults, newRunResult(base, wrongAnswer, elapsed))
-		}
-	}
-	if multiErr != nil {
-		return fmt.Errorf("failed to run case: %w", multiErr)
+	// 過去の平均実行時間から全体の所要時間を見積もって〜
+	if avg := averageCaseTime(history); avg > 0 {
+		slog.Info("estimate",
+			slog.Int("cases", len(inFilepaths)),
+			slog.Duration("estimated time", avg*time.Duration(len(inFilepaths))),
+		)
 	}
 
-	// print summary
-	var slowestTime time.Duration
-	var slowestTestcaseName string
-	var acCount, waCount, tleCount, reCount int
-	for _, v := range runResults {
-		if slowestTime < v.execTime {
-			slowestTime = v.execTime
-			slowestTestcaseName = v.testcaseName
-		}
+	multiErr := &multiError{}
+	var runResults []*runResult
 
-		switch v.status {
-		case accepted:
-			acCount++
-		case wrongAnswer:
-			waCount++
-		case timeLimitExceeded:
-			tleCount++
-		case runtimeError:
-			reCount++
+	// 公式のデータが壊れているケースは実行しないが、結果には SKIPPED として残す
+	if len(opts.skipCases) > 0 {
+		inFilepaths = slices.DeleteFunc(inFilepaths, func(inFilepath string) bool {
+			base := schema.caseName(inFilepath)
+			if !slices.Contains(opts.skipCases, filepath.Base(base)) {
+				return false
+			}
+			runResults = append(runResults, newRunResult(base, skippedCase, 0))
+			return true
+		})
+		for _, name := range opts.skipCases {
+			if !slices.ContainsFunc(runResults, func(r *runResult) bool { return filepath.Base(r.testcaseName) == name }) {
+				warnStrict("SKIP_CASES names a case that does not exist", slog.String("testcase", name))
+			}
+		}
+		for _, r := range runResults {
+			slog.Warn("skipped by SKIP_CASES", slog.String("testcase", r.testcaseName))
 		}
 	}
 
-	slog.Info("summary",
-		slog.Duration("slowest time", slowestTime),
-		slog.String("slowest case", slowestTestcaseName),
-		slog.Int("AC count", acCount),
-		slog.Int("WA count", waCount),
-		slog.Int("TLE count", tleCount),
-		slog.Int("RE count", reCount),
+	env := collectEnvironmentInfo()
+	slog.Info("environment",
+		slog.String("aoj-verify", env.ToolVersion),
+		slog.String("go", env.GoVersion),
+		slog.String("os/arch", env.OS+"/"+env.Arch),
+		slog.String("cpu", env.CPU),
 	)
 
-	return nil
-}
+	startedAt := time.Now()
 
-func filesAreEqual(path1, path2 string) (bool, error) {
-	f1, err := os.Open(path1)
+	outputsDir := constructOutputsDirPath(cacheDir)
+	err = cleanupRetainedOutputs(outputsDir, opts.retentionMaxAge)
 	if err != nil {
-		return false, err
+		slog.Warn("failed to clean up old outputs", slog.Any("error", err))
 	}
-	defer f1.Close()
+	retention := newOutputRetention(opts.retentionPolicy, outputsDir, startedAt)
 
-	f2, err := os.Open(path2)
-	if err != nil {
-		return false, err
+	jobs := max(opts.jobs, 1)
+	if jobs > 1 && opts.liveDiff != nil {
+		slog.Warn("-live-diff is ignored because outputs of parallel cases would interleave")
+		opts.liveDiff = nil
 	}
-	defer f2.Close()
 
-	b1 := new(bytes.Buffer)
-	b2 := new(bytes.Buffer)
+	// データによってはケースごとに制限時間が決まっているので、それに従う
+	caseLimits, err := loadCaseTimeLimits(cacheDir)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := io.Copy(b1, f1); err != nil {
-		return false, err
+	// 期待される出力の sha256 は保存したときに manifest に記録してある
+	manifest, err := loadCaseManifest(cacheDir)
+	if err != nil {
+		return nil, err
 	}
-	if _, err := io.Copy(b2, f2); err != nil {
-		return false, err
+
+	// 端末なら実行中のケースを経過時間と一緒に表示する。-live-diff は出力をそのまま流すので重ねない
+	var spinner *caseSpinner
+	if opts.liveDiff == nil && isTerminal(os.Stderr) {
+		spinner = startCaseSpinner(os.Stderr)
+		defer spinner.stop()
 	}
 
-	return bytes.Equal(b1.Bytes(), b2.Bytes()), nil
-}
+	// judgeCase は 1 ケースを実行してジャッジする。-jobs が 2 以上なら並列に呼ばれる
+	judgeCase := func(inFilepath string) (*runResult, error) {
+		files := schema.files(inFilepath)
+		caseLimit, err := caseLimits.of(files)
+		if err != nil {
+			return nil, err
+		}
+		timeLimit := opts.timeLimit.limitFor(caseLimit)
+		if caseLimit > 0 {
+			slog.Debug("case time limit", slog.String("testcase", files.name), slog.Duration("judge limit", caseLimit), slog.Duration("limit", timeLimit))
+		}
 
-func constructCacheDirPath(problemURL string) string {
-	md5URL := md5.Sum([]byte(problemURL))
-	md5URLStr := fmt.Sprintf("%x", md5URL)
+		var expectedSum string
+		if info, err := os.Stat(files.output); err == nil && info.Size() >= hashCompareMinSize {
+			expectedSum = manifest.Cases[filepath.Base(files.name)].Out
+		}
 
-	// TODO: .aoj-verify はオプションで指定できる文字列にする
-	return filepath.Join(".aoj-verify", "cache", md5URLStr, "test")
-}
+		doneSpinner := spinner.track(files.name)
+		var result *runResult
+		if judgePath != "" {
+			result, err = runInteractiveCase(ctx, runArgs, judgePath, files, tmpDir, &runCaseOptions{
+				timeLimit: timeLimit,
+			})
+		} else {
+			// 標準入力に入力ケース渡して実行 & その標準出力と出力ケースを比較してジャッジ
+			result, err = runCase(ctx, runArgs, files, tmpDir, &runCaseOptions{
+				timeLimit:      timeLimit,
+				timeoutGrace:   opts.timeoutGrace,
+				maxOutput:      opts.maxOutput,
+				pipe:           opts.pipe && checkerPath == "" && opts.tolerance == 0 && !opts.tokenCompare && opts.pipeline == nil,
+				checker:        checkerPath,
+				compareOptions: opts.compareOptions,
+				liveDiff:       opts.liveDiff,
+				expectedSum:    expectedSum,
+			})
+		}
+		doneSpinner()
+		if err != nil {
+			return nil, err
+		}
 
-func isTestcaseCached(dir, testcaseName string) bool {
-	in := filepath.Join(dir, testcaseName+".in")
-	return existsFileOrDir(in)
-}
+		if result.status != accepted && opts.previewInputLimit > 0 {
+			result.inputPreview, err = readInputPreview(inFilepath, opts.previewInputLimit)
+			if err != nil {
+				slog.Warn("failed to read input preview", slog.String("testcase", result.testcaseName), slog.Any("error", err))
+			}
+		}
 
-type testcase struct {
-	ProblemID string `json:"problemId"`
-	Serial    int    `json:"serial"`
-	In        string `json:"in"`
-	Out       string `json:"out"`
-}
+		if result.status != runtimeError && !opts.showStderr {
+			result.stderr = ""
+		}
 
-func existsFileOrDir(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
+		// 一時ディレクトリは終わると消えるので、何が違ったのかをその場で見せる
+		if result.status == wrongAnswer && opts.diffLines > 0 && checkerPath == "" && !result.interactive && result.answerFilepath != "" {
+			result.diff, err = readOutputDiff(result.answerFilepath, files.output, opts.diffLines)
+			if err != nil {
+				slog.Warn("failed to diff output", slog.String("testcase", result.testcaseName), slog.Any("error", err))
+			}
+		}
 
-func fetchTestcaseAndSaveToFile(apiURL, dir, filename string) error {
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return fmt.Errorf("failed to fetch testcases: %w", err)
+		return result, nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+	// 実行は並列でも、結果はケースの順に受け取って記録するので、表示やサマリーの順番は変わらない
+	outcomes := make([]chan caseOutcome, len(inFilepaths))
+	for i := range outcomes {
+		outcomes[i] = make(chan caseOutcome, 1)
 	}
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+	go dispatchCases(dispatchCtx, jobs, inFilepaths, outcomes, func(inFilepath string) caseOutcome {
+		result, err := judgeCase(inFilepath)
+		if opts.failFast && err == nil && result.status.judged() && result.status != accepted {
+			// 実行中のケースは最後まで実行するが、新しいケースは始めない
+			stopDispatch()
+		}
+		return caseOutcome{result: result, err: err}
+	})
 
-	var testcase testcase
-	err = json.Unmarshal(body, &testcase)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal body: %w", err)
-	}
+	// 長時間かかっている場合は途中経過を出す。1 ケースが長くても止まらないように、結果を待つ間も出す
+	interimTicker := time.NewTicker(interimSummaryInterval)
+	defer interimTicker.Stop()
+	logInterimSummary := func() {
+		s := summarize(runResults)
+		slog.Info("interim summary",
+			slog.String("progress", fmt.Sprintf("%d/%d", len(runResults), len(inFilepaths))),
+			slog.Duration("elapsed", time.Since(startedAt)),
+			slog.Int("AC count", s.acCount),
+			slog.Int("WA count", s.waCount),
+			slog.Int("TLE count", s.tleCount),
+			slog.Int("RE count", s.reCount),
+			slog.Int("OLE count", s.oleCount),
+		)
+	}
+
+	for i, inFilepath := range inFilepaths {
+		outcome := awaitOutcome(outcomes[i], interimTicker.C, logInterimSummary)
+
+		if !outcome.dispatched {
+			if ctx.Err() != nil {
+				// 中断されたので残りは実行しなかったものとして記録する
+				for _, rest := range inFilepaths[i:] {
+					runResults = append(runResults, newRunResult(schema.caseName(rest), notRun, 0))
+				}
+				slog.Warn("aborted: remaining cases are not run", slog.Int("not run", len(inFilepaths)-i))
+			} else {
+				slog.Info("fail fast: skip remaining cases", slog.Int("skipped", len(inFilepaths)-i))
+			}
+			break
+		}
+
+		if outcome.err != nil {
+			multiErr.add(phaseJudge, filepath.Base(schema.caseName(inFilepath)), outcome.err)
+			continue
+		}
+		result := outcome.result
+
+		runResults = append(runResults, result)
+		for _, sink := range opts.sinks {
+			err := sink.caseFinished(result)
+			if err != nil {
+				slog.Warn("failed to report result", slog.String("sink", sink.String()), slog.Any("error", err))
+			}
+		}
 
-	if !existsFileOrDir(dir) {
-		err = os.MkdirAll(dir, 0755)
+		// 出力を残すかどうかは retention に従う
+		err = retention.retain(result)
 		if err != nil {
-			return fmt.Errorf("failed to mkdir: %w", err)
+			slog.Warn("failed to retain output", slog.String("testcase", result.testcaseName), slog.Any("error", err))
 		}
 	}
-
-	inPath := filepath.Join(dir, filename+".in")
-	in, err := os.Create(inPath)
-	if err != nil {
-		return fmt.Errorf("failed to create .in case: %w", err)
+	if err := multiErr.errOrNil(); err != nil {
+		// 解答の結果ではなく、ファイルの読み書きなど環境の失敗
+		return nil, &infraError{err: fmt.Errorf("failed to run case: %w", err)}
+	}
+
+	phases.judge = phaseStopwatch.Lap()
+
+	if opts.emitRepro && judgePath != "" {
+		slog.Warn("-emit-repro is not supported for interactive problems")
+	} else if opts.emitRepro {
+		failing := slices.DeleteFunc(slices.Clone(runResults), func(r *runResult) bool {
+			return r.status == accepted || !r.status.judged()
+		})
+		if len(failing) > 0 {
+			path, err := writeReproScript(filepath.Join(retention.dir, "repro"), buildFilenames, opts.buildTags, failing)
+			if err != nil {
+				slog.Warn("failed to write repro script", slog.Any("error", err))
+			} else {
+				slog.Info("repro script written", slog.String("path", path))
+			}
+		}
 	}
-	defer in.Close()
-	_, err = io.Copy(in, strings.NewReader(testcase.In))
 
-	outPath := filepath.Join(dir, filename+".out")
-	out, err := os.Create(outPath)
+	hash, err := sourceHash(buildFilenames)
 	if err != nil {
-		return fmt.Errorf("failed to create .out case: %w", err)
+		slog.Warn("failed to hash sources", slog.Any("error", err))
+	}
+
+	summary := summarize(runResults)
+	report := &runReport{
+		file:        buildFilename,
+		problemURL:  problemURL,
+		startedAt:   startedAt,
+		samplesOnly: opts.samples > 0,
+		environment: env,
+		sourceHash:  hash,
+		label:       opts.label,
+		runID:       opts.runID,
+		results:     runResults,
+		summary:     summary,
+	}
+	for _, sink := range opts.sinks {
+		err := sink.runFinished(report)
+		if err != nil {
+			slog.Warn("failed to report results", slog.String("sink", sink.String()), slog.Any("error", err))
+		}
 	}
-	defer out.Close()
-	_, err = io.Copy(out, strings.NewReader(testcase.Out))
-
-	slog.Info("download and saved", slog.String("in", inPath), slog.String("out", outPath))
-	return nil
-}
 
-type header struct {
-	Serial     int    `json:"serial"`
-	Name       string `json:"name"`
-	InputSize  int    `json:"inputSize"`
-	OutputSize int    `json:"outputSize"`
-	Score      int    `json:"score"`
+	return summary, nil
 }
 
-// Ref: http://developers.u-aizu.ac.jp/api?key=judgedat%2Ftestcases%2F%7BproblemId%7D%2Fheader_GET
-type testcasesHeaderResponse struct {
-	ProblemID string    `json:"problemId"`
-	Headers   []*header `json:"headers"`
-}
-
-func fetchProblemTestcasesHeader(problemID string) (*testcasesHeaderResponse, error) {
-	apiURL := fmt.Sprintf("https://judgedat.u-aizu.ac.jp/testcases/%s/header", problemID)
-
-	resp, err := http.Get(apiURL)
+// readInputPreview は inFilepath が limit バイト以下ならその中身を返す。大きければ空文字を返す
+func readInputPreview(inFilepath string, limit int64) (string, error) {
+	info, err := os.Stat(inFilepath)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if info.Size() > limit {
+		return "", nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := os.ReadFile(inFilepath)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return string(body), nil
+}
 
-	header := &testcasesHeaderResponse{}
-	err = json.Unmarshal(body, &header)
+// readOutputDiff は出力 answerPath と期待される出力 outPath の食い違った行を maxLines 行まで unified diff にする
+func readOutputDiff(answerPath, outPath string, maxLines int) (string, error) {
+	answer, err := os.Open(answerPath)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	defer answer.Close()
 
-	return header, nil
-}
-
-func extractProblemID(problemURL string) (string, error) {
-	u, err := url.Parse(problemURL)
+	expected, err := os.Open(outPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse problemURL: %w", err)
+		return "", err
 	}
+	defer expected.Close()
 
-	switch u.Host {
-	case "judge.u-aizu.ac.jp":
-		// e.g. https://judge.u-aizu.ac.jp/onlinejudge/description.jsp?id=ALDS1_14_A
-		query := u.Query()
-		return query.Get("id"), nil
+	return render.UnifiedDiff(answer, expected, maxLines, render.Options{Color: isTerminal(os.Stderr)})
+}
 
-	case "onlinejudge.u-aizu.ac.jp":
-		// e.g. https://onlinejudge.u-aizu.ac.jp/courses/lesson/1/ALDS1/14/ALDS1_14_A
+// interimSummaryInterval ごとに途中経過を出力する
+const interimSummaryInterval = 30 * time.Second
+
+type runSummary struct {
+	slowestTime         time.Duration
+	slowestTestcaseName string
+	acCount             int
+	waCount             int
+	tleCount            int
+	reCount             int
+	oleCount            int
+	notRunCount         int
+	skippedCount        int
+	total               int
+	// cases は render に渡すためのケースごとの結果
+	cases []render.Case
+}
 
-		segments := strings.Split(u.Path, "/")
-		return segments[len(segments)-1], nil
-	default:
-		errMsg := fmt.Sprintf("unsupported url. url: %s", problemURL)
-		return "", errors.New(errMsg)
-	}
+// verdict は "2/3 AC (WA 1)" の形の結果のまとめを返す
+func (s *runSummary) verdict() string {
+	return render.Summary(&render.Result{Cases: s.cases}, render.Options{})
+}
 
-	// unreached
+// allAccepted は SKIP_CASES で飛ばしたもの以外の全ケースが AC だったかを返す。AC のケースが 1 つも無ければ false
+func (s *runSummary) allAccepted() bool {
+	return s.acCount > 0 && s.acCount == s.total-s.skippedCount
 }
 
-func readAnnotationInFile(filename string) (*Annotation, error) {
-	body, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+// count は status だったケースの数を返す
+func (s *runSummary) count(status runStatus) int {
+	switch status {
+	case accepted:
+		return s.acCount
+	case wrongAnswer:
+		return s.waCount
+	case timeLimitExceeded:
+		return s.tleCount
+	case runtimeError:
+		return s.reCount
+	case outputLimitExceeded:
+		return s.oleCount
+	case notRun:
+		return s.notRunCount
+	case skippedCase:
+		return s.skippedCount
+	default:
+		return 0
 	}
+}
 
-	bodyStr := string(body)
-	for line := range strings.Lines(bodyStr) {
-		if !isAnnotationComment(line) {
-			continue
+func summarize(runResults []*runResult) *runSummary {
+	s := &runSummary{total: len(runResults)}
+	for _, v := range runResults {
+		if s.slowestTime < v.execTime {
+			s.slowestTime = v.execTime
+			s.slowestTestcaseName = v.testcaseName
 		}
 
-		a, err := readAnnotationComment(line)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read annotation comment: %w", err)
-		}
+		s.cases = append(s.cases, render.Case{Name: filepath.Base(v.testcaseName), Status: v.status.String()})
 
-		return a, nil
+		switch v.status {
+		case accepted:
+			s.acCount++
+		case wrongAnswer:
+			s.waCount++
+		case timeLimitExceeded:
+			s.tleCount++
+		case runtimeError:
+			s.reCount++
+		case outputLimitExceeded:
+			s.oleCount++
+		case notRun:
+			s.notRunCount++
+		case skippedCase:
+			s.skippedCount++
+		}
 	}
-
-	errMsg := fmt.Sprintf("annotation comment is not found. filename: %s", filename)
-	return nil, errors.New(errMsg)
+	return s
 }
 
-type Annotation struct {
-	ProblemURL string
-}
-
-func isAnnotationComment(line string) bool {
-	return strings.HasPrefix(line, "// verification-helper: ")
+// smallestHeaders は入力サイズの小さい順に n 個のヘッダを返す
+func smallestHeaders(headers []*header, n int) []*header {
+	sorted := slices.Clone(headers)
+	slices.SortStableFunc(sorted, func(a, b *header) int {
+		return cmp.Compare(a.InputSize, b.InputSize)
+	})
+	return sorted[:min(n, len(sorted))]
 }
 
-func readAnnotationComment(comment string) (*Annotation, error) {
-	annotationRegexp := regexp.MustCompile("// verification-helper: PROBLEM (.*)")
-
-	matches := annotationRegexp.FindStringSubmatch(comment)
-	if matches == nil {
-		errMsg := fmt.Sprintf(`annotation comment is not match "// verification-helper: PROBLEM (.*)" comment: %s`, comment)
-		return nil, errors.New(errMsg)
+// smallestFiles はファイルサイズの小さい順に n 個のパスを名前順で返す
+func smallestFiles(paths []string, n int) ([]string, error) {
+	sizes := make(map[string]int64, len(paths))
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		sizes[p] = info.Size()
 	}
 
-	if len(matches) != 2 {
-		errMsg := fmt.Sprintf(`annotation comment is not match "// verification-helper: PROBLEM (.*)" comment: %s`, comment)
-		return nil, errors.New(errMsg)
-	}
+	sorted := slices.Clone(paths)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return cmp.Compare(sizes[a], sizes[b])
+	})
+	sorted = sorted[:min(n, len(sorted))]
+	slices.Sort(sorted)
 
-	return &Annotation{
-		ProblemURL: matches[1],
-	}, nil
+	return sorted, nil
 }
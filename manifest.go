@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// manifest はアノテーションを書けないファイル (生成されたコードなど) について、
+// verify する内容をまとめて指定するためのファイル
+type manifest struct {
+	Entries []*manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	File      string   `json:"file"`
+	Problem   string   `json:"problem"`
+	BuildTags []string `json:"buildTags,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Sources は SOURCES アノテーションと同じく、File と一緒にビルドするファイル
+	Sources []string `json:"sources,omitempty"`
+
+	// 以下は同名のアノテーションと同じ書式で、同じように検証する
+	Error     manifestValue            `json:"error,omitempty"`
+	Expect    string                   `json:"expect,omitempty"`
+	SkipCases []string                 `json:"skipCases,omitempty"`
+	Checker   string                   `json:"checker,omitempty"`
+	TimeLimit manifestValue            `json:"timeLimit,omitempty"`
+	Compare   string                   `json:"compare,omitempty"`
+	Define    map[string]manifestValue `json:"define,omitempty"`
+}
+
+// manifestValue はアノテーションの値と同じ書式の文字列。
+// YAML や TOML で error: 1e-6 や timeLimit: 2 のように数として書かれたものも受け付ける
+type manifestValue string
+
+func (v *manifestValue) UnmarshalJSON(body []byte) error {
+	var s string
+	if err := json.Unmarshal(body, &s); err == nil {
+		*v = manifestValue(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(body, &n); err != nil {
+		errMsg := fmt.Sprintf("must be a string or a number: %s", body)
+		return errors.New(errMsg)
+	}
+	*v = manifestValue(n.String())
+	return nil
+}
+
+func loadManifest(path string) (*manifest, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m := &manifest{}
+	err = unmarshalByExt(path, body, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+
+	for i, e := range m.Entries {
+		if e.File == "" || e.Problem == "" {
+			errMsg := fmt.Sprintf("manifest entry #%d must have both file and problem", i)
+			return nil, errors.New(errMsg)
+		}
+	}
+
+	return m, nil
+}
+
+// annotation はエントリを verification file のアノテーションと同じ形にする。
+// ERROR や TIME_LIMIT などはアノテーションのコメントに直して、ファイルに書いたときと同じように読む
+func (e *manifestEntry) annotation() (*Annotation, error) {
+	a := &Annotation{
+		ProblemURL: e.Problem,
+		BuildTags:  e.BuildTags,
+		Tags:       e.Tags,
+		Sources:    e.Sources,
+	}
+
+	var comments []string
+	add := func(key, value string) {
+		if value != "" {
+			comments = append(comments, key+" "+value)
+		}
+	}
+	add("ERROR", string(e.Error))
+	add("EXPECT", e.Expect)
+	add("SKIP_CASES", strings.Join(e.SkipCases, ","))
+	add("CHECKER", e.Checker)
+	add("TIME_LIMIT", string(e.TimeLimit))
+	add("COMPARE", e.Compare)
+	for _, name := range slices.Sorted(maps.Keys(e.Define)) {
+		add("DEFINE", name+"="+string(e.Define[name]))
+	}
+
+	for _, comment := range comments {
+		err := readAnnotationComment(a, "", comment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest entry for %s: %w", e.File, err)
+		}
+	}
+
+	return a, nil
+}
+
+// runManifest は manifest に列挙されたファイルをまとめて verify する
+func runManifest(args []string) error {
+	fset := flag.NewFlagSet("run", flag.ExitOnError)
+	manifestPath := fset.String("f", "", "path of the manifest (JSON or YAML) listing files and problem URLs")
+	flags := registerVerifyFlags(fset)
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	if *manifestPath == "" {
+		return errors.New("usage: aoj-verify run -f manifest.yaml [flags]")
+	}
+
+	err = flags.apply()
+	if err != nil {
+		return err
+	}
+
+	m, err := loadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := flags.runContext()
+	defer cancel()
+
+	prepareFirstRun()
+
+	err = migrateCache()
+	if err != nil {
+		return err
+	}
+
+	targets := make([]verifyTarget, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		a, err := e.annotation()
+		if err != nil {
+			// verify と同じく、読めないエントリは失敗として報告して他のエントリは verify する
+			targets = append(targets, verifyTarget{file: e.File, annotation: &Annotation{}, annotationErr: err})
+			continue
+		}
+		targets = append(targets, verifyTarget{file: e.File, annotation: a})
+	}
+
+	return verifyTargets(ctx, targets, flags)
+}
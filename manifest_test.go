@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadManifestAnnotationFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	body := `entries:
+  - file: gen/a_test.go
+    problem: https://onlinejudge.u-aizu.ac.jp/problems/CGL_1_A
+    error: 1e-6
+    timeLimit: 2
+    compare: tokens
+    expect: WA
+    skipCases: [in3, in4]
+    checker: checker.cpp
+    define:
+      N: 100
+      MOD: "998244353"
+`
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Entries[0].annotation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Annotation{
+		ProblemURL:   "https://onlinejudge.u-aizu.ac.jp/problems/CGL_1_A",
+		Tolerance:    1e-6,
+		TimeLimit:    2 * time.Second,
+		TokenCompare: true,
+		Expect:       wrongAnswer,
+		SkipCases:    []string{"in3", "in4"},
+		Checker:      "checker.cpp",
+		Defines:      map[string]string{"N": "100", "MOD": "998244353"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("annotation() = %+v, want %+v", got, want)
+	}
+}
+
+func TestManifestEntryAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *manifestEntry
+	}{
+		{name: "negative error", entry: &manifestEntry{Error: "-1"}},
+		{name: "expect AC", entry: &manifestEntry{Expect: "AC"}},
+		{name: "zero time limit", entry: &manifestEntry{TimeLimit: "0"}},
+		{name: "unknown compare", entry: &manifestEntry{Compare: "fuzzy"}},
+		{name: "lower-case define", entry: &manifestEntry{Define: map[string]manifestValue{"n": "1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.File, tt.entry.Problem = "a_test.go", "https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A"
+			if _, err := tt.entry.annotation(); err == nil {
+				t.Errorf("annotation() of %+v succeeded", tt.entry)
+			}
+		})
+	}
+}
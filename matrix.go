@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// goToolchain が空でなければ、Go の解答を GOTOOLCHAIN にこれを指定してビルドする
+var goToolchain string
+
+// matrixEntry は -matrix で並べた、同じファイルを verify する環境の 1 つ
+type matrixEntry struct {
+	name string
+	// goToolchain は Go の解答をビルドするツールチェイン (e.g. go1.23.4)
+	goToolchain string
+	// cppCompiler は C++ の解答をビルドするコマンドとフラグ
+	cppCompiler []string
+}
+
+var goVersionRegexp = regexp.MustCompile(`^go1\.(\d+)(\.\d+)?$`)
+
+// parseMatrix は "go1.21,go1.23" や "g++ -O2,clang++ -O2 -std=c++20" 形式の指定を解釈する。
+// go で始まるものは Go のツールチェイン、それ以外は C++ のコンパイラとフラグとして扱う
+func parseMatrix(spec string) ([]*matrixEntry, error) {
+	var entries []*matrixEntry
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		if m := goVersionRegexp.FindStringSubmatch(s); m != nil {
+			toolchain := s
+			// go1.21 以降はリリースに .0 が付くので、go1.23 は go1.23.0 を指す
+			if minor, _ := strconv.Atoi(m[1]); minor >= 21 && m[2] == "" {
+				toolchain += ".0"
+			}
+			entries = append(entries, &matrixEntry{name: s, goToolchain: toolchain})
+			continue
+		}
+		if strings.HasPrefix(s, "go") {
+			errMsg := fmt.Sprintf("malformed go version in -matrix: %q (e.g. go1.23 or go1.23.4)", s)
+			return nil, errors.New(errMsg)
+		}
+
+		entries = append(entries, &matrixEntry{name: s, cppCompiler: strings.Fields(s)})
+	}
+
+	return entries, nil
+}
+
+// appliesTo は filename の言語をこの環境でビルドできるかを返す
+func (e *matrixEntry) appliesTo(filename string) bool {
+	lang := lookupLanguage(filename)
+	if e.goToolchain != "" {
+		return lang == goLanguage
+	}
+	return lang == cppLanguage
+}
+
+// apply はビルドの設定をこの環境のものにし、元に戻す関数を返す
+func (e *matrixEntry) apply() (restore func()) {
+	prevToolchain, prevCompiler := goToolchain, cppCompiler
+	if e.goToolchain != "" {
+		goToolchain = e.goToolchain
+	}
+	if len(e.cppCompiler) > 0 {
+		cppCompiler = e.cppCompiler
+	}
+	return func() {
+		goToolchain, cppCompiler = prevToolchain, prevCompiler
+	}
+}
+
+// matrixCell は 1 つの環境で verify した結果
+type matrixCell struct {
+	entry   *matrixEntry
+	summary *runSummary
+	err     error
+}
+
+// verifyMatrix は同じファイルを entries のそれぞれの環境で verify し、結果と実行時間の表を表示する。
+// コンパイラのバージョンやフラグによって変わるバグを、提出する前に見つけられるようにする
+func verifyMatrix(ctx context.Context, t verifyTarget, flags *verifyFlags, entries []*matrixEntry) error {
+	var cells []*matrixCell
+	for _, e := range entries {
+		if !e.appliesTo(t.file) {
+			warnStrict("matrix entry does not apply to the language of the file", slog.String("file", t.file), slog.String("entry", e.name))
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		slog.Info("matrix", slog.String("file", t.file), slog.String("environment", e.name))
+		restore := e.apply()
+		summary, err := verifyFile(ctx, t.file, t.annotation, flags)
+		restore()
+		if err == nil {
+			err = checkExpectation(t.file, t.annotation, summary)
+		}
+		if errors.Is(err, errSkipped) {
+			return err
+		}
+		cells = append(cells, &matrixCell{entry: e, summary: summary, err: err})
+	}
+
+	if len(cells) == 0 {
+		errMsg := fmt.Sprintf("no -matrix entry applies to %s", t.file)
+		return errors.New(errMsg)
+	}
+
+	printMatrix(t.file, cells)
+
+	var failed []string
+	infraOnly := true
+	for _, c := range cells {
+		if c.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", c.entry.name, c.err))
+			infraOnly = infraOnly && isInfraError(c.err)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	errMsg := fmt.Sprintf("failed in %d of %d environment(s): %s", len(failed), len(cells), strings.Join(failed, "; "))
+	if infraOnly {
+		return &infraError{err: errors.New(errMsg)}
+	}
+	return errors.New(errMsg)
+}
+
+// printMatrix は環境ごとの結果と最も遅いケースの実行時間を表にする
+func printMatrix(file string, cells []*matrixCell) {
+	fmt.Fprintln(os.Stderr, message(msgMatrixTitle, file))
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tVERDICT\tSLOWEST\tCASE")
+
+	fastest := slices.MinFunc(cells, func(a, b *matrixCell) int {
+		return cmp.Compare(cellTime(a), cellTime(b))
+	})
+	for _, c := range cells {
+		if c.summary == nil {
+			fmt.Fprintf(w, "%s\terror\t-\t-\n", c.entry.name)
+			continue
+		}
+
+		slowest := formatExecTime(c.summary.slowestTime)
+		if c != fastest && cellTime(fastest) > 0 {
+			slowest += fmt.Sprintf(" (×%.2f)", float64(c.summary.slowestTime)/float64(cellTime(fastest)))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.entry.name, c.summary.verdict(), slowest, filepath.Base(c.summary.slowestTestcaseName))
+	}
+	w.Flush()
+}
+
+// cellTime は比較に使う最も遅いケースの実行時間。verify できなかった環境は最後に回す
+func cellTime(c *matrixCell) time.Duration {
+	if c.summary == nil {
+		return time.Duration(math.MaxInt64)
+	}
+	return c.summary.slowestTime
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// messageID は人が読むためのメッセージの識別子。結果や案内、確認、対処の方法を書いたエラーなど、人に向けて出す文はすべてここに置く。
+// ログのメッセージやキーは機械的に扱われるので英語のままにする。フラグやコマンドの説明、表の見出し (tabwriter は文字幅を数えない)、
+// 生成するファイル (docs や repro.sh) も英語のままにする
+type messageID int
+
+const (
+	msgConfirmGitignore messageID = iota
+	msgNoTrackedTestcases
+	msgTrackedTestcases
+	msgHookInstalled
+	msgHookExists
+	msgUncoveredPackages
+	msgUnverifiedLibraries
+	msgAllLibrariesVerified
+	msgNoTestcasesOnJudge
+	msgErrorsOccurred
+	msgLockMismatch
+	msgNoTestcasesFound
+	msgUnverifiedRelease
+	msgCacheTooNew
+	msgStatsEnabled
+	msgStatsDisabled
+	msgUnknownStatsCommand
+	msgNoStats
+	msgNoStatsYet
+	msgStatsVerifications
+	msgStatsAverageTime
+	msgStatsHeaderCache
+	msgStatsCaseCache
+	msgStatsSlowest
+	msgLintProblems
+	msgLintOK
+	msgUnsupportedURL
+	msgDidYouMean
+	msgSupportedJudges
+	msgBuildConstraintsExclude
+	msgSeveralConfigFiles
+	msgReadingFromTerminal
+	msgNoCachedTestcases
+	msgNoSuchCase
+	msgLibraryCheckerNotFound
+	msgYukicoderTokenRequired
+	msgYukicoderTokenRejected
+	msgCacheFixed
+	msgCacheMismatch
+	msgCacheIntact
+	msgGCRemoved
+	msgGCWouldRemove
+	msgMatrixTitle
+	msgOwnModule
+	msgCacheDirContainsProject
+	msgCleanAllExclusive
+	msgSourceInCacheDir
+	msgSpinnerRunning
+	numMessages
+)
+
+var catalogs = map[string]map[messageID]string{
+	"en": {
+		msgConfirmGitignore:     "add %s to %s? testcases must not be committed",
+		msgNoTrackedTestcases:   "no testcase files found under version control",
+		msgTrackedTestcases:     "AOJ testcases must not be redistributed, but %d file(s) are under version control:\n  %s",
+		msgHookInstalled:        "installed %s",
+		msgHookExists:           "%s already exists. add `aoj-verify cache audit -staged` to it or use -force",
+		msgUncoveredPackages:    "%d/%d package(s) have no verification",
+		msgUnverifiedLibraries:  "%d library file(s) are not verified by any verification file:\n  %s",
+		msgAllLibrariesVerified: "all %d library file(s) are verified",
+		msgNoTestcasesOnJudge: "the judge returned no testcases for %s (new or hidden problem?). " +
+			"use -samples-only to verify against the sample cases from the problem statement instead",
+		msgErrorsOccurred:          "%d error(s) occurred:",
+		msgLockMismatch:            "testcases of %s differ from the lockfile (run `aoj-verify lock` if the change is expected):\n  %s",
+		msgNoTestcasesFound:        "no testcases found in %s; nothing would be verified",
+		msgUnverifiedRelease:       "release %s has no %s; refusing to install an unverified binary",
+		msgCacheTooNew:             "cache at %s has layout version %d, which is newer than this aoj-verify supports (%d); upgrade aoj-verify or remove the cache",
+		msgStatsEnabled:            "local statistics enabled; recorded to %s and never sent anywhere",
+		msgStatsDisabled:           "local statistics disabled",
+		msgUnknownStatsCommand:     "unknown stats subcommand: %s (enable, disable, reset or show)",
+		msgNoStats:                 "no statistics recorded. run `aoj-verify stats enable` to start recording locally",
+		msgNoStatsYet:              "no statistics recorded yet",
+		msgStatsVerifications:      "verifications: %d",
+		msgStatsAverageTime:        "average time:  download %s, build %s, judge %s",
+		msgStatsHeaderCache:        "header cache:  %s hit rate",
+		msgStatsCaseCache:          "case cache:    %s hit rate (%d cached, %d fetched)",
+		msgStatsSlowest:            "slowest verifications:",
+		msgLintProblems:            "%d problem(s) found in %d annotated file(s)",
+		msgLintOK:                  "%d annotated file(s) look fine",
+		msgUnsupportedURL:          "unsupported url. url: %s",
+		msgDidYouMean:              "did you mean %s? e.g. %s",
+		msgSupportedJudges:         "supported judges:",
+		msgBuildConstraintsExclude: "build constraints exclude %s (tags: %q). set BUILD_TAGS annotation or -tags flag",
+		msgSeveralConfigFiles:      "found several config files (%s); keep only one",
+		msgReadingFromTerminal:     "reading input from the terminal; end it with Ctrl-D",
+		msgNoCachedTestcases:       "no cached testcases for %s; run `aoj-verify download` first",
+		msgNoSuchCase:              "no case named %s; cached cases are %s",
+		msgLibraryCheckerNotFound:  "problem %s is not found in library-checker-problems; try -refresh to update it",
+		msgYukicoderTokenRequired:  "yukicoder requires an API token; set %s (see https://yukicoder.me/auth/token)",
+		msgYukicoderTokenRejected:  "yukicoder rejected the API token (%s); check %s",
+		msgCacheFixed:              "removed %d broken file(s); they are downloaded again on the next verify",
+		msgCacheMismatch:           "%d cached file(s) do not match the manifests; run with -fix to remove them:\n  %s",
+		msgCacheIntact:             "all cached testcases match their manifests",
+		msgGCRemoved:               "removed %d unreferenced blob(s) (%s) and %d stale manifest entry(ies)",
+		msgGCWouldRemove:           "would remove %d unreferenced blob(s) (%s) and %d stale manifest entry(ies)",
+		msgMatrixTitle:             "matrix of %s",
+		msgOwnModule:               "%s belongs to the aoj-verify module itself; put verification files in your library's module",
+		msgCacheDirContainsProject: "cacheDir %q contains the project itself; use a dedicated directory such as .aoj-verify",
+		msgCleanAllExclusive:       "-all removes everything; do not combine it with -problem or -older-than",
+		msgSourceInCacheDir:        "%s is inside the cache directory %s; move it out or change the cache directory",
+		msgSpinnerRunning:          "running %s",
+	},
+	"ja": {
+		msgConfirmGitignore:     "%s を %s に追加しますか? テストケースはコミットしてはいけません",
+		msgNoTrackedTestcases:   "バージョン管理下にテストケースのファイルはありません",
+		msgTrackedTestcases:     "AOJ のテストケースは再配布できませんが、%d 個のファイルがバージョン管理下にあります:\n  %s",
+		msgHookInstalled:        "%s をインストールしました",
+		msgHookExists:           "%s は既に存在します。`aoj-verify cache audit -staged` を追記するか -force を指定してください",
+		msgUncoveredPackages:    "%d/%d 個のパッケージが verify されていません",
+		msgUnverifiedLibraries:  "%d 個のライブラリのファイルがどの verification file からも verify されていません:\n  %s",
+		msgAllLibrariesVerified: "%d 個のライブラリのファイルはすべて verify されています",
+		msgNoTestcasesOnJudge: "ジャッジから %s のテストケースが返ってきませんでした (新しい問題か非公開の問題?)。" +
+			"-samples-only を指定すると問題文のサンプルケースで verify します",
+		msgErrorsOccurred:          "%d 個のエラーが起きました:",
+		msgLockMismatch:            "%s のテストケースが lockfile と異なります (意図した変更なら `aoj-verify lock` を実行してください):\n  %s",
+		msgNoTestcasesFound:        "%s にテストケースがありません。何も verify されません",
+		msgUnverifiedRelease:       "リリース %s に %s がありません。検証できないバイナリはインストールしません",
+		msgCacheTooNew:             "%s のキャッシュのレイアウトのバージョン %d は、この aoj-verify が対応しているもの (%d) より新しいです。aoj-verify を更新するかキャッシュを削除してください",
+		msgStatsEnabled:            "ローカルの統計を有効にしました。%s に記録し、どこにも送信しません",
+		msgStatsDisabled:           "ローカルの統計を無効にしました",
+		msgUnknownStatsCommand:     "stats のサブコマンド %s はありません (enable, disable, reset, show のどれか)",
+		msgNoStats:                 "統計は記録されていません。`aoj-verify stats enable` を実行するとローカルに記録を始めます",
+		msgNoStatsYet:              "統計はまだ記録されていません",
+		msgStatsVerifications:      "verify の回数: %d",
+		msgStatsAverageTime:        "平均時間:      ダウンロード %s、ビルド %s、ジャッジ %s",
+		msgStatsHeaderCache:        "header のキャッシュ: ヒット率 %s",
+		msgStatsCaseCache:          "ケースのキャッシュ: ヒット率 %s (キャッシュ %d 件、取得 %d 件)",
+		msgStatsSlowest:            "時間のかかった verify:",
+		msgLintProblems:            "%[2]d 個のアノテーションのあるファイルに %[1]d 個の問題が見つかりました",
+		msgLintOK:                  "%d 個のアノテーションのあるファイルに問題はありません",
+		msgUnsupportedURL:          "対応していない URL です。url: %s",
+		msgDidYouMean:              "%s のことですか? e.g. %s",
+		msgSupportedJudges:         "対応しているジャッジ:",
+		msgBuildConstraintsExclude: "build constraints によって %s が除外されています (tags: %q)。BUILD_TAGS アノテーションか -tags フラグを指定してください",
+		msgSeveralConfigFiles:      "設定ファイルが複数あります (%s)。1 つだけにしてください",
+		msgReadingFromTerminal:     "端末から入力を読み込みます。Ctrl-D で終わります",
+		msgNoCachedTestcases:       "%s のテストケースはキャッシュされていません。先に `aoj-verify download` を実行してください",
+		msgNoSuchCase:              "%s という名前のケースはありません。キャッシュされているケースは %s です",
+		msgLibraryCheckerNotFound:  "問題 %s は library-checker-problems にありません。-refresh で更新してみてください",
+		msgYukicoderTokenRequired:  "yukicoder には API トークンが必要です。%s を設定してください (https://yukicoder.me/auth/token を参照)",
+		msgYukicoderTokenRejected:  "yukicoder が API トークンを受け付けませんでした (%s)。%s を確認してください",
+		msgCacheFixed:              "壊れたファイルを %d 個削除しました。次の verify でダウンロードし直します",
+		msgCacheMismatch:           "%d 個のキャッシュされたファイルが manifest と一致しません。-fix を付けて実行すると削除します:\n  %s",
+		msgCacheIntact:             "キャッシュされたテストケースはすべて manifest と一致しています",
+		msgGCRemoved:               "参照されていない blob を %d 個 (%s) と古い manifest のエントリを %d 個削除しました",
+		msgGCWouldRemove:           "参照されていない blob %d 個 (%s) と古い manifest のエントリ %d 個を削除します",
+		msgMatrixTitle:             "%s の環境ごとの結果",
+		msgOwnModule:               "%s は aoj-verify 自身の module に含まれています。verification file はライブラリの module に置いてください",
+		msgCacheDirContainsProject: "cacheDir %q がプロジェクトそのものを含んでいます。.aoj-verify のような専用のディレクトリを使ってください",
+		msgCleanAllExclusive:       "-all はすべてを削除するので、-problem や -older-than と一緒に指定できません",
+		msgSourceInCacheDir:        "%s はキャッシュのディレクトリ %s の中にあります。外に移すかキャッシュのディレクトリを変えてください",
+		msgSpinnerRunning:          "実行中 %s",
+	},
+}
+
+const defaultLanguage = "en"
+
+var currentLanguage = defaultLanguage
+
+// message は現在の言語で id のメッセージを組み立てる。翻訳が無ければ英語を使う
+func message(id messageID, args ...any) string {
+	format, ok := catalogs[currentLanguage][id]
+	if !ok {
+		format = catalogs[defaultLanguage][id]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// setLanguage は lang を以降のメッセージの言語にする
+func setLanguage(lang string) error {
+	if _, ok := catalogs[lang]; !ok {
+		return fmt.Errorf("unsupported language: %s", lang)
+	}
+	currentLanguage = lang
+	return nil
+}
+
+// detectLanguage はロケールの環境変数から言語を決める。分からなければ英語にする
+func detectLanguage() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		// e.g. ja_JP.UTF-8
+		lang, _, _ := strings.Cut(v, "_")
+		lang, _, _ = strings.Cut(lang, ".")
+		if _, ok := catalogs[lang]; ok {
+			return lang
+		}
+		return defaultLanguage
+	}
+	return defaultLanguage
+}
+
+// extractLangFlag はどのサブコマンドでも使えるように args から -lang, --lang の指定を取り除いて返す
+func extractLangFlag(args []string) (string, []string, error) {
+	return extractGlobalFlag(args, "lang")
+}
+
+// extractGlobalFlag はどのサブコマンドでも使えるように args から -name, --name の指定を取り除いて返す
+func extractGlobalFlag(args []string, flagName string) (string, []string, error) {
+	var value string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, v, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != flagName {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			v = args[i]
+		}
+		value = v
+	}
+
+	return value, rest, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// formatVerbRegexp は %% 以外の書式指定 (e.g. %s, %q, %[2]d) にマッチする
+var formatVerbRegexp = regexp.MustCompile(`%(?:%|(?:\[(\d+)\])?[-+# 0]*\d*(?:\.\d+)?([a-zA-Z]))`)
+
+// formatArgs は format が何番目の引数をどの verb で使うかを並べる
+func formatArgs(format string) []string {
+	var args []string
+	next := 1
+	for _, m := range formatVerbRegexp.FindAllStringSubmatch(format, -1) {
+		if m[2] == "" {
+			continue
+		}
+		if m[1] != "" {
+			next, _ = strconv.Atoi(m[1])
+		}
+		args = append(args, strconv.Itoa(next)+m[2])
+		next++
+	}
+	slices.Sort(args)
+	return args
+}
+
+func TestCatalogsAreComplete(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for id := range numMessages {
+			if catalog[id] == "" {
+				t.Errorf("%s catalog has no message %d", lang, id)
+			}
+		}
+		if len(catalog) != int(numMessages) {
+			t.Errorf("%s catalog has %d messages, want %d", lang, len(catalog), numMessages)
+		}
+	}
+}
+
+func TestCatalogsTakeSameArgs(t *testing.T) {
+	for lang, catalog := range catalogs {
+		if lang == defaultLanguage {
+			continue
+		}
+		for id, format := range catalog {
+			want := formatArgs(catalogs[defaultLanguage][id])
+			if got := formatArgs(format); !slices.Equal(got, want) {
+				t.Errorf("%s message %d uses arguments %v, want %v like %s: %q", lang, id, got, want, defaultLanguage, format)
+			}
+		}
+	}
+}
+
+func TestMessageFallsBackToEnglish(t *testing.T) {
+	prev := currentLanguage
+	t.Cleanup(func() { currentLanguage = prev })
+
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{lang: "en", want: "no case named 1; cached cases are 2, 3"},
+		{lang: "ja", want: "1 という名前のケースはありません。キャッシュされているケースは 2, 3 です"},
+		{lang: "fr", want: "no case named 1; cached cases are 2, 3"},
+	}
+	for _, tt := range tests {
+		currentLanguage = tt.lang
+		if got := message(msgNoSuchCase, "1", "2, 3"); got != tt.want {
+			t.Errorf("message in %s = %q, want %q", tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runCheckPolicy は include にマッチするライブラリのファイルのうち、
+// どの verification file からも使われていないものがあれば失敗する
+func runCheckPolicy(args []string) error {
+	fset := flag.NewFlagSet("check-policy", flag.ExitOnError)
+	include := fset.String("include", "**/*.go", "comma-separated globs of library files that must be verified")
+	exclude := fset.String("exclude", "**/*_test.go", "comma-separated globs of files exempt from the policy")
+	fset.Parse(args)
+
+	root := "."
+	if fset.NArg() > 0 {
+		root = fset.Arg(0)
+	}
+
+	verificationFiles, err := findAnnotatedFiles(root)
+	if err != nil {
+		return fmt.Errorf("failed to find verification files: %w", err)
+	}
+
+	libraryFiles, err := findLibraryFiles(root, splitList(*include), splitList(*exclude), verificationFiles)
+	if err != nil {
+		return fmt.Errorf("failed to find library files: %w", err)
+	}
+
+	verifiedDirs, err := dependentPackageDirs(verificationFiles)
+	if err != nil {
+		return err
+	}
+
+	var unverified []string
+	for _, file := range libraryFiles {
+		dir, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		if _, ok := verifiedDirs[dir]; !ok {
+			unverified = append(unverified, file)
+		}
+	}
+
+	if len(unverified) > 0 {
+		errMsg := message(msgUnverifiedLibraries, len(unverified), strings.Join(unverified, "\n  "))
+		return errors.New(errMsg)
+	}
+
+	fmt.Fprintln(os.Stdout, message(msgAllLibrariesVerified, len(libraryFiles)))
+	return nil
+}
+
+// findLibraryFiles は root 以下で include にマッチし exclude にマッチしないファイルを探す。verification file 自体は除く
+func findLibraryFiles(root string, include, exclude, verificationFiles []string) ([]string, error) {
+	defer profilePhase(context.Background(), profileWalk)()
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if walkSkipToolDir(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if slices.Contains(verificationFiles, path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		included, err := matchAnyGlob(include, rel)
+		if err != nil || !included {
+			return err
+		}
+		excluded, err := matchAnyGlob(exclude, rel)
+		if err != nil || excluded {
+			return err
+		}
+
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// politeness はジャッジのホストごとのアクセスの間隔と同時接続数
+type politeness struct {
+	// interval は平均してリクエストを開始する間隔。0 なら間隔を空けない
+	interval       time.Duration
+	maxConcurrency int
+	// burst は間隔を空けずに続けて開始できるリクエストの数。0 は 1 と同じ
+	burst int
+}
+
+// defaultPoliteness はホストごとの既定値。載っていないホストには fallbackPoliteness を使う
+var defaultPoliteness = map[string]politeness{
+	"judgedat.u-aizu.ac.jp": {interval: 3 * time.Second, maxConcurrency: 1},
+	"judgeapi.u-aizu.ac.jp": {interval: 1 * time.Second, maxConcurrency: 1},
+	"yukicoder.me":          {interval: 1 * time.Second, maxConcurrency: 1},
+	"judge.yosupo.jp":       {interval: 500 * time.Millisecond, maxConcurrency: 2},
+}
+
+var fallbackPoliteness = politeness{interval: 3 * time.Second, maxConcurrency: 1}
+
+// parsePolitenessOverrides は "host=interval[:concurrency[:burst]],..." 形式の指定を読む。
+// interval は "2/s" のように 1 秒あたりのリクエスト数でも書ける。
+// e.g. judgedat.u-aizu.ac.jp=1s:2,yukicoder.me=500ms,judge.yosupo.jp=4/s:4:8
+func parsePolitenessOverrides(s string) (map[string]politeness, error) {
+	overrides := make(map[string]politeness)
+
+	for _, item := range splitList(s) {
+		host, setting, ok := strings.Cut(item, "=")
+		if !ok {
+			errMsg := fmt.Sprintf("invalid politeness %q. must be host=interval[:concurrency[:burst]]", item)
+			return nil, errors.New(errMsg)
+		}
+
+		p, ok := defaultPoliteness[host]
+		if !ok {
+			p = fallbackPoliteness
+		}
+
+		fields := strings.Split(setting, ":")
+		if len(fields) > 3 {
+			errMsg := fmt.Sprintf("invalid politeness %q. must be host=interval[:concurrency[:burst]]", item)
+			return nil, errors.New(errMsg)
+		}
+
+		interval, err := parsePolitenessInterval(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid politeness interval for %s: %w", host, err)
+		}
+		p.interval = interval
+
+		if len(fields) >= 2 {
+			concurrency, err := strconv.Atoi(fields[1])
+			if err != nil || concurrency < 1 {
+				errMsg := fmt.Sprintf("invalid politeness concurrency for %s: %q", host, fields[1])
+				return nil, errors.New(errMsg)
+			}
+			p.maxConcurrency = concurrency
+		}
+
+		if len(fields) == 3 {
+			burst, err := strconv.Atoi(fields[2])
+			if err != nil || burst < 1 {
+				errMsg := fmt.Sprintf("invalid politeness burst for %s: %q", host, fields[2])
+				return nil, errors.New(errMsg)
+			}
+			p.burst = burst
+		}
+
+		overrides[host] = p
+	}
+
+	return overrides, nil
+}
+
+// parsePolitenessInterval は "3s" のような間隔か、"2/s" のような 1 秒あたりのリクエスト数を読む
+func parsePolitenessInterval(s string) (time.Duration, error) {
+	if rate, ok := strings.CutSuffix(s, "/s"); ok {
+		perSecond, err := strconv.ParseFloat(rate, 64)
+		if err != nil || perSecond <= 0 {
+			errMsg := fmt.Sprintf("requests per second must be positive: %q", s)
+			return 0, errors.New(errMsg)
+		}
+		return time.Duration(float64(time.Second) / perSecond), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// hostLimiter は 1 つのホストへのリクエストを politeness に従って待たせる。
+// interval ごとに 1 つ、burst 個まで貯まるトークンを 1 リクエストに 1 つ使うトークンバケット
+type hostLimiter struct {
+	p     politeness
+	slots chan struct{}
+
+	mu sync.Mutex
+	// tokens は last の時点で残っていたトークン。先の予約で負になることもある
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(p politeness) *hostLimiter {
+	return &hostLimiter{
+		p:      p,
+		slots:  make(chan struct{}, max(p.maxConcurrency, 1)),
+		tokens: float64(max(p.burst, 1)),
+		last:   time.Now(),
+	}
+}
+
+// acquire は同時接続数の枠を確保し、トークンが貯まるまで待つ
+func (l *hostLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	wait := l.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	}
+}
+
+// reserve はトークンを 1 つ予約し、それが使えるようになるまでの時間を返す
+func (l *hostLimiter) reserve(now time.Time) time.Duration {
+	if l.p.interval <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elapsed := now.Sub(l.last)
+	l.tokens = min(l.tokens+float64(elapsed)/float64(l.p.interval), float64(max(l.p.burst, 1)))
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(l.p.interval))
+}
+
+func (l *hostLimiter) release() {
+	<-l.slots
+}
+
+// politeTransport はホストごとの politeness を守ってリクエストを送る http.RoundTripper
+type politeTransport struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	overrides map[string]politeness
+	limiters  map[string]*hostLimiter
+}
+
+func newPoliteTransport(base http.RoundTripper) *politeTransport {
+	return &politeTransport{
+		base:      base,
+		overrides: make(map[string]politeness),
+		limiters:  make(map[string]*hostLimiter),
+	}
+}
+
+// setOverrides はホストごとの設定を上書きする。以後に作られる limiter から反映される
+func (t *politeTransport) setOverrides(overrides map[string]politeness) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for host, p := range overrides {
+		t.overrides[host] = p
+		delete(t.limiters, host)
+	}
+}
+
+func (t *politeTransport) limiter(host string) *hostLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if l, ok := t.limiters[host]; ok {
+		return l
+	}
+
+	p, ok := t.overrides[host]
+	if !ok {
+		p, ok = defaultPoliteness[host]
+	}
+	if !ok {
+		p = fallbackPoliteness
+	}
+
+	l := newHostLimiter(p)
+	t.limiters[host] = l
+	return l
+}
+
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := t.limiter(req.URL.Hostname())
+
+	err := l.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePolitenessOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]politeness
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: map[string]politeness{}},
+		{
+			name: "interval and concurrency",
+			spec: "judgedat.u-aizu.ac.jp=1s:2",
+			want: map[string]politeness{"judgedat.u-aizu.ac.jp": {interval: time.Second, maxConcurrency: 2}},
+		},
+		{
+			// 同時接続数を省略したら、そのホストの既定値のまま
+			name: "interval only keeps the default concurrency",
+			spec: "judge.yosupo.jp=100ms",
+			want: map[string]politeness{"judge.yosupo.jp": {interval: 100 * time.Millisecond, maxConcurrency: 2}},
+		},
+		{
+			name: "unknown host falls back",
+			spec: "example.com=5s",
+			want: map[string]politeness{"example.com": {interval: 5 * time.Second, maxConcurrency: fallbackPoliteness.maxConcurrency}},
+		},
+		{
+			name: "several hosts",
+			spec: "judgedat.u-aizu.ac.jp=1s:2, yukicoder.me=500ms",
+			want: map[string]politeness{
+				"judgedat.u-aizu.ac.jp": {interval: time.Second, maxConcurrency: 2},
+				"yukicoder.me":          {interval: 500 * time.Millisecond, maxConcurrency: 1},
+			},
+		},
+		{
+			name: "rate and burst",
+			spec: "judge.yosupo.jp=4/s:4:8",
+			want: map[string]politeness{"judge.yosupo.jp": {interval: 250 * time.Millisecond, maxConcurrency: 4, burst: 8}},
+		},
+		{name: "missing =", spec: "judgedat.u-aizu.ac.jp", wantErr: true},
+		{name: "bad interval", spec: "judgedat.u-aizu.ac.jp=fast", wantErr: true},
+		{name: "zero concurrency", spec: "judgedat.u-aizu.ac.jp=1s:0", wantErr: true},
+		{name: "bad concurrency", spec: "judgedat.u-aizu.ac.jp=1s:x", wantErr: true},
+		{name: "zero burst", spec: "judgedat.u-aizu.ac.jp=1s:1:0", wantErr: true},
+		{name: "too many fields", spec: "judgedat.u-aizu.ac.jp=1s:1:2:3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePolitenessOverrides(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePolitenessOverrides(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePolitenessOverrides(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePolitenessInterval(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "3s", want: 3 * time.Second},
+		{s: "500ms", want: 500 * time.Millisecond},
+		{s: "0s", want: 0},
+		{s: "2/s", want: 500 * time.Millisecond},
+		{s: "0.5/s", want: 2 * time.Second},
+		{s: "0/s", wantErr: true},
+		{s: "-1/s", wantErr: true},
+		{s: "x/s", wantErr: true},
+		{s: "2/m", wantErr: true},
+		{s: "3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parsePolitenessInterval(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePolitenessInterval(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePolitenessInterval(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
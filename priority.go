@@ -0,0 +1,78 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// targetPriority は verify する順番の優先度。小さいほど先に verify する
+type targetPriority int
+
+const (
+	// priorityFailed は前回失敗したファイル
+	priorityFailed targetPriority = iota
+	// priorityChanged は前回の verify の後に書き換えられたか、まだ verify したことの無いファイル
+	priorityChanged
+	priorityUnchanged
+)
+
+// orderTargetsByPriority は前回失敗したファイル、最近書き換えたファイルの順に targets を並べ替える。
+// 全体を名前順に verify し終わるのを待たずに、手を動かすべき失敗が分かるようにする
+func orderTargetsByPriority(targets []verifyTarget) {
+	if len(targets) < 2 {
+		return
+	}
+
+	latest, err := loadLatestHistory()
+	if err != nil {
+		slog.Warn("failed to load history; verifying in the given order", slog.Any("error", err))
+		return
+	}
+
+	type ranked struct {
+		priority targetPriority
+		modTime  time.Time
+	}
+	ranks := make(map[string]ranked, len(targets))
+	for _, t := range targets {
+		modTime := latestModTime(t.annotation.sourceFiles(t.file))
+
+		r := ranked{priority: priorityUnchanged, modTime: modTime}
+		record, ok := latest[filepath.Clean(t.file)]
+		switch {
+		case !ok || modTime.After(record.StartedAt):
+			r.priority = priorityChanged
+		case checkExpectation(t.file, t.annotation, record.summary()) != nil:
+			r.priority = priorityFailed
+		}
+		ranks[t.file] = r
+	}
+
+	slices.SortStableFunc(targets, func(a, b verifyTarget) int {
+		ra, rb := ranks[a.file], ranks[b.file]
+		if c := cmp.Compare(ra.priority, rb.priority); c != 0 {
+			return c
+		}
+		// 新しく書き換えたものから
+		return rb.modTime.Compare(ra.modTime)
+	})
+}
+
+// latestModTime は files のうち最も新しい更新時刻を返す
+func latestModTime(files []string) time.Time {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,277 @@
+// Package render は verify の結果を aoj-verify の CLI と同じ形の文字列にする。
+// aoj-verify を組み込むツールが書式を実装し直さずに同じ出力を作れるようにする
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultColumnWidth は Diff で左右に並べるときの片側の既定の幅
+const DefaultColumnWidth = 48
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+type Options struct {
+	// Color が true なら ANSI エスケープシーケンスで色を付ける
+	Color bool
+	// ColumnWidth は Diff の片側の幅。0 なら DefaultColumnWidth
+	ColumnWidth int
+}
+
+func (o Options) columnWidth() int {
+	if o.ColumnWidth <= 0 {
+		return DefaultColumnWidth
+	}
+	return o.ColumnWidth
+}
+
+// Case は 1 ケースの結果。Status は "AC", "WA", "TLE", "RE", "OLE", "NOT_RUN", "SKIPPED" のどれか
+type Case struct {
+	Name   string
+	Status string
+}
+
+// Result は 1 ファイル分の verify の結果
+type Result struct {
+	Cases []Case
+}
+
+// detailOrder は Summary で AC 以外の内訳を並べる順
+var detailOrder = []string{"WA", "TLE", "RE", "OLE", "NOT_RUN", "SKIPPED"}
+
+// Summary は "2/3 AC (WA 1)" の形で結果をまとめる。SKIPPED のケースは分母に含めない
+func Summary(r *Result, opts Options) string {
+	counts := make(map[string]int)
+	for _, c := range r.Cases {
+		counts[c.Status]++
+	}
+
+	judged := len(r.Cases) - counts["SKIPPED"]
+	verdict := fmt.Sprintf("%d/%d AC", counts["AC"], judged)
+	if opts.Color {
+		color := ansiRed
+		if counts["AC"] > 0 && counts["AC"] == judged {
+			color = ansiGreen
+		}
+		verdict = color + verdict + ansiReset
+	}
+
+	var details []string
+	for _, status := range detailOrder {
+		if counts[status] > 0 {
+			details = append(details, fmt.Sprintf("%s %d", status, counts[status]))
+		}
+	}
+	if len(details) == 0 {
+		return verdict
+	}
+	return fmt.Sprintf("%s (%s)", verdict, strings.Join(details, ", "))
+}
+
+// Diff は actual と expected を 1 行ずつ左右に並べる。食い違った最初の行に ">"、以降の食い違った行に "!" を付ける
+func Diff(actual, expected []byte, opts Options) string {
+	var b strings.Builder
+	d := NewDiffWriter(&b, bytes.NewReader(expected), opts)
+	d.Write(actual)
+	d.Flush()
+	return b.String()
+}
+
+// DiffWriter は書き込まれた出力を 1 行ずつ、expected と左右に並べて w に書き出す。
+// 書き込まれた端から表示するので、実行中の出力を流し込むのにも使える
+type DiffWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	expected *bufio.Reader
+	opts     Options
+	pending  []byte
+	line     int
+	diverged bool
+}
+
+// NewDiffWriter は見出しの行を w に書き出して DiffWriter を返す
+func NewDiffWriter(w io.Writer, expected io.Reader, opts Options) *DiffWriter {
+	d := &DiffWriter{w: w, expected: bufio.NewReader(expected), opts: opts}
+	fmt.Fprintf(w, "%5s  %-*s | %s\n", "line", opts.columnWidth(), "output", "expected")
+	return d
+}
+
+func (d *DiffWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = append(d.pending, p...)
+	for {
+		i := bytes.IndexByte(d.pending, '\n')
+		if i < 0 {
+			break
+		}
+		d.printLine(string(d.pending[:i]))
+		d.pending = d.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush は出力が終わったときに呼び、改行で終わっていない最後の行と、出力されなかった期待される行を書き出す
+func (d *DiffWriter) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.pending) > 0 {
+		d.printLine(string(d.pending))
+		d.pending = nil
+	}
+
+	for {
+		expected, ok := d.readExpectedLine()
+		if !ok {
+			return
+		}
+		d.line++
+		d.printRow("", expected, true)
+	}
+}
+
+func (d *DiffWriter) printLine(actual string) {
+	d.line++
+	expected, ok := d.readExpectedLine()
+	d.printRow(actual, expected, !ok || actual != expected)
+}
+
+func (d *DiffWriter) printRow(actual, expected string, differs bool) {
+	width := d.opts.columnWidth()
+	left := fmt.Sprintf("%-*s", width, truncateColumn(actual, width))
+	right := truncateColumn(expected, width)
+
+	marker := " "
+	if differs {
+		marker = "!"
+		if !d.diverged {
+			d.diverged = true
+			marker = ">"
+		}
+	}
+
+	if d.opts.Color && differs {
+		fmt.Fprintf(d.w, "%5d%s %s%s%s | %s%s%s\n", d.line, marker, ansiRed, left, ansiReset, ansiGreen, right, ansiReset)
+		return
+	}
+	fmt.Fprintf(d.w, "%5d%s %s | %s\n", d.line, marker, left, right)
+}
+
+func (d *DiffWriter) readExpectedLine() (string, bool) {
+	line, err := d.expected.ReadString('\n')
+	if line == "" && err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), true
+}
+
+// truncateColumn は s を幅 width に収まるように切り詰める
+func truncateColumn(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// diffLineWidth は UnifiedDiff で 1 行を切り詰める幅
+const diffLineWidth = 160
+
+// UnifiedDiff は expected と actual を行番号で対応させて比べ、食い違った行を最初の maxLines 行まで unified diff の形で返す。
+// 出力が大きくても全体を読み込まないように、行の挿入や削除は探さない。一致すれば空文字を返す
+func UnifiedDiff(actual, expected io.Reader, maxLines int, opts Options) (string, error) {
+	a, e := bufio.NewReader(actual), bufio.NewReader(expected)
+
+	// 続けて食い違った行を 1 つの hunk にまとめ、期待される行を先に、出力の行を後に並べる
+	var b strings.Builder
+	var removed, added []string
+	hunkStart := 0
+	flushHunk := func() {
+		if len(removed) == 0 && len(added) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", hunkStart, len(removed), hunkStart, len(added))
+		for _, line := range removed {
+			b.WriteString(colorize("-"+line, ansiRed, opts))
+		}
+		for _, line := range added {
+			b.WriteString(colorize("+"+line, ansiGreen, opts))
+		}
+		removed, added = nil, nil
+	}
+
+	differing := 0
+	for line := 1; ; line++ {
+		al, aok, err := readDiffLine(a)
+		if err != nil {
+			return "", err
+		}
+		el, eok, err := readDiffLine(e)
+		if err != nil {
+			return "", err
+		}
+		if !aok && !eok {
+			break
+		}
+
+		if aok && eok && al == el {
+			flushHunk()
+			continue
+		}
+
+		if differing == maxLines {
+			flushHunk()
+			b.WriteString("... (more differences)\n")
+			break
+		}
+		differing++
+
+		if len(removed) == 0 && len(added) == 0 {
+			hunkStart = line
+		}
+		if eok {
+			removed = append(removed, truncateColumn(el, diffLineWidth))
+		}
+		if aok {
+			added = append(added, truncateColumn(al, diffLineWidth))
+		}
+	}
+	flushHunk()
+
+	if b.Len() == 0 {
+		return "", nil
+	}
+	return "--- expected\n+++ output\n" + b.String(), nil
+}
+
+func colorize(line, color string, opts Options) string {
+	if opts.Color {
+		return color + line + ansiReset + "\n"
+	}
+	return line + "\n"
+}
+
+// readDiffLine は r から改行を除いた 1 行を読む。読み終わっていれば false を返す
+func readDiffLine(r *bufio.Reader) (string, bool, error) {
+	line, err := r.ReadString('\n')
+	if line == "" && err == io.EOF {
+		return "", false, nil
+	}
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	return strings.TrimSuffix(line, "\n"), true, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matumoto1234/aoj-verify/cassette"
+)
+
+// replayProblemURL は testdata/cassettes/ITP1_1_B に記録した問題。ケースは 2, 3, 10 の 3 乗を答える 3 つ
+const replayProblemURL = "https://onlinejudge.u-aizu.ac.jp/courses/lesson/2/ITP1/1/ITP1_1_B"
+
+// useCassette は記録したやりとりだけを返すように httpClient を差し替え、空の一時ディレクトリに移る。
+// ネットワークにも、実行したディレクトリのキャッシュにも触れずにダウンロードから verify までを動かせる
+func useCassette(t *testing.T, name string) {
+	t.Helper()
+
+	fixtures, err := filepath.Abs(filepath.Join("testdata", "cassettes", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := httpClient.Transport
+	httpClient.Transport = &cassette.Transport{Mode: cassette.Replay, Dir: fixtures}
+	t.Cleanup(func() { httpClient.Transport = prev })
+
+	t.Chdir(t.TempDir())
+}
+
+// writeSolution は problemURL を解く Go の verification file を書く
+func writeSolution(t *testing.T, problemURL, body string) string {
+	t.Helper()
+
+	err := os.WriteFile("go.mod", []byte("module replay\n\ngo 1.24\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := "// verification-helper: PROBLEM " + problemURL + "\n" +
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tvar x int\n\tfmt.Scan(&x)\n\t" + body + "\n}\n"
+	err = os.WriteFile("sol.go", []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "sol.go"
+}
+
+func TestReplayDownloadTestcases(t *testing.T) {
+	useCassette(t, "ITP1_1_B")
+	ctx := context.Background()
+	opts := &downloadOptions{headerTTL: time.Hour, sources: []testcaseSource{&judgedatSource{baseURL: judgedatBaseURL}}}
+
+	cacheDir, err := downloadTestcases(ctx, replayProblemURL, opts)
+	if err != nil {
+		t.Fatalf("downloadTestcases: %v", err)
+	}
+
+	want := map[string]string{
+		"in1.in": "2\n", "in1.out": "8\n",
+		"in2.in": "3\n", "in2.out": "27\n",
+		"in3.in": "10\n", "in3.out": "1000\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(cacheDir, name))
+		if err != nil {
+			t.Errorf("read %s: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+
+	// 揃ったキャッシュからは、記録が無くてもダウンロードせずに済む
+	httpClient.Transport = &cassette.Transport{Mode: cassette.Replay, Dir: t.TempDir()}
+	_, err = downloadTestcases(ctx, replayProblemURL, opts)
+	if err != nil {
+		t.Errorf("downloadTestcases with a full cache: %v", err)
+	}
+}
+
+func TestReplayVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantExit int
+	}{
+		{name: "accepted", body: "fmt.Println(x * x * x)", wantExit: exitOK},
+		{name: "wrong answer", body: "fmt.Println(x * x)", wantExit: exitFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCassette(t, "ITP1_1_B")
+			file := writeSolution(t, replayProblemURL, tt.body)
+
+			err := runVerify([]string{file})
+			if got := exitCode(err); got != tt.wantExit {
+				t.Errorf("exit code = %d (err %v), want %d", got, err, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestReplayNotRecordedIsNotInfra(t *testing.T) {
+	useCassette(t, "ITP1_1_B")
+	// ITP1_1_C は記録していないので、何度やり直しても同じように失敗する
+	file := writeSolution(t, strings.Replace(replayProblemURL, "ITP1_1_B", "ITP1_1_C", 1), "fmt.Println(x)")
+
+	err := runVerify([]string{file})
+	if err == nil {
+		t.Fatal("runVerify succeeded without recorded responses")
+	}
+	if got := exitCode(err); got != exitFailure {
+		t.Errorf("exit code = %d (err %v), want %d", got, err, exitFailure)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/matumoto1234/aoj-verify/language"
+)
+
+// writeReproScript は失敗したケースを aoj-verify 無しで再現するための repro.sh を dir に書き出す。
+// 失敗したケースの .in / .out も dir にコピーする
+func writeReproScript(dir string, buildFilenames []string, buildTags []string, failing []*runResult) (string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	// 出力先は repro.sh の隣にする
+	buildArgs, runArgs := []string(nil), []string{"$here/main"}
+	switch lang := lookupLanguage(buildFilenames[0]); {
+	case lang.HasTemplates():
+		var vars language.Vars
+		vars, err = languageVars(buildFilenames, "$here/main")
+		vars.Dir = "$here"
+		buildArgs, runArgs = lang.CompileCommand(vars), lang.RunCommand(vars)
+	case lang == cppLanguage:
+		buildArgs, err = cppBuildArgs(buildFilenames, "$here/main")
+	default:
+		buildArgs, err = goBuildArgs(buildFilenames, "$here/main", buildTags)
+		buildArgs = append([]string{"go"}, buildArgs...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	tool := currentBuildMetadata()
+	fmt.Fprintf(&b, "# generated by aoj-verify %s (commit %s)\n", tool.Version, tool.Commit)
+	b.WriteString("set -u\n\n")
+	b.WriteString("cd \"$(dirname \"$0\")\"\n\n")
+
+	b.WriteString("# environment\n")
+	for _, key := range []string{"GOOS", "GOARCH", "CGO_ENABLED", "GOFLAGS"} {
+		if v, ok := os.LookupEnv(key); ok {
+			fmt.Fprintf(&b, "export %s=%s\n", key, shellQuote(v))
+		}
+	}
+	b.WriteString("\n")
+
+	// ビルドはモジュールのあるディレクトリで実行し、バイナリだけ repro.sh の隣に出力する
+	b.WriteString("# build\n")
+	b.WriteString("here=\"$(pwd)\"\n")
+	if len(buildArgs) > 0 {
+		fmt.Fprintf(&b, "(cd %s && %s) || exit 1\n", shellQuote(wd), shellJoinHere(buildArgs))
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# judge\n")
+	b.WriteString("status=0\n")
+	for _, r := range failing {
+		name := filepath.Base(r.testcaseName)
+
+		for _, ext := range []string{".in", ".out"} {
+			err := copyFile(r.testcaseName+ext, filepath.Join(dir, name+ext))
+			if err != nil {
+				return "", fmt.Errorf("failed to copy testcase: %w", err)
+			}
+		}
+
+		fmt.Fprintf(&b, "# %s was %s\n", name, r.status)
+		fmt.Fprintf(&b, "%s < %s > %s\n", shellJoinHere(runArgs), shellQuote(name+".in"), shellQuote(name+".actual"))
+		fmt.Fprintf(&b, "if cmp -s %s %s; then echo %s; else echo %s; status=1; fi\n",
+			shellQuote(name+".actual"), shellQuote(name+".out"),
+			shellQuote(name+": AC"), shellQuote(name+": not AC"))
+	}
+	b.WriteString("exit $status\n")
+
+	path := filepath.Join(dir, "repro.sh")
+	err = os.WriteFile(path, []byte(b.String()), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to write repro script: %w", err)
+	}
+
+	return path, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// shellQuote は s を POSIX sh のシングルクォートで囲む
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellJoinHere は args をシェルのコマンドラインにする。$here で始まる引数は展開されるように二重引用符で囲む
+func shellJoinHere(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "$here") {
+			quoted[i] = `"` + arg + `"`
+		} else {
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
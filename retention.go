@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type retentionPolicy string
+
+const (
+	// keepFailing は AC 以外のケースの出力だけを残す
+	keepFailing retentionPolicy = "failing"
+	keepAll     retentionPolicy = "all"
+	keepNone    retentionPolicy = "none"
+)
+
+func parseRetentionPolicy(s string) (retentionPolicy, error) {
+	switch p := retentionPolicy(s); p {
+	case keepFailing, keepAll, keepNone:
+		return p, nil
+	default:
+		errMsg := fmt.Sprintf("unknown retention policy %q. must be one of failing, all, none", s)
+		return "", errors.New(errMsg)
+	}
+}
+
+// outputRetention は解答プログラムの出力を run ごとのディレクトリに残す
+type outputRetention struct {
+	policy retentionPolicy
+	dir    string
+}
+
+func newOutputRetention(policy retentionPolicy, outputsDir string, startedAt time.Time) *outputRetention {
+	return &outputRetention{
+		policy: policy,
+		dir:    filepath.Join(outputsDir, startedAt.Format("20060102-150405")),
+	}
+}
+
+// retain はポリシーに従って result の出力を残し、result.answerFilepath を残した先に書き換える
+func (r *outputRetention) retain(result *runResult) error {
+	switch {
+	case r.policy == keepNone:
+		return nil
+	case r.policy == keepFailing && result.status == accepted:
+		return nil
+	case !result.status.judged():
+		return nil
+	case result.answerFilepath == "":
+		// パイプで照合したケースには残す出力が無い
+		return nil
+	}
+
+	err := os.MkdirAll(r.dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	ext := ".out"
+	if result.interactive {
+		ext = ".transcript"
+	}
+	dst := filepath.Join(r.dir, filepath.Base(result.testcaseName)+ext)
+	err = os.Rename(result.answerFilepath, dst)
+	if err != nil {
+		return fmt.Errorf("failed to move output: %w", err)
+	}
+
+	result.answerFilepath = dst
+	slog.Info("output retained", slog.String("testcase", result.testcaseName), slog.String("path", dst))
+	return nil
+}
+
+// constructOutputsDirPath は残した出力を置くディレクトリのパスを返す
+func constructOutputsDirPath(cacheDir string) string {
+	return filepath.Join(filepath.Dir(cacheDir), "outputs")
+}
+
+// cleanupRetainedOutputs は outputsDir 以下で maxAge より古い run のディレクトリを削除する
+func cleanupRetainedOutputs(outputsDir string, maxAge time.Duration) error {
+	entries, err := os.ReadDir(outputsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var multiErr error
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+			continue
+		}
+		if time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(outputsDir, e.Name()))
+		if err != nil {
+			multiErr = errors.Join(multiErr, err)
+		}
+	}
+
+	return multiErr
+}
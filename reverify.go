@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseAge は "90d" のような日数か、time.Duration の書式で書かれた期間を読む
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			errMsg := fmt.Sprintf("invalid number of days: %q", s)
+			return 0, errors.New(errMsg)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// sourceHash は buildFilenames と、それが依存しているリポジトリ内のパッケージの Go ファイルや C++ のヘッダの中身から求めたハッシュを返す。
+// ライブラリを書き換えたときも、それを使っている verification file が変わったと分かるようにする
+func sourceHash(buildFilenames []string) (string, error) {
+	files := slices.Clone(buildFilenames)
+
+	switch lang := lookupLanguage(buildFilenames[0]); {
+	case lang.HasTemplates():
+		// 設定ファイルで定義された言語の依存関係は分からないので、ビルドに渡すファイルだけを見る
+	case lang == cppLanguage:
+		for _, f := range buildFilenames {
+			deps, err := cppDependencies(f)
+			if err != nil {
+				return "", err
+			}
+			files = append(files, deps...)
+		}
+	default:
+		dirs, err := dependentPackageDirs(buildFilenames[:1])
+		if err != nil {
+			return "", err
+		}
+		for dir := range dirs {
+			matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+			if err != nil {
+				return "", err
+			}
+			files = append(files, matches...)
+		}
+	}
+
+	for i, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return "", err
+		}
+		files[i] = abs
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		body, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		// ファイルの境目がずれても同じハッシュにならないように、パスと長さも混ぜる
+		fmt.Fprintf(h, "%s\x00%d\x00", f, len(body))
+		h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// staleAfter は file を再 verify するまでの期間を返す。
+// 一度にまとめて verify したファイルが同じ run でまとめて古くならないように、ファイルごとに budget の半分から budget までにずらす
+func staleAfter(file string, budget time.Duration) time.Duration {
+	h := fnv.New32a()
+	io.WriteString(h, filepath.ToSlash(filepath.Clean(file)))
+	frac := float64(h.Sum32()) / float64(1<<32)
+	return budget/2 + time.Duration(float64(budget/2)*frac)
+}
+
+// selectReverifyTargets は前回の verify から変わったもの、前回失敗したもの、前回の verify が staleAfter より古いものだけを返す
+func selectReverifyTargets(targets []verifyTarget, budget time.Duration) ([]verifyTarget, error) {
+	latest, err := loadLatestHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var selected []verifyTarget
+	var fresh int
+	for _, t := range targets {
+		record, ok := latest[filepath.Clean(t.file)]
+		if !ok {
+			slog.Info("reverify: never verified", slog.String("file", t.file))
+			selected = append(selected, t)
+			continue
+		}
+
+		hash, err := sourceHash(t.annotation.sourceFiles(t.file))
+		if err != nil {
+			slog.Warn("reverify: failed to hash sources; verifying anyway", slog.String("file", t.file), slog.Any("error", err))
+			selected = append(selected, t)
+			continue
+		}
+
+		switch {
+		case record.SourceHash != hash:
+			slog.Info("reverify: changed since the last verification", slog.String("file", t.file))
+		case checkExpectation(t.file, t.annotation, record.summary()) != nil:
+			slog.Info("reverify: failed last time", slog.String("file", t.file))
+		case now.Sub(record.StartedAt) > staleAfter(t.file, budget):
+			slog.Info("reverify: stale", slog.String("file", t.file), slog.Time("last verified", record.StartedAt))
+		default:
+			fresh++
+			continue
+		}
+		selected = append(selected, t)
+	}
+
+	slog.Info("reverify", slog.Int("selected", len(selected)), slog.Int("up to date", fresh), slog.Duration("budget", budget))
+	return selected, nil
+}
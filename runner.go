@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/matumoto1234/aoj-verify/render"
+	"github.com/matumoto1234/aoj-verify/stopwatch"
+)
+
+type runCaseOptions struct {
+	// timeLimit が正なら、それを過ぎた時点でプロセスを止めて TLE とする
+	timeLimit time.Duration
+	// timeoutGrace が正なら、制限時間を過ぎたときにまず SIGTERM を送り、これだけ待っても終わらなければ SIGKILL する。
+	// プロファイラなどが後始末をできるようにする
+	timeoutGrace time.Duration
+	// maxOutput が正なら、出力がそれを超えた時点でプロセスを止めて OLE とする
+	maxOutput int64
+	// pipe が true なら出力をファイルに書かず、パイプから読みながら期待される出力と照合する。
+	// 食い違った時点でプロセスを止める
+	pipe bool
+	// checker が空でなければ、出力の比較の代わりにこのチェッカーのバイナリで判定する
+	checker string
+	// compareOptions は checker が無いときの出力の比べ方
+	compareOptions
+	// liveDiff が nil でなければ、実行中の出力を期待される出力と並べてここに流す
+	liveDiff io.Writer
+	// expectedSum が空でなければ期待される出力の sha256。出力を書きながら sha256 を計算し、一致すればファイルを読まずに AC とする
+	expectedSum string
+}
+
+// runCase はケースの入力を標準入力に渡して runArgs を実行し、期待される出力と比較してジャッジする
+func runCase(ctx context.Context, runArgs []string, files *testcaseFiles, tmpDir string, opts *runCaseOptions) (*runResult, error) {
+	base := files.name
+	outFilepath := files.output
+
+	inFile, err := os.Open(files.input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input file: %w", err)
+	}
+	defer inFile.Close()
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if opts.timeLimit > 0 {
+		// 止まらない解答で verify がいつまでも終わらないように、制限時間で打ち切る
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeoutCause(runCtx, opts.timeLimit, errTimeLimitExceeded)
+		defer cancelTimeout()
+	}
+
+	var stdout io.Writer
+	var answerFile *os.File
+	var comparer *streamComparer
+	if opts.pipe {
+		outFile, err := os.Open(outFilepath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output file: %w", err)
+		}
+		defer outFile.Close()
+
+		comparer = newStreamComparer(outFile)
+		defer comparer.release()
+		comparer.diverged = func() { cancel(errOutputMismatch) }
+		stdout = comparer
+	} else {
+		answerFile, err = os.Create(filepath.Join(tmpDir, "answer"+rand.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create answer file: %w", err)
+		}
+		defer answerFile.Close()
+		stdout = answerFile
+	}
+
+	// 出力と同時に sha256 を計算して、書き終えた出力を読み直さずに済むようにする。使うのはバイト列をそのまま比べるときだけ
+	var outputHash hash.Hash
+	if opts.expectedSum != "" && answerFile != nil && opts.checker == "" && opts.pipeline == nil && opts.tolerance == 0 && !opts.tokenCompare {
+		outputHash = sha256.New()
+		stdout = io.MultiWriter(stdout, outputHash)
+	}
+
+	var live *render.DiffWriter
+	if opts.liveDiff != nil {
+		expectedFile, err := os.Open(outFilepath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output file: %w", err)
+		}
+		defer expectedFile.Close()
+
+		live = newLiveDiffWriter(opts.liveDiff, filepath.Base(base), expectedFile, isTerminal(os.Stderr))
+		stdout = io.MultiWriter(stdout, live)
+	}
+
+	// run
+	runCmd := exec.CommandContext(runCtx, runArgs[0], runArgs[1:]...)
+	runCmd.Stdin = inFile
+	runCmd.Stdout = stdout
+	if opts.maxOutput > 0 {
+		// 終了を待たずに書き込み量を見張るため、パイプ越しに受け取る
+		runCmd.Stdout = &limitedWriter{w: stdout, limit: opts.maxOutput, exceeded: cancel}
+	}
+	// panic のメッセージなど、RE の手がかりになるので標準エラー出力を残す
+	stderr := &cappedBuffer{limit: stderrCaptureLimit}
+	runCmd.Stderr = stderr
+	// 標準エラー出力はパイプ越しに受け取るので、子プロセスがパイプを握ったままでも待ち続けないようにする。
+	// WaitDelay を過ぎると exec が SIGKILL するので、SIGTERM の猶予よりも長く待つ
+	runCmd.WaitDelay = max(time.Second, opts.timeoutGrace+time.Second)
+
+	var escalation *time.Timer
+	var escalated atomic.Bool
+	runCmd.Cancel = func() error {
+		if opts.timeoutGrace > 0 && errors.Is(context.Cause(runCtx), errTimeLimitExceeded) {
+			// SIGTERM を送れない環境 (Windows) ではすぐに止める
+			if err := runCmd.Process.Signal(syscall.SIGTERM); err == nil {
+				escalation = time.AfterFunc(opts.timeoutGrace, func() {
+					if runCmd.Process.Kill() == nil {
+						escalated.Store(true)
+					}
+				})
+				return nil
+			}
+		}
+		return runCmd.Process.Kill()
+	}
+
+	var stopwatch stopwatch.Stopwatch
+	stopwatch.Start()
+
+	err = runCmd.Run()
+
+	elapsed := stopwatch.Elapsed()
+	if escalation != nil {
+		escalation.Stop()
+	}
+
+	if live != nil {
+		live.Flush()
+	}
+
+	result := newRunResult(base, unknown, elapsed)
+	result.stderr = stderr.String()
+	result.exitCode = processExitCode(runCmd.ProcessState)
+	if answerFile != nil {
+		result.answerFilepath = answerFile.Name()
+	}
+
+	if errors.Is(context.Cause(runCtx), errOutputLimitExceeded) {
+		result.status = outputLimitExceeded
+		return result, nil
+	}
+
+	if err != nil && ctx.Err() != nil {
+		result.status = notRun
+		return result, nil
+	}
+
+	if errors.Is(context.Cause(runCtx), errTimeLimitExceeded) {
+		result.status = timeLimitExceeded
+		result.timeout = &timeoutDetail{limit: opts.timeLimit, grace: opts.timeoutGrace, killed: escalated.Load() || opts.timeoutGrace <= 0 || killedBySignal(runCmd.ProcessState)}
+		return result, nil
+	}
+
+	if comparer != nil && comparer.mismatch != nil {
+		// 食い違った時点で止めたので、終了コードや実行時間は見ない
+		result.status = wrongAnswer
+		result.mismatch = comparer.mismatch
+		return result, nil
+	}
+
+	if opts.timeLimit > 0 && elapsed > opts.timeLimit {
+		result.status = timeLimitExceeded
+		return result, nil
+	}
+
+	if err != nil {
+		result.status = runtimeError
+		return result, nil
+	}
+
+	if opts.checker != "" {
+		err = answerFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to close answer file: %w", err)
+		}
+
+		ok, msg, err := runChecker(ctx, opts.checker, files.input, result.answerFilepath, outFilepath)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result.status = accepted
+		} else {
+			result.status = wrongAnswer
+			result.checkerMessage = msg
+		}
+		return result, nil
+	}
+
+	// compare output
+	donePhase := profilePhase(ctx, profileCompare)
+	var mismatch *mismatch
+	if comparer != nil {
+		mismatch, err = comparer.finish()
+	} else {
+		err = answerFile.Close()
+		if err != nil {
+			donePhase()
+			return nil, fmt.Errorf("failed to close answer file: %w", err)
+		}
+
+		if opts.pipeline != nil {
+			mismatch, err = compareFilesWithPipeline(result.answerFilepath, outFilepath, opts.pipeline)
+		} else if opts.tolerance > 0 || opts.tokenCompare {
+			mismatch, err = compareFilesWithTolerance(result.answerFilepath, outFilepath, opts.tolerance)
+		} else if outputHash != nil {
+			mismatch, err = compareFilesWithChecksum(result.answerFilepath, outFilepath, hex.EncodeToString(outputHash.Sum(nil)), opts.expectedSum)
+		} else {
+			// 食い違いが見つかった時点で読むのをやめるので、巨大な出力でも WA はすぐ分かる
+			mismatch, err = compareFiles(result.answerFilepath, outFilepath)
+		}
+	}
+	donePhase()
+	if errors.Is(err, errLineTooLong) {
+		// 改行の無い暴走した出力を丸ごと読まないように、比べずに OLE とする
+		result.status = outputLimitExceeded
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare files: %w", err)
+	}
+
+	if mismatch == nil {
+		result.status = accepted
+	} else {
+		result.status = wrongAnswer
+		result.mismatch = mismatch
+	}
+
+	return result, nil
+}
+
+var (
+	errOutputLimitExceeded = errors.New("output limit exceeded")
+	errTimeLimitExceeded   = errors.New("time limit exceeded")
+)
+
+// stderrCaptureLimit はケースごとに残す標準エラー出力の大きさ
+const stderrCaptureLimit = 64 << 10
+
+// cappedBuffer は最初の limit バイトだけを残し、それ以降の書き込みは捨てる。
+// 書き手を止めないように、捨てたときもエラーにはしない
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rest := c.limit - c.buf.Len()
+	if len(p) > rest {
+		c.buf.Write(p[:max(rest, 0)])
+		c.truncated = true
+		return len(p), nil
+	}
+	c.buf.Write(p)
+	return len(p), nil
+}
+
+// ReadFrom は os/exec が標準エラー出力をコピーするたびにバッファを確保しないように、プールのバッファで r を読む
+func (c *cappedBuffer) ReadFrom(r io.Reader) (int64, error) {
+	return pooledCopy(c, r)
+}
+
+func (c *cappedBuffer) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.truncated {
+		return c.buf.String() + "\n... (truncated)"
+	}
+	return c.buf.String()
+}
+
+// limitedWriter は w に書き込んだ量が limit を超えた時点で exceeded を呼び、それ以上は書き込まない
+type limitedWriter struct {
+	w        io.Writer
+	limit    int64
+	written  int64
+	exceeded context.CancelCauseFunc
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.written+int64(len(p)) > l.limit {
+		l.exceeded(errOutputLimitExceeded)
+		return 0, errOutputLimitExceeded
+	}
+
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+// ReadFrom は os/exec が出力をコピーするたびにバッファを確保しないように、プールのバッファで r を読む
+func (l *limitedWriter) ReadFrom(r io.Reader) (int64, error) {
+	return pooledCopy(l, r)
+}
+
+// killedBySignal は state のプロセスが SIGKILL で終わったかを返す
+func killedBySignal(state *os.ProcessState) bool {
+	if state == nil {
+		return false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
+
+// timeoutDetail は制限時間を過ぎて止めたときの様子
+type timeoutDetail struct {
+	limit time.Duration
+	grace time.Duration
+	// killed は SIGTERM で終わらず SIGKILL したか、猶予無しで止めたか
+	killed bool
+}
+
+func (d *timeoutDetail) String() string {
+	switch {
+	case d.grace <= 0:
+		return fmt.Sprintf("killed at the %s limit", d.limit)
+	case d.killed:
+		return fmt.Sprintf("SIGTERM at the %s limit, SIGKILL after %s grace", d.limit, d.grace)
+	default:
+		return fmt.Sprintf("SIGTERM at the %s limit, exited within %s grace", d.limit, d.grace)
+	}
+}
+
+// caseOutcome は並列に実行したケースの結果
+type caseOutcome struct {
+	// dispatched が false なら、中断や fail fast によって実行されなかった
+	dispatched bool
+	result     *runResult
+	err        error
+}
+
+// dispatchCases は最大 jobs 個のケースを同時に judge し、結果を inFilepaths と同じ順の outcomes に送る。
+// ctx が終わったら新しいケースは始めず、残りには dispatched が false の結果を送る
+func dispatchCases(ctx context.Context, jobs int, inFilepaths []string, outcomes []chan caseOutcome, judge func(inFilepath string) caseOutcome) {
+	slots := make(chan struct{}, jobs)
+	for i, inFilepath := range inFilepaths {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// 空きと中断が同時に起きたときも、中断を優先する
+		if ctx.Err() != nil {
+			for _, rest := range outcomes[i:] {
+				rest <- caseOutcome{}
+			}
+			return
+		}
+
+		go func() {
+			outcome := judge(inFilepath)
+			outcome.dispatched = true
+			outcomes[i] <- outcome
+			<-slots
+		}()
+	}
+}
+
+// awaitOutcome は outcome が届くまで待つ。待っている間に tick が来るたびに onTick を呼ぶ
+func awaitOutcome(outcome <-chan caseOutcome, tick <-chan time.Time, onTick func()) caseOutcome {
+	for {
+		select {
+		case o := <-outcome:
+			return o
+		case <-tick:
+			onTick()
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newOutcomes(n int) []chan caseOutcome {
+	outcomes := make([]chan caseOutcome, n)
+	for i := range outcomes {
+		outcomes[i] = make(chan caseOutcome, 1)
+	}
+	return outcomes
+}
+
+func TestDispatchCasesKeepsOrder(t *testing.T) {
+	tests := []struct {
+		jobs  int
+		cases int
+	}{
+		{jobs: 1, cases: 5},
+		{jobs: 3, cases: 8},
+		{jobs: 8, cases: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("jobs=%d cases=%d", tt.jobs, tt.cases), func(t *testing.T) {
+			var inFilepaths []string
+			for i := range tt.cases {
+				inFilepaths = append(inFilepaths, fmt.Sprintf("in%d.in", i))
+			}
+
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			outcomes := newOutcomes(tt.cases)
+			go dispatchCases(context.Background(), tt.jobs, inFilepaths, outcomes, func(inFilepath string) caseOutcome {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+
+				// 後のケースほど早く終わるようにして、終わった順ではなく元の順に受け取れることを確かめる
+				var i int
+				fmt.Sscanf(inFilepath, "in%d.in", &i)
+				time.Sleep(time.Duration(tt.cases-i) * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return caseOutcome{result: newRunResult(inFilepath, accepted, 0)}
+			})
+
+			for i, ch := range outcomes {
+				outcome := <-ch
+				if !outcome.dispatched || outcome.result.testcaseName != inFilepaths[i] {
+					t.Errorf("outcomes[%d] = %+v, want the result of %s", i, outcome, inFilepaths[i])
+				}
+			}
+			if maxRunning > tt.jobs {
+				t.Errorf("%d cases ran at once, want at most %d", maxRunning, tt.jobs)
+			}
+		})
+	}
+}
+
+func TestDispatchCasesStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	inFilepaths := []string{"in0.in", "in1.in", "in2.in", "in3.in"}
+	outcomes := newOutcomes(len(inFilepaths))
+
+	// 1 つずつ実行し、最初のケースが終わったところで中断する
+	go dispatchCases(ctx, 1, inFilepaths, outcomes, func(inFilepath string) caseOutcome {
+		cancel()
+		return caseOutcome{result: newRunResult(inFilepath, accepted, 0)}
+	})
+
+	if outcome := <-outcomes[0]; !outcome.dispatched {
+		t.Error("the first case was not dispatched")
+	}
+	for i, ch := range outcomes[1:] {
+		if outcome := <-ch; outcome.dispatched {
+			t.Errorf("outcomes[%d] was dispatched after cancel", i+1)
+		}
+	}
+}
+
+func TestAwaitOutcomeTicksWhileWaiting(t *testing.T) {
+	outcome := make(chan caseOutcome)
+	tick := make(chan time.Time)
+	ticks := 0
+
+	// 結果が届く前に 2 回 tick が来る。1 ケースが長くても途中経過が出る
+	go func() {
+		tick <- time.Now()
+		tick <- time.Now()
+		outcome <- caseOutcome{result: newRunResult("in0.in", accepted, 0), dispatched: true}
+	}()
+
+	got := awaitOutcome(outcome, tick, func() { ticks++ })
+	if !got.dispatched || got.result.testcaseName != "in0.in" {
+		t.Errorf("awaitOutcome() = %+v, want the result of in0.in", got)
+	}
+	if ticks != 2 {
+		t.Errorf("onTick was called %d times, want 2", ticks)
+	}
+}
+
+func TestRunCaseChecksum(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat is not available")
+	}
+
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+
+	tests := []struct {
+		name        string
+		output      string
+		expected    string
+		expectedSum string
+		want        runStatus
+	}{
+		{name: "same", output: "1\n2\n", expected: "1\n2\n", expectedSum: sum("1\n2\n"), want: accepted},
+		{name: "different", output: "1\n3\n", expected: "1\n2\n", expectedSum: sum("1\n2\n"), want: wrongAnswer},
+		// 一致すれば期待される出力のファイルは読まない
+		{name: "sum matches but file differs", output: "1\n2\n", expected: "stale\n", expectedSum: sum("1\n2\n"), want: accepted},
+		// 一致しなければファイルを読み比べて食い違った位置を探す
+		{name: "stale sum", output: "1\n2\n", expected: "1\n2\n", expectedSum: sum("old\n"), want: accepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := &testcaseFiles{
+				name:   filepath.Join(dir, "case"),
+				input:  filepath.Join(dir, "case.in"),
+				output: filepath.Join(dir, "case.out"),
+			}
+			// cat は入力をそのまま出力するので、入力が解答の出力になる
+			if err := os.WriteFile(files.input, []byte(tt.output), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(files.output, []byte(tt.expected), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := runCase(context.Background(), []string{cat}, files, dir, &runCaseOptions{expectedSum: tt.expectedSum})
+			if err != nil {
+				t.Fatalf("runCase: %v", err)
+			}
+			if result.status != tt.want {
+				t.Errorf("status = %v, want %v", result.status, tt.want)
+			}
+			if tt.want == wrongAnswer && result.mismatch == nil {
+				t.Error("wrong answer without the mismatch position")
+			}
+		})
+	}
+}
+
+func TestRunCaseTimeoutGrace(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		grace  time.Duration
+		killed bool
+	}{
+		{name: "exits on SIGTERM", script: "exec sleep 10", grace: 2 * time.Second, killed: false},
+		// 猶予が WaitDelay の 1 秒より長くても、猶予を過ぎてから SIGKILL したと分かる
+		{name: "ignores SIGTERM", script: "trap '' TERM; exec sleep 10", grace: 2 * time.Second, killed: true},
+		{name: "no grace", script: "exec sleep 10", killed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := &testcaseFiles{
+				name:   filepath.Join(dir, "case"),
+				input:  filepath.Join(dir, "case.in"),
+				output: filepath.Join(dir, "case.out"),
+			}
+			for _, path := range []string{files.input, files.output} {
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := &runCaseOptions{timeLimit: 100 * time.Millisecond, timeoutGrace: tt.grace}
+			result, err := runCase(context.Background(), []string{sh, "-c", tt.script}, files, dir, opts)
+			if err != nil {
+				t.Fatalf("runCase: %v", err)
+			}
+			if result.status != timeLimitExceeded {
+				t.Fatalf("status = %v, want %v", result.status, timeLimitExceeded)
+			}
+			if result.timeout.killed != tt.killed {
+				t.Errorf("timeout = %s, want killed = %v", result.timeout, tt.killed)
+			}
+			if tt.killed && tt.grace > 0 && result.execTime < tt.grace {
+				t.Errorf("killed after %v, want after the %v grace", result.execTime, tt.grace)
+			}
+		})
+	}
+}
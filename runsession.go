@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runSession は 1 回の verify の実行。-resume で中断した実行の続きから verify できるように、verify し終えたファイルを記録する
+type runSession struct {
+	// ID は実行を区別する名前。結果の JSON や history にも記録する
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	// Finished は中断されずに全てのファイルを verify し終えたか
+	Finished bool `json:"finished"`
+	// Files は verify し終えたファイルから、その結果への対応
+	Files map[string]*sessionOutcome `json:"files"`
+}
+
+// sessionOutcome は 1 ファイルを verify した結果。-resume で飛ばしたファイルも、全体の結果にはこれを数える
+type sessionOutcome struct {
+	Error string `json:"error,omitempty"`
+	Infra bool   `json:"infra,omitempty"`
+}
+
+func runSessionPath() string {
+	return filepath.Join(resultsDirPath(), "session.json")
+}
+
+// loadRunSession は最後の実行を返す。記録が無ければ nil を返す
+func loadRunSession() (*runSession, error) {
+	body, err := os.ReadFile(runSessionPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run session: %w", err)
+	}
+
+	s := &runSession{}
+	err = json.Unmarshal(body, s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed run session: %w", err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]*sessionOutcome)
+	}
+	return s, nil
+}
+
+// startRunSession は新しい実行を始める。resume が true で最後の実行が中断されていれば、その続きとして扱う
+func startRunSession(resume bool) (*runSession, error) {
+	if resume {
+		last, err := loadRunSession()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case last == nil:
+			slog.Info("no run to resume; starting a new run")
+		case last.Finished:
+			slog.Info("the last run has finished; starting a new run", slog.String("run", last.ID))
+		default:
+			slog.Info("resuming the interrupted run", slog.String("run", last.ID), slog.Int("verified files", len(last.Files)))
+			return last, nil
+		}
+	}
+
+	now := time.Now()
+	s := &runSession{
+		ID:        now.Format("20060102-150405"),
+		StartedAt: now,
+		Files:     make(map[string]*sessionOutcome),
+	}
+	return s, s.save()
+}
+
+func (s *runSession) save() error {
+	body, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run session: %w", err)
+	}
+
+	return writeFileAtomically(runSessionPath(), append(body, '\n'))
+}
+
+// record は file を verify し終えたことを記録する。err は verifyTargets がそのファイルについて受け取った error
+func (s *runSession) record(file string, err error) error {
+	outcome := &sessionOutcome{}
+	if err != nil && !errors.Is(err, errSkipped) {
+		outcome.Error = err.Error()
+		outcome.Infra = isInfraError(err)
+	}
+	s.Files[file] = outcome
+	return s.save()
+}
+
+// finish は全てのファイルを verify し終えたことを記録し、次の -resume で続きにしないようにする
+func (s *runSession) finish() error {
+	s.Finished = true
+	return s.save()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxTestcaseSize より大きいサイズは API の応答がおかしいとみなす
+const maxTestcaseSize = 1 << 30
+
+// schemaError は API の応答のどのフィールドがおかしかったかを表す
+type schemaError struct {
+	field  string
+	reason string
+}
+
+func (e *schemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.field, e.reason)
+}
+
+func newSchemaError(field, format string, args ...any) error {
+	return &schemaError{field: field, reason: fmt.Sprintf(format, args...)}
+}
+
+// validate は header のレスポンスがジャッジの仕様どおりになっているかを調べる
+func (r *testcasesHeaderResponse) validate(problemID string) error {
+	var errs []error
+
+	if r.ProblemID != "" && r.ProblemID != problemID {
+		errs = append(errs, newSchemaError("problemId", "got %q, want %q", r.ProblemID, problemID))
+	}
+
+	names := make(map[string]int)
+	for i, h := range r.Headers {
+		field := fmt.Sprintf("headers[%d]", i)
+
+		if h == nil {
+			errs = append(errs, newSchemaError(field, "is null"))
+			continue
+		}
+		if strings.TrimSpace(h.Name) == "" {
+			errs = append(errs, newSchemaError(field+".name", "is empty"))
+		} else if j, ok := names[h.Name]; ok {
+			errs = append(errs, newSchemaError(field+".name", "%q duplicates headers[%d]", h.Name, j))
+		} else {
+			names[h.Name] = i
+		}
+		if i > 0 && r.Headers[i-1] != nil && h.Serial <= r.Headers[i-1].Serial {
+			errs = append(errs, newSchemaError(field+".serial", "%d is not greater than the previous serial %d", h.Serial, r.Headers[i-1].Serial))
+		}
+		if h.InputSize < 0 || h.InputSize > maxTestcaseSize {
+			errs = append(errs, newSchemaError(field+".inputSize", "%d is out of range", h.InputSize))
+		}
+		if h.OutputSize < 0 || h.OutputSize > maxTestcaseSize {
+			errs = append(errs, newSchemaError(field+".outputSize", "%d is out of range", h.OutputSize))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("malformed testcase header response: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// errTruncatedTestcase はジャッジが大きいケースを切り詰めて返したことを表す
+var errTruncatedTestcase = errors.New("testcase is truncated by the judge")
+
+// validate はテストケースのレスポンスが h に対応するものになっているかを調べる
+func (t *testcase) validate(problemID string, h *header) error {
+	var errs []error
+
+	if t.ProblemID != "" && t.ProblemID != problemID {
+		errs = append(errs, newSchemaError("problemId", "got %q, want %q", t.ProblemID, problemID))
+	}
+	if t.Serial != 0 && t.Serial != h.Serial {
+		errs = append(errs, newSchemaError("serial", "got %d, want %d", t.Serial, h.Serial))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("malformed testcase response for %s: %w", h.Name, errors.Join(errs...))
+	}
+
+	// judgedat は大きいケースを途中で切り詰めて返すことがあるので、サイズが合わないものは検出する
+	if h.InputSize > 0 && len(t.In) != h.InputSize {
+		errs = append(errs, newSchemaError("in", "has %d bytes but the header says %d", len(t.In), h.InputSize))
+	}
+	if h.OutputSize > 0 && len(t.Out) != h.OutputSize {
+		errs = append(errs, newSchemaError("out", "has %d bytes but the header says %d", len(t.Out), h.OutputSize))
+	}
+	if len(errs) > 0 {
+		errs = append(errs, errTruncatedTestcase)
+		return fmt.Errorf("malformed testcase response for %s: %w", h.Name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate は問題のレスポンスを調べる
+func (p *problemResponse) validate(problemID string) error {
+	var errs []error
+
+	if p.ID != problemID {
+		errs = append(errs, newSchemaError("id", "got %q, want %q", p.ID, problemID))
+	}
+	if p.ProblemTimeLimit < 0 {
+		errs = append(errs, newSchemaError("problemTimeLimit", "%d is negative", p.ProblemTimeLimit))
+	}
+	if p.ProblemMemoryLimit < 0 {
+		errs = append(errs, newSchemaError("problemMemoryLimit", "%d is negative", p.ProblemMemoryLimit))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("malformed problem response: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ownModulePath は aoj-verify 自身の module パス。README やソースのコメントにアノテーションの例があるので、
+// このリポジトリの中でディレクトリを探索すると自分のソースを verification file と取り違える
+const ownModulePath = "github.com/matumoto1234/aoj-verify"
+
+// scanToolDirs が true ならディレクトリの探索で aoj-verify 自身のソースやキャッシュ、一時ディレクトリも除外しない
+var scanToolDirs bool
+
+// skipToolDir は root から始めたディレクトリの探索で dir を除外すべきなら、その理由を返す
+func skipToolDir(root, dir string) string {
+	if scanToolDirs {
+		return ""
+	}
+
+	switch {
+	case sameOrUnder(dir, workDir), sameOrUnder(dir, cacheRootPath()):
+		return "cache directory of aoj-verify"
+	// プロジェクトそのものが一時ディレクトリにあるときは除外しない
+	case sameOrUnder(dir, os.TempDir()) && !sameOrUnder(root, os.TempDir()):
+		return "temporary directory"
+	case isOwnModuleRoot(dir):
+		return "source of aoj-verify itself"
+	}
+	return ""
+}
+
+// isOwnModuleRoot は dir が aoj-verify 自身の module のルートかを返す
+func isOwnModuleRoot(dir string) bool {
+	if !existsFileOrDir(filepath.Join(dir, "go.mod")) {
+		return false
+	}
+	modulePath, err := findModulePath(dir)
+	return err == nil && modulePath == ownModulePath
+}
+
+// sameOrUnder は path が dir そのものか、その下にあるかを返す
+func sameOrUnder(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// walkSkipToolDir は filepath.WalkDir の中で、除外するディレクトリなら警告して true を返す
+func walkSkipToolDir(root, path string) bool {
+	reason := skipToolDir(root, path)
+	if reason == "" {
+		return false
+	}
+
+	// 探索の起点そのものを除外するときは、何も見つからない理由が分かるように警告する
+	if path == root {
+		slog.Warn("skipped the directory; pass -scan-tool-dirs or set scanToolDirs in "+projectConfigPath+" to search it anyway", slog.String("dir", path), slog.String("reason", reason))
+	} else {
+		slog.Debug("skipped the directory", slog.String("dir", path), slog.String("reason", reason))
+	}
+	return true
+}
+
+// checkSelfReference は verify すると分かりにくいビルドの失敗になる、自分自身を参照するような構成を見つける。
+// verification file やそのソースがキャッシュの中にあると、キャッシュの掃除でソースが消えたり古いコピーをビルドしたりする。
+// aoj-verify 自身の module の中にあると、ツールの package main と一緒にビルドされて失敗する
+func checkSelfReference(filename string, annotation *Annotation) error {
+	for _, src := range annotation.sourceFiles(filename) {
+		for _, dir := range []string{workDir, cacheRootPath()} {
+			if sameOrUnder(src, dir) {
+				errMsg := message(msgSourceInCacheDir, src, dir)
+				return errors.New(errMsg)
+			}
+		}
+	}
+
+	modulePath, err := findModulePath(filepath.Dir(filename))
+	if err != nil {
+		return fmt.Errorf("failed to find module of %s: %w", filename, err)
+	}
+	if modulePath == ownModulePath && lookupLanguage(filename) == goLanguage {
+		errMsg := message(msgOwnModule, filename)
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
+
+// checkCacheDirPlacement は cacheDir が作業ディレクトリそのものかその親を指していないかを確かめる。
+// そうなっていると、キャッシュの掃除でプロジェクトのファイルを消してしまう
+func checkCacheDirPlacement(cacheDir string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	if sameOrUnder(wd, cacheDir) {
+		errMsg := message(msgCacheDirContainsProject, cacheDir)
+		return errors.New(errMsg)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// selfProfilePhase は -self-profile で時間を集計する aoj-verify 自身の処理の区分
+type selfProfilePhase int
+
+const (
+	profileDownload selfProfilePhase = iota
+	profileWalk
+	profileHash
+	profileCompare
+	numProfilePhases
+)
+
+func (p selfProfilePhase) String() string {
+	switch p {
+	case profileDownload:
+		return "download"
+	case profileWalk:
+		return "walk"
+	case profileHash:
+		return "hash"
+	case profileCompare:
+		return "compare"
+	default:
+		return "unknown"
+	}
+}
+
+// selfProfiling は -self-profile が指定されているか。指定されていなければ profilePhase は f を呼ぶだけにする
+var selfProfiling atomic.Bool
+
+// phaseTotals は区分ごとの経過時間の合計と回数。並列に呼ばれるのでロックを取らずに足し込む
+var phaseTotals [numProfilePhases]struct {
+	elapsed atomic.Int64
+	count   atomic.Int64
+}
+
+// profilePhase はここから返した関数を呼ぶまでを phase として記録する。e.g. defer profilePhase(ctx, profileHash)()
+// -self-profile のときは CPU プロファイルでこの goroutine (とここから起動した goroutine) に phase のラベルを付け、経過時間を集計する。
+// 終わったら ctx のラベルに戻すので、ctx の無い処理の中で呼ぶと、残りの処理からは外側のラベルが外れる
+func profilePhase(ctx context.Context, phase selfProfilePhase) (done func()) {
+	if !selfProfiling.Load() {
+		return func() {}
+	}
+
+	start := time.Now()
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels("phase", phase.String())))
+	return func() {
+		pprof.SetGoroutineLabels(ctx)
+		phaseTotals[phase].elapsed.Add(int64(time.Since(start)))
+		phaseTotals[phase].count.Add(1)
+	}
+}
+
+// startSelfProfile は path への CPU プロファイルの記録を始め、止めて区分ごとの時間を表示する関数を返す。
+// 1000 ファイルあるようなリポジトリで、aoj-verify 自身のどこが遅いかを `go tool pprof -tagfocus phase=...` で調べられるようにする
+func startSelfProfile(path string) (stop func(), err error) {
+	if path == "" {
+		return func() {}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile: %w", err)
+	}
+	err = pprof.StartCPUProfile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to start profile: %w", err)
+	}
+	selfProfiling.Store(true)
+
+	return func() {
+		pprof.StopCPUProfile()
+		err := f.Close()
+		if err != nil {
+			slog.Warn("failed to write profile", slog.String("path", path), slog.Any("error", err))
+			return
+		}
+
+		// 並列に実行した区分の時間は、それぞれの goroutine での時間の合計になる
+		for phase := range numProfilePhases {
+			t := &phaseTotals[phase]
+			slog.Info("self profile", slog.String("phase", phase.String()), slog.Int64("calls", t.count.Load()), slog.Duration("total", time.Duration(t.elapsed.Load())))
+		}
+		slog.Info("wrote self profile", slog.String("path", path))
+	}, nil
+}
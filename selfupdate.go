@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const releasesAPIURL = "https://api.github.com/repos/matumoto1234/aoj-verify/releases"
+
+// checksumsAssetName はリリースに添付される sha256sum 形式のチェックサムのファイル名
+const checksumsAssetName = "checksums.txt"
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// runSelfUpdate は GitHub のリリースから今の OS/アーキテクチャ向けのバイナリを取得し、チェックサムを確かめてから実行中のバイナリを置き換える
+func runSelfUpdate(args []string) error {
+	fset := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fset.Bool("check", false, "only report whether a newer release is available")
+	version := fset.String("version", "", "install this release tag instead of the latest one")
+	fset.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// ジャッジ向けの politeness とは関係ないので judgeTransport は通さない
+	client := &http.Client{}
+
+	rel, err := fetchRelease(ctx, client, *version)
+	if err != nil {
+		return err
+	}
+
+	current := toolVersion()
+	if rel.TagName == current {
+		slog.Info("already up to date", slog.String("version", current))
+		return nil
+	}
+	if *check {
+		slog.Info("update available", slog.String("current", current), slog.String("latest", rel.TagName))
+		return nil
+	}
+
+	binaryName := fmt.Sprintf("aoj-verify_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+	binaryAsset, ok := rel.asset(binaryName)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", rel.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	checksumsAsset, ok := rel.asset(checksumsAssetName)
+	if !ok {
+		// 検証できないものでは置き換えない
+		return errors.New(message(msgUnverifiedRelease, rel.TagName, checksumsAssetName))
+	}
+
+	checksums, err := downloadBytes(ctx, client, checksumsAsset.BrowserDownloadURL)
+	if err != nil {
+		return fmt.Errorf("failed to download checksums: %w", err)
+	}
+	want, err := lookupChecksum(checksums, binaryName)
+	if err != nil {
+		return err
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+	exePath, err = filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+
+	// rename で置き換えられるように同じディレクトリに書き出す
+	tmp, err := os.CreateTemp(filepath.Dir(exePath), ".aoj-verify-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	got, err := downloadTo(ctx, client, binaryAsset.BrowserDownloadURL, tmp)
+	if err != nil {
+		return fmt.Errorf("failed to download binary: %w", err)
+	}
+	if got != want {
+		errMsg := fmt.Sprintf("checksum mismatch for %s: expected %s, got %s", binaryName, want, got)
+		return errors.New(errMsg)
+	}
+
+	err = tmp.Chmod(0755)
+	if err != nil {
+		return fmt.Errorf("failed to chmod: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+
+	err = replaceExecutable(exePath, tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	slog.Info("updated", slog.String("from", current), slog.String("to", rel.TagName), slog.String("path", exePath))
+	return nil
+}
+
+func (r *release) asset(name string) (*releaseAsset, bool) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], true
+		}
+	}
+	return nil, false
+}
+
+// fetchRelease は tag のリリースを返す。tag が空なら最新のリリースを返す
+func fetchRelease(ctx context.Context, client *http.Client, tag string) (*release, error) {
+	apiURL := releasesAPIURL + "/latest"
+	if tag != "" {
+		apiURL = releasesAPIURL + "/tags/" + tag
+	}
+
+	body, err := downloadBytes(ctx, client, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release: %w", err)
+	}
+
+	rel := &release{}
+	err = json.Unmarshal(body, rel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal release: %w", err)
+	}
+	if rel.TagName == "" {
+		return nil, errors.New("release response has no tag_name")
+	}
+
+	return rel, nil
+}
+
+func openDownload(ctx context.Context, client *http.Client, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+func downloadBytes(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	body, err := openDownload(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// downloadTo は url の中身を w に書き出し、その sha256 を返す
+func downloadTo(ctx context.Context, client *http.Client, url string, w io.Writer) (string, error) {
+	body, err := openDownload(ctx, client, url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, h), body)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookupChecksum は sha256sum 形式の checksums から name のチェックサムを探す
+func lookupChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(checksums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+
+	errMsg := fmt.Sprintf("%s has no checksum for %s", checksumsAssetName, name)
+	return "", errors.New(errMsg)
+}
+
+// replaceExecutable は実行中のバイナリ exePath を newPath で置き換える
+func replaceExecutable(exePath, newPath string) error {
+	// Windows では実行中のファイルを上書きできないが、名前を変えることはできる
+	oldPath := exePath + ".old"
+	if runtime.GOOS == "windows" {
+		os.Remove(oldPath)
+		err := os.Rename(exePath, oldPath)
+		if err != nil {
+			return fmt.Errorf("failed to move the running binary aside: %w", err)
+		}
+	}
+
+	err := os.Rename(newPath, exePath)
+	if err != nil {
+		if runtime.GOOS == "windows" {
+			os.Rename(oldPath, exePath)
+		}
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+
+	return nil
+}
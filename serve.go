@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const (
+	fileVerified   = "verified"
+	fileFailed     = "failed"
+	fileUnverified = "unverified"
+)
+
+// repoStatus はリポジトリ全体の verify の状況。履歴の最新の結果から作る
+type repoStatus struct {
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Total       int          `json:"total"`
+	Verified    int          `json:"verified"`
+	Failed      int          `json:"failed"`
+	Unverified  int          `json:"unverified"`
+	Files       []fileStatus `json:"files"`
+}
+
+type fileStatus struct {
+	File       string     `json:"file"`
+	ProblemURL string     `json:"problemUrl"`
+	Status     string     `json:"status"`
+	LastRun    *time.Time `json:"lastRun,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// shieldsBadge は shields.io の endpoint バッジの形式
+type shieldsBadge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// runServe は verify の状況を JSON で返す HTTP サーバーを立てる。
+// 静的なファイルを生成しなくても、バッジやダッシュボードから最新の状況を見られるようにする
+func runServe(args []string) error {
+	fset := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fset.String("addr", "localhost:8080", "address to listen on")
+	fset.Parse(args)
+
+	root := "."
+	if fset.NArg() > 0 {
+		root = fset.Arg(0)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /summary", func(w http.ResponseWriter, r *http.Request) {
+		status, err := collectRepoStatus(root)
+		if err != nil {
+			slog.Error("failed to collect status", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, status)
+	})
+	mux.HandleFunc("GET /badge.json", func(w http.ResponseWriter, r *http.Request) {
+		status, err := collectRepoStatus(root)
+		if err != nil {
+			slog.Error("failed to collect status", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, status.badge())
+	})
+
+	slog.Info("serving verification status", slog.String("addr", *addr), slog.String("root", root))
+	return http.ListenAndServe(*addr, mux)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	// 古い状況がキャッシュされ続けないようにする
+	w.Header().Set("Cache-Control", "no-cache")
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Warn("failed to write response", slog.Any("error", err))
+	}
+}
+
+// collectRepoStatus は root 以下の verification file それぞれについて、最新の履歴から状況を求める
+func collectRepoStatus(root string) (*repoStatus, error) {
+	files, err := findAnnotatedFiles(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find verification files: %w", err)
+	}
+
+	latest, err := loadLatestHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &repoStatus{GeneratedAt: time.Now(), Files: []fileStatus{}}
+	for _, file := range files {
+		st := fileStatus{File: file, Status: fileUnverified}
+
+		annotation, err := readAnnotationInFile(file)
+		if err != nil {
+			st.Status = fileFailed
+			st.Reason = err.Error()
+		} else {
+			st.ProblemURL = annotation.ProblemURL
+			if record, ok := latest[filepath.Clean(file)]; ok {
+				st.LastRun = &record.StartedAt
+				st.Status = fileVerified
+
+				err := checkExpectation(file, annotation, record.summary())
+				if err != nil {
+					st.Status = fileFailed
+					st.Reason = err.Error()
+				}
+			}
+		}
+
+		switch st.Status {
+		case fileVerified:
+			status.Verified++
+		case fileFailed:
+			status.Failed++
+		default:
+			status.Unverified++
+		}
+		status.Files = append(status.Files, st)
+	}
+	status.Total = len(status.Files)
+
+	return status, nil
+}
+
+func (s *repoStatus) badge() *shieldsBadge {
+	b := &shieldsBadge{
+		SchemaVersion: 1,
+		Label:         "verify",
+		Message:       fmt.Sprintf("%d/%d verified", s.Verified, s.Total),
+	}
+
+	switch {
+	case s.Failed > 0:
+		b.Color = "red"
+	case s.Unverified > 0 || s.Total == 0:
+		b.Color = "yellow"
+	default:
+		b.Color = "brightgreen"
+	}
+
+	return b
+}
+
+// summary は履歴のケースの結果を集計する
+func (r *historyRecord) summary() *runSummary {
+	var results []*runResult
+	for _, c := range r.Cases {
+		status, _ := parseRunStatus(c.Status)
+		results = append(results, newRunResult(c.Name, status, c.ExecTime))
+	}
+	return summarize(results)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// clipboardCommands は OS ごとに試すクリップボードへの書き込みコマンド。先に見つかったものを使う
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux":   {{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"clip.exe"}},
+}
+
+// runShow はキャッシュ済みのケースの入力か出力を表示する。ハッシュ化されたキャッシュのパスを探さなくて済むようにする
+func runShow(args []string) error {
+	fset := flag.NewFlagSet("show", flag.ExitOnError)
+	showIn := fset.Bool("in", false, "print the input (default)")
+	showOut := fset.Bool("out", false, "print the expected output")
+	copyToClipboard := fset.Bool("copy", false, "copy the data to the system clipboard instead of printing it")
+	fset.Parse(args)
+
+	if fset.NArg() != 2 {
+		return errors.New("usage: aoj-verify show [-in|-out] [-copy] <file> <case>")
+	}
+	if *showIn && *showOut {
+		return errors.New("-in and -out are mutually exclusive")
+	}
+
+	annotation, err := readAnnotationInFile(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	files, err := findCachedCase(annotation.ProblemURL, fset.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	path := files.input
+	if *showOut {
+		path = files.output
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read testcase: %w", err)
+	}
+
+	if !*copyToClipboard {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+
+	err = copyToSystemClipboard(body)
+	if err != nil {
+		return err
+	}
+	slog.Info("copied to clipboard", slog.String("path", path), slog.Int("bytes", len(body)))
+	return nil
+}
+
+// copyToSystemClipboard は見つかったクリップボードのコマンドに body を渡す
+func copyToSystemClipboard(body []byte) error {
+	for _, command := range clipboardCommands[runtime.GOOS] {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("failed to copy to clipboard with %s: %w\n%s", command[0], err, stderr.String())
+		}
+		return nil
+	}
+
+	errMsg := fmt.Sprintf("no clipboard command found on %s", runtime.GOOS)
+	return errors.New(errMsg)
+}
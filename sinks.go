@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runReport は 1 ファイル分の verify 結果
+type runReport struct {
+	file        string
+	problemURL  string
+	startedAt   time.Time
+	samplesOnly bool
+	environment *environmentInfo
+	sourceHash  string
+	label       string
+	runID       string
+	results     []*runResult
+	summary     *runSummary
+}
+
+// ResultSink は verify の結果の出力先。新しいレポート形式はこれを実装して parseResultSinks に足す
+type ResultSink interface {
+	String() string
+	// caseFinished はケースのジャッジが終わるたびに呼ばれる
+	caseFinished(result *runResult) error
+	// runFinished は 1 ファイルの verify が終わったときに呼ばれる
+	runFinished(report *runReport) error
+}
+
+// resultSinkCloser は全てのファイルを verify し終えたときに、まとめて書き出すものがある ResultSink
+type resultSinkCloser interface {
+	close() error
+}
+
+// failedRunSink はケースを実行する前に失敗したファイルも結果に載せる ResultSink
+type failedRunSink interface {
+	// runFailed はアノテーションの解釈やダウンロード、ビルドなどで失敗して runFinished が呼ばれなかったファイルについて呼ばれる
+	runFailed(record *historyRecord, err error) error
+}
+
+// reportFailedRun は sinks のうち failedRunSink を実装するものに、file が結果を出す前に err で失敗したことを伝える
+func reportFailedRun(sinks []ResultSink, record *historyRecord, err error) {
+	for _, sink := range sinks {
+		f, ok := sink.(failedRunSink)
+		if !ok {
+			continue
+		}
+		err := f.runFailed(record, err)
+		if err != nil {
+			slog.Warn("failed to report results", slog.String("sink", sink.String()), slog.Any("error", err))
+		}
+	}
+}
+
+// closeResultSinks は sinks のうち resultSinkCloser を実装するものを閉じる
+func closeResultSinks(sinks []ResultSink) {
+	for _, sink := range sinks {
+		c, ok := sink.(resultSinkCloser)
+		if !ok {
+			continue
+		}
+		err := c.close()
+		if err != nil {
+			slog.Warn("failed to report results", slog.String("sink", sink.String()), slog.Any("error", err))
+		}
+	}
+}
+
+const defaultResultSinks = "console,history,results"
+
+// parseResultSinks は "console,history,results,json:path,junit:path,webhook:url" 形式の指定を解釈する
+func parseResultSinks(spec string) ([]ResultSink, error) {
+	var sinks []ResultSink
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		kind, arg, _ := strings.Cut(s, ":")
+
+		switch kind {
+		case "":
+			continue
+		case "console":
+			sinks = append(sinks, consoleSink{})
+		case "history":
+			sinks = append(sinks, historySink{})
+		case "results":
+			sinks = append(sinks, resultsDirSink{})
+		case "json":
+			if arg == "" {
+				return nil, errors.New("json sink requires a path, e.g. json:results.json")
+			}
+			sinks = append(sinks, &jsonFileSink{path: arg})
+		case "junit":
+			if arg == "" {
+				return nil, errors.New("junit sink requires a path, e.g. junit:report.xml")
+			}
+			sinks = append(sinks, &junitSink{path: arg})
+		case "webhook":
+			if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+				return nil, fmt.Errorf("webhook sink requires an http(s) url: %s", s)
+			}
+			sinks = append(sinks, &webhookSink{url: arg})
+		default:
+			return nil, fmt.Errorf("unknown result sink: %s", s)
+		}
+	}
+
+	return sinks, nil
+}
+
+// consoleSink はケースごとの結果とサマリーをログに出す
+type consoleSink struct{}
+
+func (consoleSink) String() string { return "console" }
+
+func (consoleSink) caseFinished(result *runResult) error {
+	attrs := []any{slog.String("testcase", result.testcaseName), slog.Any("time", result.execTime)}
+	if result.mismatch != nil {
+		attrs = append(attrs, slog.String("first mismatch", result.mismatch.String()))
+	}
+	if result.checkerMessage != "" {
+		attrs = append(attrs, slog.String("checker", result.checkerMessage))
+	}
+	if result.timeout != nil {
+		attrs = append(attrs, slog.String("timeout", result.timeout.String()))
+	}
+	if result.inputPreview != "" {
+		// 小さいケースなら入力を見るだけで頭の中で再現できる。改行などはログ側でエスケープされる
+		attrs = append(attrs, slog.String("input", result.inputPreview))
+	}
+	slog.Info(result.status.String(), attrs...)
+
+	// ログと同じ出力先に書いて、実行中のケースの表示 (caseSpinner) と混ざらないようにする
+	w := log.Writer()
+	if result.diff != "" {
+		fmt.Fprint(w, result.diff)
+	}
+	if result.stderr != "" {
+		fmt.Fprintf(w, "--- stderr of %s\n%s", filepath.Base(result.testcaseName), result.stderr)
+		if !strings.HasSuffix(result.stderr, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
+
+func (consoleSink) runFinished(report *runReport) error {
+	coverage := "all cases"
+	if report.samplesOnly {
+		coverage = "samples only"
+	}
+
+	summary := report.summary
+	slog.Info("summary",
+		slog.String("verdict", summary.verdict()),
+		slog.String("coverage", coverage),
+		slog.Duration("slowest time", summary.slowestTime),
+		slog.String("slowest case", summary.slowestTestcaseName),
+		slog.Int("AC count", summary.acCount),
+		slog.Int("WA count", summary.waCount),
+		slog.Int("TLE count", summary.tleCount),
+		slog.Int("RE count", summary.reCount),
+		slog.Int("OLE count", summary.oleCount),
+		slog.Int("NOT_RUN count", summary.notRunCount),
+		slog.Int("SKIPPED count", summary.skippedCount),
+	)
+	return nil
+}
+
+// historySink は結果を history.jsonl に追記する
+type historySink struct{}
+
+func (historySink) String() string { return "history" }
+
+func (historySink) caseFinished(*runResult) error { return nil }
+
+func (historySink) runFinished(report *runReport) error {
+	return appendHistory(report.historyRecord())
+}
+
+func (r *runReport) historyRecord() *historyRecord {
+	record := newHistoryRecord(r.file, r.problemURL, r.startedAt, r.results)
+	record.SamplesOnly = r.samplesOnly
+	record.Environment = r.environment
+	record.SourceHash = r.sourceHash
+	record.Label = r.label
+	record.RunID = r.runID
+	return record
+}
+
+type jsonSummary struct {
+	Accepted bool `json:"accepted"`
+	// Verdict はサマリーの判定。ケースを実行する前に失敗したファイルでは "ERROR" になる
+	Verdict string `json:"verdict"`
+	AC      int    `json:"ac"`
+	WA      int    `json:"wa"`
+	TLE     int    `json:"tle"`
+	RE      int    `json:"re"`
+	OLE     int    `json:"ole"`
+	NotRun  int    `json:"notRun"`
+	Skipped int    `json:"skipped"`
+	Total   int    `json:"total"`
+}
+
+type jsonReport struct {
+	*historyRecord
+	Summary jsonSummary `json:"summary"`
+	// Error と FailureKind は、ケースを実行する前に失敗したファイルにだけ付く。FailureKind は failureKind の値
+	Error       string `json:"error,omitempty"`
+	FailureKind string `json:"failureKind,omitempty"`
+}
+
+// errorVerdict はケースを実行する前に失敗したファイルの判定。中断されて verify しなかったファイルは NOT_RUN になる
+const errorVerdict = "ERROR"
+
+func (r *runReport) jsonReport() *jsonReport {
+	s := r.summary
+	return &jsonReport{
+		historyRecord: r.historyRecord(),
+		Summary: jsonSummary{
+			Accepted: s.allAccepted(),
+			Verdict:  s.verdict(),
+			AC:       s.acCount,
+			WA:       s.waCount,
+			TLE:      s.tleCount,
+			RE:       s.reCount,
+			OLE:      s.oleCount,
+			NotRun:   s.notRunCount,
+			Skipped:  s.skippedCount,
+			Total:    s.total,
+		},
+	}
+}
+
+// jsonFileSink はそれまでに verify した全ファイルの結果を JSON の配列として path に書き出す。
+// ケースを実行する前に失敗したファイルも、エラーとともに載せる。
+// path が "-" なら、書き直せないので全てのファイルを verify し終えたときに標準出力に書く
+type jsonFileSink struct {
+	path    string
+	reports []*jsonReport
+}
+
+func (s *jsonFileSink) String() string { return "json:" + s.path }
+
+func (s *jsonFileSink) caseFinished(*runResult) error { return nil }
+
+func (s *jsonFileSink) runFinished(report *runReport) error {
+	s.reports = append(s.reports, report.jsonReport())
+	return s.flush()
+}
+
+func (s *jsonFileSink) runFailed(record *historyRecord, err error) error {
+	// 結果を出した後のチェックで失敗したファイルは、もう載っている
+	if slices.ContainsFunc(s.reports, func(r *jsonReport) bool { return r.File == record.File }) {
+		return nil
+	}
+
+	verdict := errorVerdict
+	if errors.Is(err, errNotRun) {
+		verdict = notRun.String()
+	}
+	s.reports = append(s.reports, &jsonReport{
+		historyRecord: record,
+		Summary:       jsonSummary{Verdict: verdict},
+		Error:         err.Error(),
+		FailureKind:   failureKind(err),
+	})
+	return s.flush()
+}
+
+// flush はそれまでの結果で path を書き直す。path が "-" なら close まで何もしない
+func (s *jsonFileSink) flush() error {
+	if s.path == "-" {
+		return nil
+	}
+
+	body, err := s.marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileWithDir(s.path, body)
+}
+
+func (s *jsonFileSink) close() error {
+	if s.path != "-" {
+		return nil
+	}
+
+	body, err := s.marshal()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(body)
+	return err
+}
+
+func (s *jsonFileSink) marshal() ([]byte, error) {
+	// 1 ファイルも verify しなかったときも、null ではなく空の配列にする
+	reports := s.reports
+	if reports == nil {
+		reports = []*jsonReport{}
+	}
+
+	body, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results: %w", err)
+	}
+	return append(body, '\n'), nil
+}
+
+// resultsDirSink は 1 ファイルの verify が終わるたびに、その結果を resultsDirPath 以下のファイルごとの JSON に書き出す。
+// 長い実行の終わりの方で落ちたり OOM で殺されたりしても、それまでに verify したファイルの結果は残る
+type resultsDirSink struct{}
+
+func (resultsDirSink) String() string { return "results" }
+
+func (resultsDirSink) caseFinished(*runResult) error { return nil }
+
+func (resultsDirSink) runFinished(report *runReport) error {
+	body, err := json.MarshalIndent(report.jsonReport(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	return writeFileAtomically(resultFilePath(report.file), append(body, '\n'))
+}
+
+func resultsDirPath() string {
+	return filepath.Join(workDir, "results")
+}
+
+// resultFilePath は verification file の結果を書き出すファイルのパスを返す。
+// ディレクトリの構成に関わらず 1 段に並ぶように、ファイル名にはパスのハッシュを使う
+func resultFilePath(file string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(filepath.Clean(file))))
+	return filepath.Join(resultsDirPath(), hex.EncodeToString(sum[:8])+".json")
+}
+
+type junitTestsuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Testsuites []junitTestsuite `xml:"testsuite"`
+}
+
+type junitTestsuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       float64         `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Testcases  []junitTestcase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestcase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+// junitSink はそれまでに verify した全ファイルの結果を JUnit XML として path に書き出す
+type junitSink struct {
+	path   string
+	suites []junitTestsuite
+}
+
+func (s *junitSink) String() string { return "junit:" + s.path }
+
+func (s *junitSink) caseFinished(*runResult) error { return nil }
+
+func (s *junitSink) runFinished(report *runReport) error {
+	suite := junitTestsuite{
+		Name:      report.file,
+		Timestamp: report.startedAt.Format(time.RFC3339),
+	}
+	if env := report.environment; env != nil {
+		suite.Properties = []junitProperty{
+			{Name: "aoj-verify.version", Value: env.ToolVersion},
+			{Name: "aoj-verify.commit", Value: env.ToolCommit},
+			{Name: "aoj-verify.buildDate", Value: env.ToolBuildDate},
+		}
+	}
+	for _, r := range report.results {
+		tc := junitTestcase{
+			Name:      filepath.Base(r.testcaseName),
+			Classname: report.file,
+			Time:      r.execTime.Seconds(),
+		}
+		switch r.status {
+		case accepted:
+		case notRun, skippedCase:
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+		default:
+			msg := r.status.String()
+			if r.mismatch != nil {
+				msg += " at " + r.mismatch.String()
+			}
+			if r.checkerMessage != "" {
+				msg += ": " + r.checkerMessage
+			}
+			if r.timeout != nil {
+				msg += " (" + r.timeout.String() + ")"
+			}
+			if r.inputPreview != "" {
+				msg += "; input: " + strconv.Quote(r.inputPreview)
+			}
+			tc.Failure = &junitFailure{Message: msg, Type: r.status.String()}
+			tc.SystemErr = r.stderr
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Time += tc.Time
+		suite.Testcases = append(suite.Testcases, tc)
+	}
+	s.suites = append(s.suites, suite)
+
+	body, err := xml.MarshalIndent(junitTestsuites{Testsuites: s.suites}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal junit report: %w", err)
+	}
+
+	return writeFileWithDir(s.path, append([]byte(xml.Header), append(body, '\n')...))
+}
+
+// webhookSink は 1 ファイルの verify が終わるたびに結果の JSON を url に POST する
+type webhookSink struct {
+	url string
+}
+
+func (s *webhookSink) String() string { return "webhook:" + s.url }
+
+func (s *webhookSink) caseFinished(*runResult) error { return nil }
+
+func (s *webhookSink) runFinished(report *runReport) error {
+	body, err := json.Marshal(report.jsonReport())
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	// ジャッジ向けの politeness とは関係ないので judgeTransport は通さない
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post results: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// writeFileAtomically は書き込みの途中で止まっても path に壊れた内容が残らないように、一時ファイルに書いてから置き換える
+func writeFileAtomically(path string, body []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", path, err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func writeFileWithDir(path string, body []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to mkdir: %w", err)
+	}
+
+	err = os.WriteFile(path, body, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONFileSinkRunFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	sink := &jsonFileSink{path: path}
+	sinks := []ResultSink{consoleSink{}, sink}
+
+	err := sink.runFinished(&runReport{
+		file:    "ok.go",
+		results: []*runResult{newRunResult("1", accepted, time.Millisecond)},
+		summary: summarize([]*runResult{newRunResult("1", accepted, time.Millisecond)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := func(file string, err error) {
+		reportFailedRun(sinks, &historyRecord{File: file, Cases: []historyCase{}}, err)
+	}
+	failed("build.go", errors.New("failed to build"))
+	failed("download.go", &infraError{err: errors.New("failed to download")})
+	// 結果を出した後に失敗したファイルは二重に載せない
+	failed("ok.go", errors.New("expected WA but all 1 case(s) passed"))
+	failed("late.go", errNotRun)
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []struct {
+		File        string `json:"file"`
+		Error       string `json:"error"`
+		FailureKind string `json:"failureKind"`
+		Cases       []any  `json:"cases"`
+		Summary     struct {
+			Accepted bool   `json:"accepted"`
+			Verdict  string `json:"verdict"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(body, &reports); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+
+	if len(reports) != 4 {
+		t.Fatalf("got %d reports, want 4:\n%s", len(reports), body)
+	}
+	if r := reports[0]; r.File != "ok.go" || r.Error != "" || !r.Summary.Accepted {
+		t.Errorf("report of ok.go = %+v", r)
+	}
+	want := []struct{ file, kind, verdict string }{
+		{"build.go", "solution", errorVerdict},
+		{"download.go", "infrastructure", errorVerdict},
+		{"late.go", "not run", "NOT_RUN"},
+	}
+	for i, w := range want {
+		r := reports[i+1]
+		if r.File != w.file || r.Error == "" || r.FailureKind != w.kind || r.Summary.Verdict != w.verdict || r.Summary.Accepted || r.Cases == nil {
+			t.Errorf("report of %s = %+v, want an %s error with %s", w.file, r, w.kind, w.verdict)
+		}
+	}
+}
+
+func TestVerifyTargetsReportsNotRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	fset := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags := registerVerifyFlags(fset)
+	if err := fset.Parse([]string{"-sinks", "console", "-format", "json", "-output", "results.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 始める前に中断されたので、どのファイルも verify しない
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	annotation := &Annotation{ProblemURL: "https://onlinejudge.u-aizu.ac.jp/problems/ITP1_1_A"}
+	err := verifyTargets(ctx, []verifyTarget{{file: "a_test.go", annotation: annotation}, {file: "b_test.go", annotation: annotation}}, flags)
+	if err == nil {
+		t.Fatal("verifyTargets succeeded without verifying")
+	}
+
+	body, err := os.ReadFile("results.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []struct {
+		File    string `json:"file"`
+		Summary struct {
+			Verdict string `json:"verdict"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(body, &reports); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want 2:\n%s", len(reports), body)
+	}
+	for i, file := range []string{"a_test.go", "b_test.go"} {
+		if r := reports[i]; r.File != file || r.Summary.Verdict != "NOT_RUN" {
+			t.Errorf("reports[%d] = %+v, want NOT_RUN for %s", i, r, file)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// testcaseSource はテストケースの取得元。公式の API が落ちていてもミラーやローカルのディレクトリから取得できるようにする
+type testcaseSource interface {
+	String() string
+	fetchHeader(ctx context.Context, problemID string) (*testcasesHeaderResponse, error)
+	fetchTestcase(ctx context.Context, problemID string, h *header) (*testcase, error)
+}
+
+// sampleSource は問題文に載っているサンプルケースも取得できる取得元
+type sampleSource interface {
+	fetchSamples(ctx context.Context, problemID string) ([]*testcase, error)
+}
+
+// judgedatSource は judgedat の API、またはそれと同じ URL 構成のミラー
+type judgedatSource struct {
+	baseURL string
+}
+
+func (s *judgedatSource) String() string {
+	return s.baseURL
+}
+
+func (s *judgedatSource) fetchHeader(ctx context.Context, problemID string) (*testcasesHeaderResponse, error) {
+	apiURL := fmt.Sprintf("%s/testcases/%s/header", s.baseURL, problemID)
+	return fetchProblemTestcasesHeader(ctx, apiURL)
+}
+
+func (s *judgedatSource) fetchTestcase(ctx context.Context, problemID string, h *header) (*testcase, error) {
+	apiURL := fmt.Sprintf("%s/testcases/%s/%d", s.baseURL, problemID, h.Serial)
+	return fetchTestcase(ctx, apiURL)
+}
+
+func (s *judgedatSource) fetchSamples(ctx context.Context, problemID string) ([]*testcase, error) {
+	apiURL := fmt.Sprintf("%s/testcases/samples/%s", s.baseURL, problemID)
+	return fetchSampleTestcases(ctx, apiURL)
+}
+
+// localDirSource は dir/<problemID>/<name>.in, <name>.out に置かれたテストケース
+type localDirSource struct {
+	dir string
+}
+
+func (s *localDirSource) String() string {
+	return "dir:" + s.dir
+}
+
+func (s *localDirSource) fetchHeader(ctx context.Context, problemID string) (*testcasesHeaderResponse, error) {
+	inFilepaths, err := aojCaseSchema.listInputs(filepath.Join(s.dir, problemID))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &testcasesHeaderResponse{ProblemID: problemID}
+	for i, inFilepath := range inFilepaths {
+		base := strings.TrimSuffix(inFilepath, ".in")
+
+		inInfo, err := os.Stat(inFilepath)
+		if err != nil {
+			return nil, err
+		}
+		outInfo, err := os.Stat(base + ".out")
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Headers = append(resp.Headers, &header{
+			Serial:     i + 1,
+			Name:       filepath.Base(base),
+			InputSize:  int(inInfo.Size()),
+			OutputSize: int(outInfo.Size()),
+		})
+	}
+
+	if len(resp.Headers) == 0 {
+		errMsg := fmt.Sprintf("no testcases in %s", filepath.Join(s.dir, problemID))
+		return nil, errors.New(errMsg)
+	}
+
+	return resp, nil
+}
+
+func (s *localDirSource) fetchTestcase(ctx context.Context, problemID string, h *header) (*testcase, error) {
+	base := filepath.Join(s.dir, problemID, h.Name)
+
+	in, err := os.ReadFile(base + ".in")
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.ReadFile(base + ".out")
+	if err != nil {
+		return nil, err
+	}
+
+	return &testcase{ProblemID: problemID, Serial: h.Serial, In: string(in), Out: string(out)}, nil
+}
+
+// parseTestcaseSources はカンマ区切りの取得元の指定を読む。
+// "aoj" は公式の API、"http(s)://..." は同じ構成のミラー、"dir:path" はローカルのディレクトリを表す
+func parseTestcaseSources(spec string) ([]testcaseSource, error) {
+	var sources []testcaseSource
+
+	for _, item := range splitList(spec) {
+		switch {
+		case item == "aoj":
+			sources = append(sources, &judgedatSource{baseURL: judgedatBaseURL})
+		case strings.HasPrefix(item, "http://") || strings.HasPrefix(item, "https://"):
+			sources = append(sources, &judgedatSource{baseURL: strings.TrimSuffix(item, "/")})
+		case strings.HasPrefix(item, "dir:"):
+			sources = append(sources, &localDirSource{dir: strings.TrimPrefix(item, "dir:")})
+		default:
+			errMsg := fmt.Sprintf("unknown testcase source %q. must be aoj, an http(s) URL or dir:path", item)
+			return nil, errors.New(errMsg)
+		}
+	}
+
+	if len(sources) == 0 {
+		sources = append(sources, &judgedatSource{baseURL: judgedatBaseURL})
+	}
+
+	return sources, nil
+}
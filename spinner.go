@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spinnerFrames は caseSpinner が順に表示する文字
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// spinnerInterval は caseSpinner が表示を更新する間隔
+const spinnerInterval = 100 * time.Millisecond
+
+// spinnerMaxCases は caseSpinner が名前を並べる実行中のケースの数。それより多いケースは数だけを表示する
+const spinnerMaxCases = 3
+
+// caseSpinner は端末で、実行中のケースとその経過時間をスピナーと一緒に 1 行で表示し、その場で更新し続ける。
+// 長くかかる TLE 気味のケースでも止まっているように見えないようにする。
+// 実行中はログの出力先をこれに差し替え、ログを書く前にスピナーの行を消すので、終わったケースの行はジャッジ結果の行に置き換わる
+type caseSpinner struct {
+	out io.Writer
+
+	mu      sync.Mutex
+	running []*spinnerCase
+	frame   int
+	// drawn はスピナーの行が表示されていて、ログを書く前に消す必要があるか
+	drawn bool
+
+	prevLogOutput io.Writer
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+type spinnerCase struct {
+	name  string
+	start time.Time
+}
+
+// startCaseSpinner は out へのスピナーの表示を始める。out は端末でなければならない
+func startCaseSpinner(out io.Writer) *caseSpinner {
+	s := &caseSpinner{
+		out:           out,
+		prevLogOutput: log.Writer(),
+		done:          make(chan struct{}),
+	}
+	log.SetOutput(s)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.draw()
+			}
+		}
+	}()
+
+	return s
+}
+
+// track は testcase の実行が始まったことを記録し、終わったときに呼ぶ関数を返す。s が nil なら何もしない
+func (s *caseSpinner) track(testcase string) (done func()) {
+	if s == nil {
+		return func() {}
+	}
+
+	c := &spinnerCase{name: filepath.Base(testcase), start: time.Now()}
+	s.mu.Lock()
+	s.running = append(s.running, c)
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.running = slices.DeleteFunc(s.running, func(r *spinnerCase) bool { return r == c })
+		if len(s.running) == 0 {
+			s.clearLocked()
+		}
+	}
+}
+
+// stop はスピナーを止めて行を消し、ログの出力先を元に戻す。s が nil なら何もしない
+func (s *caseSpinner) stop() {
+	if s == nil {
+		return
+	}
+
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+	log.SetOutput(s.prevLogOutput)
+}
+
+// Write はスピナーの行を消してから p を書く。次の更新でスピナーは p の後ろに表示し直される
+func (s *caseSpinner) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+	return s.out.Write(p)
+}
+
+func (s *caseSpinner) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.running) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var parts []string
+	for _, c := range s.running[:min(len(s.running), spinnerMaxCases)] {
+		parts = append(parts, fmt.Sprintf("%s %.1fs", c.name, now.Sub(c.start).Seconds()))
+	}
+	line := strings.Join(parts, ", ")
+	if rest := len(s.running) - spinnerMaxCases; rest > 0 {
+		line += fmt.Sprintf(" (+%d)", rest)
+	}
+
+	s.frame = (s.frame + 1) % len(spinnerFrames)
+	fmt.Fprintf(s.out, "\r\x1b[K%c %s", spinnerFrames[s.frame], message(msgSpinnerRunning, line))
+	s.drawn = true
+}
+
+func (s *caseSpinner) clearLocked() {
+	if !s.drawn {
+		return
+	}
+	io.WriteString(s.out, "\r\x1b[K")
+	s.drawn = false
+}
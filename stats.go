@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// 統計はローカルに記録するだけで、どこにも送らない。stats enable で明示的に有効にしたときだけ記録する
+
+// downloadStats はテストケースのダウンロードでキャッシュがどれだけ効いたか
+type downloadStats struct {
+	headerCached bool
+	cachedCases  int
+	fetchedCases int
+	// fetchedBytes は新たにダウンロードしたケースの大きさの合計
+	fetchedBytes int64
+}
+
+// statsRecord は 1 ファイル分の verify にかかった時間とキャッシュの効き具合。stats.jsonl に 1 行ずつ追記される
+type statsRecord struct {
+	File         string        `json:"file"`
+	At           time.Time     `json:"at"`
+	Download     time.Duration `json:"download"`
+	Build        time.Duration `json:"build"`
+	Judge        time.Duration `json:"judge"`
+	Cases        int           `json:"cases"`
+	HeaderCached bool          `json:"headerCached"`
+	CachedCases  int           `json:"cachedCases"`
+	FetchedCases int           `json:"fetchedCases"`
+	FetchedBytes int64         `json:"fetchedBytes"`
+}
+
+func statsFilePath() string {
+	return filepath.Join(workDir, "stats.jsonl")
+}
+
+func statsEnabledMarkerPath() string {
+	return filepath.Join(workDir, "stats-enabled")
+}
+
+func statsEnabled() bool {
+	return existsFileOrDir(statsEnabledMarkerPath())
+}
+
+// recordStats は統計が有効なときだけ record を追記する
+func recordStats(record *statsRecord) error {
+	if !statsEnabled() {
+		return nil
+	}
+
+	f, err := os.OpenFile(statsFilePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open stats file: %w", err)
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+
+	return nil
+}
+
+func loadStats() ([]*statsRecord, error) {
+	f, err := os.Open(statsFilePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stats file: %w", err)
+	}
+	defer f.Close()
+
+	var records []*statsRecord
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r statsRecord
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			// 壊れた行は読み飛ばす
+			continue
+		}
+		records = append(records, &r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stats file: %w", err)
+	}
+
+	return records, nil
+}
+
+// runStats は統計の記録を有効・無効にしたり、記録した統計を表示したりする
+func runStats(args []string) error {
+	sub := "show"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "enable":
+		err := os.MkdirAll(workDir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to mkdir: %w", err)
+		}
+		err = os.WriteFile(statsEnabledMarkerPath(), nil, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to enable stats: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, message(msgStatsEnabled, statsFilePath()))
+		return nil
+
+	case "disable":
+		err := os.Remove(statsEnabledMarkerPath())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to disable stats: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, message(msgStatsDisabled))
+		return nil
+
+	case "reset":
+		err := os.Remove(statsFilePath())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to reset stats: %w", err)
+		}
+		return nil
+
+	case "show":
+		fset := flag.NewFlagSet("stats", flag.ExitOnError)
+		top := fset.Int("top", 10, "number of slowest files to show")
+		fset.Parse(args)
+		return showStats(*top)
+
+	default:
+		errMsg := message(msgUnknownStatsCommand, sub)
+		return errors.New(errMsg)
+	}
+}
+
+func showStats(top int) error {
+	records, err := loadStats()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		if !statsEnabled() {
+			fmt.Fprintln(os.Stdout, message(msgNoStats))
+		} else {
+			fmt.Fprintln(os.Stdout, message(msgNoStatsYet))
+		}
+		return nil
+	}
+
+	var download, build, judge time.Duration
+	var headerHits, cachedCases, fetchedCases int
+	for _, r := range records {
+		download += r.Download
+		build += r.Build
+		judge += r.Judge
+		if r.HeaderCached {
+			headerHits++
+		}
+		cachedCases += r.CachedCases
+		fetchedCases += r.FetchedCases
+	}
+
+	n := time.Duration(len(records))
+	fmt.Fprintln(os.Stdout, message(msgStatsVerifications, len(records)))
+	fmt.Fprintln(os.Stdout, message(msgStatsAverageTime, download/n, build/n, judge/n))
+	fmt.Fprintln(os.Stdout, message(msgStatsHeaderCache, percentage(headerHits, len(records))))
+	fmt.Fprintln(os.Stdout, message(msgStatsCaseCache, percentage(cachedCases, cachedCases+fetchedCases), cachedCases, fetchedCases))
+
+	// 並列度やキャッシュの設定を調整する手がかりになるように、遅いファイルを出す
+	slices.SortFunc(records, func(a, b *statsRecord) int {
+		return int((b.Download + b.Build + b.Judge) - (a.Download + a.Build + a.Judge))
+	})
+	fmt.Fprintf(os.Stdout, "\n%s\n", message(msgStatsSlowest))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tAT\tDOWNLOAD\tBUILD\tJUDGE\tCASES")
+	for _, r := range records[:min(top, len(records))] {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", r.File, r.At.Format(time.DateTime), r.Download, r.Build, r.Judge, r.Cases)
+	}
+	return w.Flush()
+}
+
+func percentage(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
@@ -6,16 +6,27 @@ import (
 
 type Stopwatch struct {
 	startTime time.Time
+	lapTime   time.Time
 }
 
 func (sw *Stopwatch) Start() {
 	sw.startTime = time.Now()
+	sw.lapTime = sw.startTime
 }
 
 func (sw *Stopwatch) Reset() {
 	sw.startTime = time.Time{}
+	sw.lapTime = time.Time{}
 }
 
 func (sw *Stopwatch) Elapsed() time.Duration {
 	return time.Since(sw.startTime)
 }
+
+// Lap は前回の Lap (または Start) からの経過時間を返し、計測の区切りを現在時刻に進める
+func (sw *Stopwatch) Lap() time.Duration {
+	now := time.Now()
+	d := now.Sub(sw.lapTime)
+	sw.lapTime = now
+	return d
+}
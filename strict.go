@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// strictMode が true なら、verify の結果を信用できなくなるような警告が出たファイルを失敗として扱う
+var strictMode bool
+
+var (
+	strictMu sync.Mutex
+	// strictWarnings は verify 中のファイルで出た、-strict なら失敗にする警告
+	strictWarnings []string
+)
+
+// warnStrict は警告を出し、-strict のときに verify 中のファイルを失敗にする理由として覚えておく。
+// 切り詰められたケースを飛ばした、サンプルだけで verify したなど、AC でも本当に通るとは言えない状況に使う
+func warnStrict(msg string, args ...any) {
+	slog.Warn(msg, args...)
+
+	strictMu.Lock()
+	defer strictMu.Unlock()
+	strictWarnings = append(strictWarnings, msg)
+}
+
+// checkStrict はこれまでに覚えた警告を捨て、-strict のときは警告があれば error を返す。
+// ファイルごとに呼んで、前のファイルの警告が次のファイルの結果に混ざらないようにする
+func checkStrict() error {
+	strictMu.Lock()
+	warnings := strictWarnings
+	strictWarnings = nil
+	strictMu.Unlock()
+
+	if !strictMode || len(warnings) == 0 {
+		return nil
+	}
+
+	// 同じ警告がケースの数だけ並ばないようにまとめる
+	var reasons []string
+	for _, w := range slices.Compact(slices.Sorted(slices.Values(warnings))) {
+		n := 0
+		for _, v := range warnings {
+			if v == w {
+				n++
+			}
+		}
+		if n > 1 {
+			w = fmt.Sprintf("%s (x%d)", w, n)
+		}
+		reasons = append(reasons, w)
+	}
+
+	return &strictError{reasons: reasons}
+}
+
+// strictError は -strict で警告を失敗として扱ったことを表す
+type strictError struct {
+	reasons []string
+}
+
+func (e *strictError) Error() string {
+	return "strict: " + strings.Join(e.reasons, "; ")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// templatePlaceholder はビルドの前に置き換える {{NAME}} の形のプレースホルダ
+var templatePlaceholder = regexp.MustCompile(`\{\{([A-Z_][A-Z0-9_]*)\}\}`)
+
+// templateName は DEFINE で定義できる名前
+var templateName = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// templateVars はソースの {{NAME}} に埋め込む値を返す。
+// PROBLEM_ID と PROBLEM_URL は常に使え、DEFINE で定義した値はそれより優先する
+func templateVars(a *Annotation) map[string]string {
+	vars := map[string]string{
+		"PROBLEM_URL": a.ProblemURL,
+	}
+	if id, err := extractProblemID(a.ProblemURL); err == nil && id != "" {
+		vars["PROBLEM_ID"] = id
+	}
+	for name, value := range a.Defines {
+		vars[name] = value
+	}
+	return vars
+}
+
+// expandTemplate は src の中の vars にある名前のプレースホルダを値に置き換える。
+// {{NAME}} が Go の複合リテラルなどとして書かれていても壊さないように、知らない名前はそのまま残す
+func expandTemplate(src []byte, vars map[string]string) ([]byte, bool) {
+	expanded := false
+	out := templatePlaceholder.ReplaceAllFunc(src, func(m []byte) []byte {
+		value, ok := vars[string(m[2:len(m)-2])]
+		if !ok {
+			return m
+		}
+		expanded = true
+		return []byte(value)
+	})
+	return out, expanded
+}
+
+// expandSources はプレースホルダを含むソースを展開して dir に書き出し、元のソースの絶対パスから展開したファイルへの対応を返す。
+// 1 つの verification file を、よく似た複数の問題のテンプレートとして使えるようにする
+func expandSources(buildFilenames []string, vars map[string]string, dir string) (map[string]string, error) {
+	expanded := make(map[string]string)
+	for i, f := range buildFilenames {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source: %w", err)
+		}
+
+		out, ok := expandTemplate(src, vars)
+		if !ok {
+			continue
+		}
+
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve source path: %w", err)
+		}
+		// 拡張子で言語を決めるので名前は変えず、同じ名前のファイルがぶつからないようにディレクトリを分ける
+		dst := filepath.Join(dir, "expanded", fmt.Sprint(i), filepath.Base(f))
+		err = writeFileWithDir(dst, out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write expanded source: %w", err)
+		}
+		expanded[abs] = dst
+	}
+
+	return expanded, nil
+}
+
+// writeGoOverlay は go build -overlay に渡す、元のソースを展開したファイルで置き換える指定を書き出す
+func writeGoOverlay(expanded map[string]string, dir string) (string, error) {
+	body, err := json.Marshal(struct {
+		Replace map[string]string
+	}{Replace: expanded})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal overlay: %w", err)
+	}
+
+	path := filepath.Join(dir, "overlay.json")
+	err = os.WriteFile(path, body, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write overlay: %w", err)
+	}
+	return path, nil
+}
+
+// parseDefine は DEFINE の "NAME=value" を分ける
+func parseDefine(value string) (string, string, error) {
+	name, v, ok := strings.Cut(value, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !templateName.MatchString(name) {
+		errMsg := fmt.Sprintf("DEFINE annotation must be NAME=value with an upper-case NAME: %q", value)
+		return "", "", errors.New(errMsg)
+	}
+	return name, strings.TrimSpace(v), nil
+}
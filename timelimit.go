@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// languageFactors は言語ごとにジャッジの制限時間に掛ける係数
+var languageFactors = map[string]float64{
+	"go":  1.0,
+	"cpp": 1.0,
+}
+
+// defaultTimeMargin はジャッジの制限時間に足す既定のマージン
+const defaultTimeMargin = 500 * time.Millisecond
+
+// fallbackTimeLimit はジャッジの制限時間が分からないときの制限時間。
+// 止まらない解答で verify がいつまでも終わらないことが無いようにする
+const fallbackTimeLimit = 10 * time.Second
+
+// timeLimitPolicy はケースごとの制限時間を決める。
+// override があればそれを、無ければ ジャッジの制限時間 × 言語の係数 + マージン を、maxTime で頭打ちにしたものを使う
+type timeLimitPolicy struct {
+	// judgeLimit はジャッジの制限時間。分からなければ 0
+	judgeLimit     time.Duration
+	language       string
+	languageFactor float64
+	// factorSource は languageFactor を言語の係数ではなく別の指定で決めたときの、その出どころ
+	factorSource string
+	margin       time.Duration
+	// maxTime が正なら制限時間をこれ以下にする
+	maxTime time.Duration
+	// override が正なら他の規則を無視してこれを使う。overrideSource はその出どころ
+	override       time.Duration
+	overrideSource string
+}
+
+func newTimeLimitPolicy(judgeLimit time.Duration, language string, margin, maxTime time.Duration) *timeLimitPolicy {
+	factor, ok := languageFactors[language]
+	if !ok {
+		factor = 1.0
+	}
+
+	return &timeLimitPolicy{
+		judgeLimit:     judgeLimit,
+		language:       language,
+		languageFactor: factor,
+		margin:         margin,
+		maxTime:        maxTime,
+	}
+}
+
+// timeLimitSettings は -time-margin, -max-time, -time-factor, -timeout で指定された制限時間の決め方。
+// verify と bisect が同じ制限時間でジャッジするように共有する
+type timeLimitSettings struct {
+	margin  time.Duration
+	maxTime time.Duration
+	factor  float64
+	timeout time.Duration
+}
+
+// policy はジャッジの制限時間 judgeLimit と annotation の TIME_LIMIT を合わせて、filename の制限時間の決め方を返す
+func (s *timeLimitSettings) policy(filename string, annotation *Annotation, judgeLimit time.Duration) *timeLimitPolicy {
+	return newTimeLimitPolicy(judgeLimit, solutionLanguage(filename), s.margin, s.maxTime).
+		withFactor(s.factor, "-time-factor").
+		withOverride(annotation.TimeLimit, "TIME_LIMIT annotation").
+		withOverride(s.timeout, "-timeout")
+}
+
+// withFactor はジャッジの制限時間に掛ける係数を言語の係数の代わりに factor にする。factor が 0 なら何もしない
+func (p *timeLimitPolicy) withFactor(factor float64, source string) *timeLimitPolicy {
+	if factor > 0 {
+		p.languageFactor = factor
+		p.factorSource = source
+	}
+	return p
+}
+
+// withOverride は制限時間を limit に固定する。limit が 0 なら何もしない
+func (p *timeLimitPolicy) withOverride(limit time.Duration, source string) *timeLimitPolicy {
+	if limit > 0 {
+		p.override = limit
+		p.overrideSource = source
+	}
+	return p
+}
+
+// limit は適用する制限時間を返す
+func (p *timeLimitPolicy) limit() time.Duration {
+	return p.limitFor(0)
+}
+
+// limitFor はケースに決められた制限時間 caseLimit を問題の制限時間の代わりに使ったときの制限時間を返す。
+// caseLimit が 0 なら limit と同じ。override があればケースの制限時間よりも優先する
+func (p *timeLimitPolicy) limitFor(caseLimit time.Duration) time.Duration {
+	if p.override > 0 {
+		return p.override
+	}
+
+	judgeLimit := p.judgeLimit
+	if caseLimit > 0 {
+		judgeLimit = caseLimit
+	}
+
+	limit := fallbackTimeLimit
+	if judgeLimit > 0 {
+		limit = time.Duration(float64(judgeLimit)*p.languageFactor) + p.margin
+	}
+
+	if p.maxTime > 0 && limit > p.maxTime {
+		limit = p.maxTime
+	}
+
+	return limit
+}
+
+// String はどの規則で制限時間が決まったかを説明する
+func (p *timeLimitPolicy) String() string {
+	if p.override > 0 {
+		return fmt.Sprintf("set by %s = %s", p.overrideSource, p.override)
+	}
+
+	var parts []string
+	if p.judgeLimit > 0 {
+		factorSource := p.language
+		if p.factorSource != "" {
+			factorSource = p.factorSource
+		}
+		parts = append(parts, fmt.Sprintf("judge limit %s × %.2f (%s) + margin %s", p.judgeLimit, p.languageFactor, factorSource, p.margin))
+	} else {
+		parts = append(parts, fmt.Sprintf("judge limit unknown, fallback %s", fallbackTimeLimit))
+	}
+
+	limit := p.limit()
+	switch {
+	case p.maxTime > 0 && limit == p.maxTime:
+		parts = append(parts, fmt.Sprintf("clamped to -max-time %s", p.maxTime))
+	}
+
+	return fmt.Sprintf("%s = %s", strings.Join(parts, ", "), limit)
+}
+
+// parseCaseTimeLimit は ICPC 形式の .timelimit ファイルのような、秒数だけが書かれた制限時間を解釈する
+func parseCaseTimeLimit(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || seconds <= 0 {
+		errMsg := fmt.Sprintf("invalid time limit %q. must be a positive number of seconds", strings.TrimSpace(s))
+		return 0, errors.New(errMsg)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// caseTimeLimits はケースごとに決められたジャッジの制限時間。
+// ケースと一緒に置かれた .timelimit ファイルを、ジャッジが header で返して manifest に記録したものより優先する
+type caseTimeLimits struct {
+	manifest map[string]float64
+}
+
+// loadCaseTimeLimits は cacheDir の manifest からケースごとの制限時間を読む
+func loadCaseTimeLimits(cacheDir string) (*caseTimeLimits, error) {
+	m, err := loadCaseManifest(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return &caseTimeLimits{manifest: m.TimeLimits}, nil
+}
+
+// of は files のケースの制限時間を返す。決められていなければ 0 を返す
+func (c *caseTimeLimits) of(files *testcaseFiles) (time.Duration, error) {
+	if path, ok := files.auxiliary[".timelimit"]; ok {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read time limit of case: %w", err)
+		}
+		return parseCaseTimeLimit(string(body))
+	}
+
+	if seconds := c.manifest[filepath.Base(files.name)]; seconds > 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return 0, nil
+}
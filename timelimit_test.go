@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeLimitPolicyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		judgeLimit time.Duration
+		language   string
+		margin     time.Duration
+		maxTime    time.Duration
+		factor     float64
+		override   time.Duration
+		want       time.Duration
+	}{
+		{name: "judge limit and margin", judgeLimit: 2 * time.Second, language: "go", margin: 500 * time.Millisecond, want: 2500 * time.Millisecond},
+		{name: "unknown language uses factor 1", judgeLimit: 2 * time.Second, language: "brainfuck", want: 2 * time.Second},
+		{name: "clamped by max time", judgeLimit: 10 * time.Second, language: "go", margin: time.Second, maxTime: 5 * time.Second, want: 5 * time.Second},
+		{name: "below max time", judgeLimit: time.Second, language: "go", maxTime: 5 * time.Second, want: time.Second},
+		{name: "unknown judge limit", language: "go", margin: time.Second, want: fallbackTimeLimit},
+		{name: "unknown judge limit with max time", language: "go", maxTime: 3 * time.Second, want: 3 * time.Second},
+		// -time-factor は言語の係数の代わりに使う
+		{name: "time factor", judgeLimit: 2 * time.Second, language: "go", margin: time.Second, factor: 1.5, want: 4 * time.Second},
+		{name: "time factor clamped by max time", judgeLimit: 2 * time.Second, language: "go", maxTime: 3 * time.Second, factor: 2, want: 3 * time.Second},
+		{name: "time factor without judge limit", language: "go", factor: 2, want: fallbackTimeLimit},
+		// TIME_LIMIT や -timeout は他の規則より優先する
+		{name: "override", judgeLimit: 2 * time.Second, language: "go", margin: time.Second, override: 7 * time.Second, want: 7 * time.Second},
+		{name: "override beyond max time", language: "go", maxTime: 3 * time.Second, override: 7 * time.Second, want: 7 * time.Second},
+		{name: "override with time factor", judgeLimit: 2 * time.Second, language: "go", factor: 3, override: time.Second, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTimeLimitPolicy(tt.judgeLimit, tt.language, tt.margin, tt.maxTime).withFactor(tt.factor, "-time-factor").withOverride(tt.override, "test")
+			if got := p.limit(); got != tt.want {
+				t.Errorf("limit() = %v, want %v (%s)", got, tt.want, p)
+			}
+		})
+	}
+}
+
+func TestTimeLimitPolicyStringNamesFactorSource(t *testing.T) {
+	p := newTimeLimitPolicy(2*time.Second, "go", 0, 0)
+	if got := p.String(); !strings.Contains(got, "(go)") {
+		t.Errorf("String() = %q, want the language as the factor source", got)
+	}
+
+	p.withFactor(1.5, "-time-factor")
+	if got := p.String(); !strings.Contains(got, "× 1.50 (-time-factor)") {
+		t.Errorf("String() = %q, want -time-factor as the factor source", got)
+	}
+}
+
+func TestTimeLimitPolicyLimitFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *timeLimitPolicy
+		caseLimit time.Duration
+		want      time.Duration
+	}{
+		{name: "no case limit", policy: newTimeLimitPolicy(2*time.Second, "go", time.Second, 0), want: 3 * time.Second},
+		{name: "case limit replaces judge limit", policy: newTimeLimitPolicy(2*time.Second, "go", time.Second, 0), caseLimit: 5 * time.Second, want: 6 * time.Second},
+		{name: "case limit without judge limit", policy: newTimeLimitPolicy(0, "go", time.Second, 0), caseLimit: 500 * time.Millisecond, want: 1500 * time.Millisecond},
+		{name: "case limit clamped by max time", policy: newTimeLimitPolicy(2*time.Second, "go", time.Second, 4*time.Second), caseLimit: 5 * time.Second, want: 4 * time.Second},
+		{name: "override wins over case limit", policy: newTimeLimitPolicy(2*time.Second, "go", time.Second, 0).withOverride(time.Second, "test"), caseLimit: 5 * time.Second, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.limitFor(tt.caseLimit); got != tt.want {
+				t.Errorf("limitFor(%v) = %v, want %v (%s)", tt.caseLimit, got, tt.want, tt.policy)
+			}
+		})
+	}
+}
+
+func TestParseCaseTimeLimit(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "2", want: 2 * time.Second},
+		{s: "0.5\n", want: 500 * time.Millisecond},
+		{s: " 1.25 ", want: 1250 * time.Millisecond},
+		{s: "0", wantErr: true},
+		{s: "-1", wantErr: true},
+		{s: "2s", wantErr: true},
+		{s: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseCaseTimeLimit(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCaseTimeLimit(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseCaseTimeLimit(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
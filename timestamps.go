@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// verifiedStamp は 1 ファイルを最後に verify して成功したときの記録
+type verifiedStamp struct {
+	VerifiedAt time.Time `json:"verifiedAt"`
+	// SourceHash はそのときの sourceHash。これが変わっていなければ verify し直さなくてよい
+	SourceHash string `json:"sourceHash"`
+}
+
+// verifiedTimestamps はファイルのパスから、最後に verify して成功したときの記録への対応
+type verifiedTimestamps map[string]*verifiedStamp
+
+func timestampsPath() string {
+	return filepath.Join(workDir, "timestamps.json")
+}
+
+// loadVerifiedTimestamps は timestampsPath の記録を読む。無ければ空の記録を返す
+func loadVerifiedTimestamps() (verifiedTimestamps, error) {
+	stamps := make(verifiedTimestamps)
+
+	body, err := os.ReadFile(timestampsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return stamps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timestamps: %w", err)
+	}
+
+	err = json.Unmarshal(body, &stamps)
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s: %w", timestampsPath(), err)
+	}
+	return stamps, nil
+}
+
+func (s verifiedTimestamps) save() error {
+	body, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal timestamps: %w", err)
+	}
+
+	// 長い実行の途中で止まっても、それまでに成功したファイルの記録は壊さずに残す
+	return writeFileAtomically(timestampsPath(), append(body, '\n'))
+}
+
+func timestampKey(file string) string {
+	return filepath.ToSlash(filepath.Clean(file))
+}
+
+// record は t を verify した結果を記録して保存する。成功すれば今のソースのハッシュを残し、失敗すれば記録を消して次も verify させる
+func (s verifiedTimestamps) record(t verifyTarget, verifyErr error) error {
+	key := timestampKey(t.file)
+	if verifyErr != nil {
+		if _, ok := s[key]; !ok {
+			return nil
+		}
+		delete(s, key)
+		return s.save()
+	}
+
+	hash, err := sourceHash(t.annotation.sourceFiles(t.file))
+	if err != nil {
+		return fmt.Errorf("failed to hash sources: %w", err)
+	}
+	s[key] = &verifiedStamp{VerifiedAt: time.Now(), SourceHash: hash}
+	return s.save()
+}
+
+// selectUnverifiedTargets は最後に verify して成功してからソースが変わったものと、まだ成功したことのないものだけを返す。
+// 300 ファイルあるようなライブラリでも、CI では変更に関係するファイルだけを verify すれば済むようにする
+func selectUnverifiedTargets(targets []verifyTarget, stamps verifiedTimestamps) []verifyTarget {
+	var selected []verifyTarget
+	for _, t := range targets {
+		stamp, ok := stamps[timestampKey(t.file)]
+		if !ok {
+			selected = append(selected, t)
+			continue
+		}
+
+		hash, err := sourceHash(t.annotation.sourceFiles(t.file))
+		if err != nil {
+			slog.Warn("failed to hash sources; verifying anyway", slog.String("file", t.file), slog.Any("error", err))
+			selected = append(selected, t)
+			continue
+		}
+		if hash != stamp.SourceHash {
+			selected = append(selected, t)
+			continue
+		}
+
+		slog.Info("skipped: unchanged since the last successful verification", slog.String("file", t.file), slog.Time("verified at", stamp.VerifiedAt))
+	}
+
+	slog.Info("skip verified", slog.Int("selected", len(selected)), slog.Int("up to date", len(targets)-len(selected)))
+	return selected
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/matumoto1234/aoj-verify/stopwatch"
+)
+
+// verifyFlags は verify を行うコマンドで共通のフラグ
+type verifyFlags struct {
+	tags           *string
+	tagFilter      *string
+	failFast       *bool
+	samplesOnly    *bool
+	samples        *int
+	refresh        *bool
+	headerTTL      *time.Duration
+	keepOutput     *string
+	keepOutputDays *int
+	emitRepro      *bool
+	lockfilePath   *string
+	checkLock      *bool
+	runTimeout     *time.Duration
+	politeness     *string
+	downloadJobs   *int
+	sources        *string
+	maxTime        *time.Duration
+	timeout        *time.Duration
+	timeoutGrace   *time.Duration
+	reverifyStale  *time.Duration
+	chunk          **chunkSpec
+	timeMargin     *time.Duration
+	timeFactor     *float64
+	maxOutputMiB   *int64
+	pipe           *bool
+	liveDiff       *bool
+	jobs           *int
+	previewInput   *int64
+	diffLines      *int
+	showStderr     *bool
+	sinks          *string
+	strictSpace    *bool
+	strict         *bool
+	verbose        *bool
+	label          *string
+	tokens         *bool
+	matrix         *string
+	resume         *bool
+	skipVerified   *bool
+	format         *string
+	output         *string
+
+	// resultSinks は apply で sinks から作る。複数ファイルを verify するときも同じものを使う
+	resultSinks []ResultSink
+
+	// runID は verifyTargets で始めた runSession の ID
+	runID string
+}
+
+func registerVerifyFlags(fset *flag.FlagSet) *verifyFlags {
+	reverifyStale := new(time.Duration)
+	fset.Func("reverify-stale", "verify only files that changed, failed, or were last verified longer ago than this (e.g. 90d); staleness is spread across runs", func(s string) error {
+		var err error
+		*reverifyStale, err = parseAge(s)
+		return err
+	})
+
+	chunk := new(*chunkSpec)
+	fset.Func("chunk", "verify only the i-th of n stable shards of the files, e.g. 2/4 for a CI matrix", func(s string) error {
+		var err error
+		*chunk, err = parseChunkSpec(s)
+		return err
+	})
+
+	return &verifyFlags{
+		reverifyStale:  reverifyStale,
+		chunk:          chunk,
+		tags:           fset.String("tags", "", "comma-separated list of build tags passed to go build"),
+		tagFilter:      fset.String("tag", "", "comma-separated list of TAGS; verify the file only if it has one of them"),
+		failFast:       fset.Bool("fail-fast", false, "stop judging at the first case that is not AC"),
+		samplesOnly:    fset.Bool("samples-only", false, "verify only the smallest cases as a quick smoke check"),
+		samples:        fset.Int("samples", 3, "number of cases used by -samples-only"),
+		refresh:        fset.Bool("refresh", false, "ignore the cached testcase header and fetch it again"),
+		headerTTL:      fset.Duration("header-ttl", time.Hour, "how long the cached testcase header stays valid"),
+		keepOutput:     fset.String("keep-output", string(keepFailing), "which outputs to keep under the cache dir: failing, all or none"),
+		keepOutputDays: fset.Int("keep-output-days", 7, "remove kept outputs older than this many days"),
+		emitRepro:      fset.Bool("emit-repro", false, "write a repro.sh reproducing failing cases next to the kept outputs"),
+		lockfilePath:   fset.String("lockfile", defaultLockfilePath, "fail if cached testcases differ from the checksums pinned in this lockfile"),
+		checkLock:      fset.Bool("check-lock", false, "also fetch the testcases from the judge again and fail if they differ from the lockfile"),
+		runTimeout:     fset.Duration("run-timeout", 0, "abort the whole run after this duration (0 means no limit)"),
+		timeout:        fset.Duration("timeout", 0, "per-case time limit overriding the judge's limit and TIME_LIMIT annotations (0 means derive it)"),
+		timeoutGrace:   fset.Duration("timeout-grace", 200*time.Millisecond, "on timeout send SIGTERM and wait this long before SIGKILL (0 kills immediately)"),
+		maxTime:        fset.Duration("max-time", 0, "upper bound of the per-case time limit (0 means no bound)"),
+		timeMargin:     fset.Duration("time-margin", defaultTimeMargin, "safety margin added to the judge's time limit"),
+		timeFactor:     fset.Float64("time-factor", 0, "multiplier applied to the judge's time limit (0 uses the language's factor)"),
+		maxOutputMiB:   fset.Int64("max-output", 256, "abort a case as OLE once its output exceeds this many MiB (0 means no limit)"),
+		previewInput:   fset.Int64("preview-input", 256, "show the whole input of failing cases up to this many bytes (0 disables)"),
+		showStderr:     fset.Bool("show-stderr", false, "show what the solution wrote to stderr for every verdict, not only RE"),
+		diffLines:      fset.Int("diff-lines", 10, "show a diff of up to this many differing lines when a case is WA (0 disables)"),
+		pipe:           fset.Bool("pipe", false, "judge through pipes without writing outputs to files; outputs are never kept"),
+		jobs:           fset.Int("jobs", 1, "number of cases run concurrently; measured times get noisier when cases compete for CPUs"),
+		liveDiff:       fset.Bool("live-diff", false, "stream each case's output next to the expected output while it runs (interactive terminals only)"),
+		sinks:          fset.String("sinks", defaultResultSinks, "comma-separated result sinks: console, history, results (one JSON per verified file), json:path, junit:path, webhook:url"),
+		verbose:        fset.Bool("verbose", false, "print debug logs such as how the time limit was chosen"),
+		strictSpace:    fset.Bool("strict-space", false, "abort instead of warning when the cache volume lacks room for the testcases"),
+		strict:         fset.Bool("strict", false, "fail files whose verification is incomplete, e.g. truncated cases were skipped or only samples were run; implies -strict-space"),
+		sources:        fset.String("sources", "aoj", "ordered testcase sources to try: aoj, a mirror URL with the judgedat layout, or dir:path"),
+		politeness:     fset.String("politeness", "", "per-judge request interval (or rate like 2/s), concurrency and burst, e.g. judgedat.u-aizu.ac.jp=3s:1,judge.yosupo.jp=4/s:4:8"),
+		downloadJobs:   fset.Int("download-jobs", defaultDownloadJobs, "number of cases downloaded concurrently; requests to each judge are still limited by -politeness"),
+		matrix:         fset.String("matrix", "", "verify each file under these comma-separated environments and show a verdict/time grid: go toolchains (go1.21,go1.23) or C++ compiler commands (g++ -O2,clang++ -O2)"),
+		tokens:         fset.Bool("tokens", false, "compare outputs token by token, ignoring whitespace, trailing newlines and CRLF, like the COMPARE tokens annotation"),
+		format:         fset.String("format", "text", "result format: text logs only, or json to also write a JSON document of every file's cases and summary"),
+		output:         fset.String("output", "-", "where -format json writes the document; - means stdout"),
+		skipVerified:   fset.Bool("skip-verified", false, "skip files whose sources have not changed since they last passed verification"),
+		resume:         fset.Bool("resume", false, "continue the last run if it was interrupted, skipping files it already verified"),
+		label:          fset.String("label", "", "name this run in the history so it can be compared later with `history compare`"),
+	}
+}
+
+func (f *verifyFlags) verifyOptions(annotation *Annotation) (*verifyOptions, error) {
+	policy, err := parseRetentionPolicy(*f.keepOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &verifyOptions{
+		buildTags:         append(splitList(*f.tags), annotation.BuildTags...),
+		failFast:          *f.failFast,
+		retentionPolicy:   policy,
+		retentionMaxAge:   time.Duration(*f.keepOutputDays) * 24 * time.Hour,
+		emitRepro:         *f.emitRepro,
+		maxOutput:         *f.maxOutputMiB << 20,
+		pipe:              *f.pipe,
+		previewInputLimit: *f.previewInput,
+		diffLines:         *f.diffLines,
+		showStderr:        *f.showStderr,
+		sinks:             f.resultSinks,
+		jobs:              *f.jobs,
+		timeoutGrace:      *f.timeoutGrace,
+		label:             *f.label,
+		runID:             f.runID,
+	}
+	if *f.samplesOnly {
+		opts.samples = *f.samples
+	}
+	if *f.liveDiff {
+		opts.liveDiff = os.Stderr
+	}
+
+	return opts, nil
+}
+
+// timeLimitSettings はフラグで指定された制限時間の決め方を返す
+func (f *verifyFlags) timeLimitSettings() *timeLimitSettings {
+	return &timeLimitSettings{
+		margin:  *f.timeMargin,
+		maxTime: *f.maxTime,
+		factor:  *f.timeFactor,
+		timeout: *f.timeout,
+	}
+}
+
+// apply はログの詳細度やジャッジへのアクセス間隔など、プロセス全体に関わる指定を反映する
+func (f *verifyFlags) apply() error {
+	if *f.verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	strictMode = *f.strict
+	if strictMode {
+		*f.strictSpace = true
+	}
+
+	overrides, err := parsePolitenessOverrides(*f.politeness)
+	if err != nil {
+		return err
+	}
+	judgeTransport.setOverrides(overrides)
+
+	f.resultSinks, err = parseResultSinks(*f.sinks)
+	if err != nil {
+		return err
+	}
+	switch *f.format {
+	case "text":
+	case "json":
+		f.resultSinks = append(f.resultSinks, &jsonFileSink{path: *f.output})
+	default:
+		errMsg := fmt.Sprintf("unknown -format %q: must be text or json", *f.format)
+		return errors.New(errMsg)
+	}
+
+	if *f.liveDiff && !isTerminal(os.Stderr) {
+		// CI のログが出力で埋まらないように、端末で見ているときだけ流す
+		slog.Warn("-live-diff is ignored because stderr is not a terminal")
+		*f.liveDiff = false
+	}
+
+	return nil
+}
+
+// runContext は Ctrl-C や SIGTERM、-run-timeout で中断される context を返す
+func (f *verifyFlags) runContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if *f.runTimeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *f.runTimeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// runVerify は引数で指定された verification file を verify する
+func runVerify(args []string) error {
+	fset := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags := registerVerifyFlags(fset)
+	recursive := fset.Bool("recursive", false, "verify every annotated file under the given directories (the current directory if none)")
+	fset.BoolVar(&scanToolDirs, "scan-tool-dirs", false, "also search the cache, temporary directories and aoj-verify's own source when expanding directories")
+	err := projectCfg.applyFlagDefaults(fset)
+	if err != nil {
+		return err
+	}
+	fset.Parse(args)
+
+	paths := fset.Args()
+	if len(paths) == 0 {
+		if !*recursive {
+			return errors.New("usage: aoj-verify verify [flags] <file|dir>...")
+		}
+		paths = []string{"."}
+	}
+
+	err = flags.apply()
+	if err != nil {
+		return err
+	}
+
+	// 中断されても途中結果は出力する
+	ctx, cancel := flags.runContext()
+	defer cancel()
+
+	prepareFirstRun()
+
+	err = migrateCache()
+	if err != nil {
+		return err
+	}
+
+	filenames, err := expandVerifyArgs(paths)
+	if err != nil {
+		return err
+	}
+
+	var targets []verifyTarget
+	for _, filename := range filenames {
+		// 読めないファイルがあっても他のファイルは verify し、失敗として報告する
+		annotation, err := readAnnotationInFile(filename)
+		if err != nil {
+			targets = append(targets, verifyTarget{file: filename, annotation: &Annotation{}, annotationErr: err})
+			continue
+		}
+		targets = append(targets, verifyTarget{file: filename, annotation: annotation})
+	}
+
+	return verifyTargets(ctx, targets, flags)
+}
+
+// expandVerifyArgs はワイルドカードを含む引数をマッチする verification file に展開し、重複を除いて返す。
+// ワイルドカードで拾ったファイルのうち PROBLEM アノテーションを含まないものは対象にしない。
+// ディレクトリは oj-verify と同じように、その下の PROBLEM アノテーションを含むファイルすべてに展開する
+func expandVerifyArgs(args []string) ([]string, error) {
+	var filenames []string
+	seen := make(map[string]bool)
+	add := func(filename string) {
+		key := filepath.Clean(filename)
+		if !seen[key] {
+			seen[key] = true
+			filenames = append(filenames, filename)
+		}
+	}
+
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			files, err := findAnnotatedFiles(arg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find annotated files in %s: %w", arg, err)
+			}
+			if len(files) == 0 {
+				slog.Warn("no verification files in the directory", slog.String("dir", arg))
+			}
+			for _, f := range files {
+				add(f)
+			}
+			continue
+		}
+
+		if !hasGlobMeta(arg) {
+			add(arg)
+			continue
+		}
+
+		matches, err := expandGlob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand %s: %w", arg, err)
+		}
+
+		found := false
+		for _, m := range matches {
+			ok, err := containsProblemAnnotation(m)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				add(m)
+				found = true
+			}
+		}
+		if !found {
+			slog.Warn("no verification files match the pattern", slog.String("pattern", arg))
+		}
+	}
+
+	if len(filenames) == 0 {
+		return nil, errors.New("no verification files to verify")
+	}
+
+	return filenames, nil
+}
+
+// verifyTarget は verify する 1 ファイルとそのアノテーション
+type verifyTarget struct {
+	file       string
+	annotation *Annotation
+	// annotationErr はアノテーションを読めなかったときのエラー。そのとき annotation は空になる
+	annotationErr error
+}
+
+// verifyTargets は targets を順に verify し、期待通りの結果にならなかったファイルをまとめて返す。
+// 解答の失敗が無くインフラの失敗だけなら、CI が再試行できるように infraError を返す
+func verifyTargets(ctx context.Context, targets []verifyTarget, flags *verifyFlags) error {
+	if *flags.chunk != nil {
+		targets = filterChunk(targets, *flags.chunk)
+	}
+
+	if *flags.reverifyStale > 0 {
+		var err error
+		targets, err = selectReverifyTargets(targets, *flags.reverifyStale)
+		if err != nil {
+			return err
+		}
+	}
+
+	stamps, err := loadVerifiedTimestamps()
+	if err != nil {
+		slog.Warn("failed to load timestamps; verifying every file", slog.Any("error", err))
+		stamps = make(verifiedTimestamps)
+	}
+	if *flags.skipVerified {
+		targets = selectUnverifiedTargets(targets, stamps)
+	}
+
+	orderTargetsByPriority(targets)
+
+	matrix, err := parseMatrix(*flags.matrix)
+	if err != nil {
+		return err
+	}
+
+	session, err := startRunSession(*flags.resume)
+	if err != nil {
+		return err
+	}
+	flags.runID = session.ID
+	defer closeResultSinks(flags.resultSinks)
+
+	var failed, infraFailed []string
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			// 中断された後のファイルも、結果の一覧から抜け落ちないように伝える
+			reportFailedRun(flags.resultSinks, &historyRecord{
+				File:        t.file,
+				ProblemURL:  t.annotation.ProblemURL,
+				StartedAt:   time.Now(),
+				SamplesOnly: *flags.samplesOnly,
+				Label:       *flags.label,
+				RunID:       flags.runID,
+				Cases:       []historyCase{},
+			}, errNotRun)
+			failed = append(failed, t.file+": "+errNotRun.Error())
+			continue
+		}
+
+		if outcome, ok := session.Files[t.file]; ok {
+			slog.Info("skipped: already verified in the resumed run", slog.String("file", t.file))
+			switch {
+			case outcome.Error == "":
+			case outcome.Infra:
+				infraFailed = append(infraFailed, t.file+": "+outcome.Error)
+			default:
+				failed = append(failed, t.file+": "+outcome.Error)
+			}
+			continue
+		}
+
+		startedAt := time.Now()
+		var err error
+		if t.annotationErr != nil {
+			err = t.annotationErr
+		} else if len(matrix) > 0 {
+			err = verifyMatrix(ctx, t, flags, matrix)
+		} else {
+			var summary *runSummary
+			summary, err = verifyFile(ctx, t.file, t.annotation, flags)
+			if err == nil {
+				err = checkExpectation(t.file, t.annotation, summary)
+			}
+		}
+		// 失敗したファイルの警告も、次のファイルに持ち越さないように捨てる
+		if strictErr := checkStrict(); err == nil {
+			err = strictErr
+		}
+		if err != nil && !errors.Is(err, errSkipped) {
+			reportFailedRun(flags.resultSinks, &historyRecord{
+				File:        t.file,
+				ProblemURL:  t.annotation.ProblemURL,
+				StartedAt:   startedAt,
+				SamplesOnly: *flags.samplesOnly,
+				Label:       *flags.label,
+				RunID:       flags.runID,
+				Cases:       []historyCase{},
+			}, err)
+		}
+		switch {
+		case err == nil, errors.Is(err, errSkipped):
+		case isInfraError(err):
+			slog.Error("verification failed", slog.String("file", t.file), slog.String("kind", failureKind(err)), slog.Any("error", err))
+			infraFailed = append(infraFailed, t.file+": "+err.Error())
+		default:
+			slog.Error("verification failed", slog.String("file", t.file), slog.String("kind", failureKind(err)), slog.Any("error", err))
+			failed = append(failed, t.file+": "+err.Error())
+		}
+
+		// 途中で中断されたファイルは、-resume で verify し直す
+		if ctx.Err() == nil {
+			err := session.record(t.file, err)
+			if err != nil {
+				slog.Warn("failed to record the run session", slog.Any("error", err))
+			}
+		}
+		// サンプルだけで通ったファイルは、verify し終えたことにしない
+		if ctx.Err() == nil && !errors.Is(err, errSkipped) && !*flags.samplesOnly {
+			err := stamps.record(t, err)
+			if err != nil {
+				slog.Warn("failed to record the verification timestamp", slog.String("file", t.file), slog.Any("error", err))
+			}
+		}
+	}
+
+	if ctx.Err() == nil {
+		err := session.finish()
+		if err != nil {
+			slog.Warn("failed to record the run session", slog.Any("error", err))
+		}
+	}
+
+	if len(targets) > 1 {
+		slog.Info("overall summary",
+			slog.Int("files", len(targets)),
+			slog.Int("failed", len(failed)),
+			slog.Int("infrastructure failures", len(infraFailed)),
+		)
+	}
+
+	if len(failed) > 0 {
+		all := append(failed, infraFailed...)
+		errMsg := fmt.Sprintf("%d file(s) failed verification:\n  %s", len(all), strings.Join(all, "\n  "))
+		return errors.New(errMsg)
+	}
+	if len(infraFailed) > 0 {
+		errMsg := fmt.Sprintf("%d file(s) could not be verified due to infrastructure failures:\n  %s", len(infraFailed), strings.Join(infraFailed, "\n  "))
+		return &infraError{err: errors.New(errMsg)}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("verification aborted: %w", context.Cause(ctx))
+	}
+
+	return nil
+}
+
+// prepareFirstRun は初回実行時にテストケースをコミットしてしまわないように .gitignore を確認する
+func prepareFirstRun() {
+	if existsFileOrDir(workDir) {
+		return
+	}
+
+	err := ensureGitignored(confirmOnTerminal)
+	if err != nil {
+		slog.Warn("failed to update .gitignore", slog.Any("error", err))
+	}
+}
+
+// checkExpectation は summary が annotation で期待した結果になったかを確かめる。
+// EXPECT が無ければ全ケース AC を、あればそのジャッジ結果で落ちることを期待する
+func checkExpectation(filename string, annotation *Annotation, summary *runSummary) error {
+	if annotation.Expect == unknown {
+		if !summary.allAccepted() {
+			return errors.New(summary.verdict())
+		}
+		return nil
+	}
+
+	if summary.allAccepted() {
+		return fmt.Errorf("expected %s but all %d case(s) passed", annotation.Expect, summary.total)
+	}
+	if summary.count(annotation.Expect) == 0 {
+		warnStrict("failed as expected but with a different verdict", slog.String("file", filename), slog.String("expected", annotation.Expect.String()))
+	} else {
+		slog.Info("failed as expected", slog.String("file", filename), slog.String("expected", annotation.Expect.String()), slog.Int("count", summary.count(annotation.Expect)))
+	}
+
+	return nil
+}
+
+// errSkipped はタグが一致しないなどの理由で verify しなかったことを表す
+var errSkipped = errors.New("skipped")
+
+// errNotRun は中断されたために verify しなかったファイルのエラー
+var errNotRun = errors.New("not run")
+
+// verifyFile は 1 つの verification file について、テストケースのダウンロードから verify までを行う
+func verifyFile(ctx context.Context, filename string, annotation *Annotation, flags *verifyFlags) (*runSummary, error) {
+	if !annotation.hasAnyTag(splitList(*flags.tagFilter)) {
+		slog.Info("skipped: no matching tag", slog.String("file", filename), slog.Any("tags", annotation.Tags))
+		return nil, errSkipped
+	}
+
+	err := checkSelfReference(filename, annotation)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := flags.verifyOptions(annotation)
+	if err != nil {
+		return nil, err
+	}
+	opts.extraSources = annotation.sourceFiles(filename)[1:]
+	opts.skipCases = annotation.SkipCases
+	opts.checker = annotation.checkerPath(filename)
+	opts.interactive = annotation.interactivePath(filename)
+	opts.templateVars = templateVars(annotation)
+	opts.compareOptions, err = resolveCompareOptions(filename, annotation, *flags.tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var phases phaseDurations
+	var phaseStopwatch stopwatch.Stopwatch
+	phaseStopwatch.Start()
+
+	// テストケースダウンロード編
+	sourcesSpec := *flags.sources
+	if annotation.TestcaseSources != "" {
+		sourcesSpec = annotation.TestcaseSources
+	}
+	sources, err := parseTestcaseSources(sourcesSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	dlOpts := &downloadOptions{
+		refresh:     *flags.refresh,
+		headerTTL:   *flags.headerTTL,
+		samples:     opts.samples,
+		sources:     sources,
+		stats:       &downloadStats{},
+		strictSpace: *flags.strictSpace,
+		jobs:        *flags.downloadJobs,
+	}
+	donePhase := profilePhase(ctx, profileDownload)
+	cacheDir, err := downloadTestcases(ctx, annotation.ProblemURL, dlOpts)
+	donePhase()
+	if err != nil {
+		return nil, err
+	}
+
+	lf, err := loadLockfile(*flags.lockfilePath)
+	if err != nil {
+		return nil, err
+	}
+	if lf != nil {
+		actual, err := computeCaseChecksums(cacheDir, caseSchemaForURL(annotation.ProblemURL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute checksums: %w", err)
+		}
+		err = lf.verifyChecksums(annotation.ProblemURL, actual, opts.samples > 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *flags.checkLock {
+		// キャッシュが lockfile と一致していても、ジャッジ側で差し替えられているかもしれない
+		if lf == nil {
+			errMsg := fmt.Sprintf("-check-lock needs a lockfile, but %s does not exist", *flags.lockfilePath)
+			return nil, errors.New(errMsg)
+		}
+		remote, err := fetchCaseChecksums(ctx, annotation.ProblemURL, sources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch checksums: %w", err)
+		}
+		err = lf.verifyChecksums(annotation.ProblemURL, remote, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	phases.download = phaseStopwatch.Lap()
+
+	// ジャッジの制限時間が分かればそれを元にケースごとの制限時間を決める
+	var judgeLimit time.Duration
+	metadata, err := loadProblemMetadata(annotation.ProblemURL)
+	if err != nil {
+		warnStrict("failed to load problem metadata; judge time limit is unknown", slog.Any("error", err))
+	} else {
+		judgeLimit = metadata.timeLimit()
+		attrs := []any{slog.String("id", metadata.ProblemID), slog.String("title", metadata.Title), slog.Duration("time limit", judgeLimit)}
+		if metadata.MemoryLimit > 0 {
+			attrs = append(attrs, slog.String("memory limit", fmt.Sprintf("%d MB", metadata.MemoryLimit/1024)))
+		}
+		slog.Info("problem", attrs...)
+	}
+	opts.timeLimit = flags.timeLimitSettings().policy(filename, annotation, judgeLimit)
+	slog.Debug("time limit", slog.String("policy", opts.timeLimit.String()))
+
+	// Verify編
+	summary, err := verify(ctx, cacheDir, filename, annotation.ProblemURL, opts, &phases)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordStats(&statsRecord{
+		File:         filename,
+		At:           time.Now(),
+		Download:     phases.download,
+		Build:        phases.build,
+		Judge:        phases.judge,
+		Cases:        summary.total,
+		HeaderCached: dlOpts.stats.headerCached,
+		CachedCases:  dlOpts.stats.cachedCases,
+		FetchedCases: dlOpts.stats.fetchedCases,
+		FetchedBytes: dlOpts.stats.fetchedBytes,
+	})
+	if err != nil {
+		slog.Warn("failed to record stats", slog.Any("error", err))
+	}
+
+	slog.Info("phases",
+		slog.Duration("download", phases.download),
+		slog.Duration("build", phases.build),
+		slog.Duration("judge", phases.judge),
+		slog.Duration("total", phaseStopwatch.Elapsed()),
+		slog.String("downloaded", formatBytes(dlOpts.stats.fetchedBytes)),
+	)
+
+	return summary, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// リリースビルドでは ldflags で埋め込む。
+// e.g. go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// buildMetadata は aoj-verify 自身のバージョンとビルドの情報
+type buildMetadata struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuildMetadata は ldflags で埋め込まれた情報を返す。埋め込まれていなければ go install などで付いたビルド情報を使う
+func currentBuildMetadata() *buildMetadata {
+	m := &buildMetadata{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if m.Version == "" {
+			m.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && m.Commit == "":
+				m.Commit = s.Value
+			case s.Key == "vcs.time" && m.BuildDate == "":
+				m.BuildDate = s.Value
+			}
+		}
+	}
+
+	if m.Version == "" {
+		m.Version = "unknown"
+	}
+	return m
+}
+
+// runVersion はバージョンとビルドの情報を表示する
+func runVersion(args []string) error {
+	fset := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "print as JSON")
+	fset.Parse(args)
+
+	m := currentBuildMetadata()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+
+	fmt.Fprintf(os.Stdout, "aoj-verify %s\n", m.Version)
+	if m.Commit != "" {
+		fmt.Fprintf(os.Stdout, "commit:     %s\n", m.Commit)
+	}
+	if m.BuildDate != "" {
+		fmt.Fprintf(os.Stdout, "build date: %s\n", m.BuildDate)
+	}
+	fmt.Fprintf(os.Stdout, "go:         %s %s\n", m.GoVersion, m.Platform)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	yukicoderHost = "yukicoder.me"
+	// yukicoderAPIBaseURL は yukicoder の API。テストケースの取得には API トークンが要る
+	yukicoderAPIBaseURL = "https://yukicoder.me/api/v1"
+	// yukicoderTokenEnv はトークンを読む環境変数。設定ファイルの credentials で別の変数にもできる
+	yukicoderTokenEnv = "YUKICODER_TOKEN"
+)
+
+// yukicoderSource は yukicoder の API からテストケースを取得する。problemID は問題番号 (No.)
+type yukicoderSource struct{}
+
+func (s *yukicoderSource) String() string {
+	return yukicoderHost
+}
+
+func (s *yukicoderSource) fetchHeader(ctx context.Context, problemID string) (*testcasesHeaderResponse, error) {
+	body, err := yukicoderGet(ctx, fmt.Sprintf("/problems/no/%s/file/in", problemID))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = json.Unmarshal(body, &files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal testcase list: %w", err)
+	}
+
+	resp := &testcasesHeaderResponse{ProblemID: problemID}
+	for i, f := range files {
+		resp.Headers = append(resp.Headers, &header{
+			Serial: i + 1,
+			Name:   strings.TrimSuffix(f, path.Ext(f)),
+			File:   f,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *yukicoderSource) fetchTestcase(ctx context.Context, problemID string, h *header) (*testcase, error) {
+	in, err := yukicoderGet(ctx, fmt.Sprintf("/problems/no/%s/file/in/%s", problemID, url.PathEscape(h.File)))
+	if err != nil {
+		return nil, err
+	}
+	out, err := yukicoderGet(ctx, fmt.Sprintf("/problems/no/%s/file/out/%s", problemID, url.PathEscape(h.File)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &testcase{ProblemID: problemID, Serial: h.Serial, In: string(in), Out: string(out)}, nil
+}
+
+// yukicoderProblem は /problems/no/{no} の応答のうち使うもの
+type yukicoderProblem struct {
+	No    int    `json:"No"`
+	Title string `json:"Title"`
+	// TimeLimit は秒。応答に無ければ 0
+	TimeLimit float64 `json:"TimeLimit"`
+}
+
+func fetchYukicoderProblem(ctx context.Context, problemID string) (*yukicoderProblem, error) {
+	body, err := yukicoderGet(ctx, "/problems/no/"+problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	problem := &yukicoderProblem{}
+	err = json.Unmarshal(body, problem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal problem: %w", err)
+	}
+
+	return problem, nil
+}
+
+// yukicoderGet は API の apiPath を取得する。トークンが無い、または受け付けられなかったときは設定方法を案内する
+func yukicoderGet(ctx context.Context, apiPath string) ([]byte, error) {
+	if projectCfg.authorization(yukicoderHost) == "" {
+		errMsg := message(msgYukicoderTokenRequired, yukicoderTokenEnv)
+		return nil, errors.New(errMsg)
+	}
+
+	resp, err := httpGet(ctx, yukicoderAPIBaseURL+apiPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", apiPath, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		errMsg := message(msgYukicoderTokenRejected, resp.Status, yukicoderTokenEnv)
+		return nil, errors.New(errMsg)
+	case resp.StatusCode != http.StatusOK:
+		errMsg := fmt.Sprintf("yukicoder returned %s for %s", resp.Status, apiPath)
+		return nil, errors.New(errMsg)
+	}
+
+	return body, nil
+}